@@ -23,6 +23,7 @@ import errno
 import io
 import re
 import os.path
+from imgtool.files import same_file
 
 def same_keys(a, b):
     """Determine if the dicts a and b have the same keys in them"""
@@ -101,11 +102,21 @@ def main():
             help='Signed image file for secondary image')
     parser.add_argument('-o', '--output', required=True,
             help='Filename to write full image to')
+    parser.add_argument('--force', action='store_true',
+            help='Overwrite the output file if it exists')
 
     args = parser.parse_args()
+    bootloader = os.path.join(args.bootdir, "zephyr.bin")
+    for source in [bootloader, args.primary, args.secondary]:
+        if source is not None and same_file(source, args.output):
+            parser.error("{} is both an input and the output".format(
+                args.output))
+    if os.path.lexists(args.output) and not args.force:
+        parser.error("{} already exists, use --force to overwrite it".format(
+            args.output))
     output = Assembly(args.output, args.bootdir)
 
-    output.add_image(os.path.join(args.bootdir, "zephyr.bin"), 'MCUBOOT')
+    output.add_image(bootloader, 'MCUBOOT')
     output.add_image(args.primary, "IMAGE_0")
     if args.secondary is not None:
         output.add_image(args.secondary, "IMAGE_1")
@@ -15,87 +15,280 @@
 # limitations under the License.
 
 import click
-import getpass
+import collections
+import base64
+import datetime
+import hashlib
+import io
+import json
+import mmap
+import os.path
+import re
+import sys
+import imgtool as imgtool_pkg
 from imgtool import keys
+from imgtool.keys import info as key_info
+from imgtool import boot_record as boot_records
+from imgtool import derive as derivation
+from imgtool.files import same_file
 from imgtool import image
-from imgtool.version import decode_version
+from imgtool import keystore as keystores
+from imgtool import passphrase
+from imgtool import srec
+from imgtool.version import decode_version, format_version
 
 
-def gen_rsa2048(keyfile, passwd):
-    keys.RSA2048.generate().export_private(path=keyfile, passwd=passwd)
+def gen_rsa(key_size, exponent, allow_weak, seed, allow_nonstandard=False):
+    return keys.RSA.generate(key_size=key_size, exponent=exponent,
+                             allow_weak=allow_weak, seed=seed,
+                             allow_nonstandard=allow_nonstandard)
 
 
-def gen_ecdsa_p256(keyfile, passwd):
-    keys.ECDSA256P1.generate().export_private(keyfile, passwd=passwd)
+def gen_rsa_bits(bits=2048, exponent=65537, allow_weak=False, seed=None,
+                 allow_nonstandard=False):
+    return gen_rsa(bits, exponent, allow_weak, seed, allow_nonstandard)
 
 
-def gen_ecdsa_p224(keyfile, passwd):
-    print("TODO: p-224 not yet implemented")
+def gen_rsa2048(exponent=65537, allow_weak=False, seed=None):
+    return gen_rsa(2048, exponent, allow_weak, seed)
 
 
-valid_langs = ['c', 'rust']
+def gen_rsa3072(exponent=65537, allow_weak=False, seed=None):
+    return gen_rsa(3072, exponent, allow_weak, seed)
+
+
+def gen_rsa4096(exponent=65537, allow_weak=False, seed=None):
+    return gen_rsa(4096, exponent, allow_weak, seed)
+
+
+def gen_ecdsa_p256(seed=None):
+    return keys.ECDSA256P1.generate(seed=seed)
+
+
+def gen_x25519(seed=None):
+    return keys.X25519.generate(seed=seed)
+
+
+def gen_ecdsa_p384(seed=None):
+    return keys.ECDSA384P1.generate(seed=seed)
+
+
+def gen_ecdsa_p521(seed=None):
+    return keys.ECDSA521P1.generate(seed=seed)
+
+
+def gen_brainpool_p256r1(seed=None):
+    return keys.ECDSABP256R1.generate(seed=seed)
+
+
+def gen_ed25519(seed=None):
+    return keys.Ed25519.generate(seed=seed)
+
+
+def gen_aes128(seed=None):
+    return keys.AES.generate(128, seed=seed)
+
+
+def gen_aes256(seed=None):
+    return keys.AES.generate(256, seed=seed)
+
+
+def gen_ecdsa_p224(seed=None):
+    return keys.ECDSA224P1.generate(seed=seed)
+
+
+valid_langs = ['c', 'rust', 'python', 'jwk', 'json', 'pem', 'der', 'raw',
+               'raw-c', 'c-mbedtls', 'c-tinycrypt', 'c-zephyr', 'keyhash']
+
+# The getpub formats that are binary rather than text.
+binary_langs = ['der', 'raw']
+
+# The hashes getpub --format keyhash can give, by their hashlib name,
+# and how it can write them.
+keyhash_algorithms = ['sha256', 'sha384']
+keyhash_encodings = ['c', 'raw', 'hex']
+
+# A key type that keygen can generate.  The usage is what MCUboot uses
+# the key for, "signing" or "encryption".  The PEM types are those of
+# the pkcs8 and traditional formats.  Deprecated types are only
+# generated with --allow-deprecated.
+KeyGen = collections.namedtuple('KeyGen', ['generate', 'description',
+                                           'pem_types', 'usage',
+                                           'deprecated'])
+KeyGen.__new__.__defaults__ = (False,)
+
+RSA_PEM = ('PRIVATE KEY', 'RSA PRIVATE KEY')
+EC_PEM = ('PRIVATE KEY', 'EC PRIVATE KEY')
+
 keygens = {
-    'rsa-2048':   gen_rsa2048,
-    'ecdsa-p256': gen_ecdsa_p256,
-    'ecdsa-p224': gen_ecdsa_p224,
+    'rsa':        KeyGen(gen_rsa_bits, 'RSA, of the size given by --bits',
+                         RSA_PEM, 'signing'),
+    'rsa-2048':   KeyGen(gen_rsa2048, 'RSA, 2048 bits', RSA_PEM, 'signing'),
+    'rsa-3072':   KeyGen(gen_rsa3072, 'RSA, 3072 bits', RSA_PEM, 'signing'),
+    'rsa-4096':   KeyGen(gen_rsa4096, 'RSA, 4096 bits', RSA_PEM, 'signing'),
+    'ecdsa-p256': KeyGen(gen_ecdsa_p256, 'ECDSA, NIST P-256 curve', EC_PEM,
+                         'signing'),
+    'ecdsa-p384': KeyGen(gen_ecdsa_p384, 'ECDSA, NIST P-384 curve', EC_PEM,
+                         'signing'),
+    'ecdsa-p521': KeyGen(gen_ecdsa_p521, 'ECDSA, NIST P-521 curve', EC_PEM,
+                         'signing'),
+    'ecdsa-p224': KeyGen(gen_ecdsa_p224, 'ECDSA, NIST P-224 curve', EC_PEM,
+                         'signing', deprecated=True),
+    'brainpool-p256r1': KeyGen(gen_brainpool_p256r1,
+                               'ECDSA, brainpoolP256r1 curve', EC_PEM,
+                               'signing'),
+    'ed25519':    KeyGen(gen_ed25519, 'ED25519 signatures',
+                         ('PRIVATE KEY', None), 'signing'),
+    'x25519':     KeyGen(gen_x25519, 'X25519 key agreement',
+                         ('PRIVATE KEY', None), 'encryption'),
+    'aes-128':    KeyGen(gen_aes128, 'AES-128, for key-wrap encryption',
+                         ('AES KEY', None), 'encryption'),
+    'aes-256':    KeyGen(gen_aes256, 'AES-256, for key-wrap encryption',
+                         ('AES KEY', None), 'encryption'),
 }
 
 
-def load_key(keyfile):
-    # TODO: better handling of invalid pass-phrase
-    key = keys.load(keyfile)
-    if key is not None:
-        return key
-    passwd = getpass.getpass("Enter key passphrase: ").encode('utf-8')
-    return keys.load(keyfile, passwd)
+def check_permissions(path, insecure_perms=False):
+    """Refuse a private key file others can read, unless insecure_perms
+    is set, when it is only a warning."""
+    problem = keys.check_permissions(path)
+    if problem is not None:
+        if not insecure_perms:
+            raise click.ClickException(
+                    "{}, use --insecure-key-perms to use it anyway".format(
+                        problem))
+        click.echo("WARNING: {}".format(problem), err=True)
 
 
-def get_password():
-    while True:
-        passwd = getpass.getpass("Enter key passphrase: ")
-        passwd2 = getpass.getpass("Reenter passphrase: ")
-        if passwd == passwd2:
-            break
-        print("Passwords do not match, try again")
+def load_key(keyfile, source=None, insecure_perms=False, allow_weak=False,
+             raw=None, key_format=None, index=None, pem_type=None,
+             check_validity=True):
+    """Load the key, which is either a key file, "-" for a key read from
+    stdin, "keystore:name" for a key in a keystore, or "agent:name" for
+    a key in ssh-agent.  source is the passphrase.Source of the
+    passphrase, if the key is encrypted.  Keys below the minimum
+    strength are refused, unless allow_weak is set.  raw is the key
+    already read from stdin, if it has been.  key_format is one of the
+    raw key formats, for a key file that is just the private scalar.
+    index and pem_type choose the key from a PEM file holding several.
+    The public key of a certificate is used, with a warning if
+    check_validity is set and the certificate has expired or isn't valid
+    yet."""
+    if source is None:
+        source = passphrase.Source()
+    store, name = keystores.split_key_ref(keyfile)
+    if store is not None or keys.is_agent_ref(keyfile):
+        if key_format is not None:
+            raise click.UsageError("--key-format is only for key files")
+        if index is not None or pem_type is not None:
+            raise click.UsageError(
+                    "--key-index and --key-pem-type are only for key files")
+    select = dict(key_format=key_format, index=index, pem_type=pem_type)
+    if keyfile == '-':
+        key = load_stdin_key(source, raw, **select)
+        keyfile = 'stdin'
+    elif keys.is_agent_ref(keyfile):
+        try:
+            key = keys.load_agent(keyfile)
+        except keys.KeyUsageError as e:
+            raise click.ClickException("{}".format(e))
+    elif store is not None:
+        try:
+            key = open_keystore(store, source, insecure_perms).get(name)
+        except keystores.KeystoreError as e:
+            raise click.ClickException("{}".format(e))
+    else:
+        try:
+            # The passphrase is only looked for if the key needs one.
+            key = keys.load(keyfile, **select)
+            if key is None:
+                key = load_with_passphrase(keyfile, source.get(), **select)
+        except passphrase.PassphraseError as e:
+            raise click.UsageError("{} is encrypted: {}".format(keyfile, e))
+        except keys.KeyUsageError as e:
+            raise click.ClickException("{}: {}".format(keyfile, e))
+        if key is None:
+            raise click.ClickException(
+                    "Invalid passphrase for {}, bad decrypt".format(keyfile))
+        if keys.is_private(key):
+            check_permissions(keyfile, insecure_perms)
+    if not allow_weak:
+        try:
+            keys.check_strength(key)
+        except keys.WeakKeyError as e:
+            raise click.ClickException(
+                    "{}: {}, use --allow-weak-keys to use it anyway".format(
+                        keyfile, e))
+    if key.deprecated() is not None:
+        click.echo("WARNING: {}".format(key.deprecated()), err=True)
+    if key.certificate is not None and check_validity:
+        problem = keys.cert.validity_problem(key.certificate)
+        if problem is not None:
+            click.echo("WARNING: {}: {}, use --ignore-cert-validity to "
+                       "use it without this warning".format(keyfile, problem),
+                       err=True)
+    return key
 
-    # Password must be bytes, always use UTF-8 for consistent
-    # encoding.
-    return passwd.encode('utf-8')
 
+def load_stdin_key(source, raw=None, **select):
+    """Load a key piped in on stdin.  The passphrase of an encrypted key
+    can't be prompted for, so must be in a file or the environment.
+    select is passed on to keys.load_bytes, to choose the key."""
+    if raw is None:
+        raw = keys.secret.read_stdin()
+    with raw:
+        if not raw:
+            raise click.UsageError("No key on stdin")
+        try:
+            key = keys.load_bytes(raw, **select)
+            if key is None:
+                with source.get(prompt_ok=False) as passwd:
+                    key = keys.load_bytes(raw, passwd, **select)
+        except passphrase.PassphraseError as e:
+            raise click.UsageError("The key on stdin is encrypted: {}".format(e))
+        except keys.KeyUsageError as e:
+            raise click.ClickException("stdin: {}".format(e))
+    if key is None:
+        raise click.ClickException(
+                "Invalid passphrase for the key on stdin, bad decrypt")
+    return key
 
-@click.option('-p', '--password', is_flag=True,
-              help='Prompt for password to protect key')
-@click.option('-t', '--type', metavar='type', required=True,
-              type=click.Choice(keygens.keys()))
-@click.option('-k', '--key', metavar='filename', required=True)
-@click.command(help='Generate pub/private keypair')
-def keygen(type, key, password):
-    password = get_password() if password else None
-    keygens[type](key, password)
 
+def load_with_passphrase(keyfile, passwd, **select):
+    """Load the key, wiping the passphrase afterwards."""
+    with passwd:
+        return keys.load(keyfile, passwd, **select)
 
-@click.option('-l', '--lang', metavar='lang', default=valid_langs[0],
-              type=click.Choice(valid_langs))
-@click.option('-k', '--key', metavar='filename', required=True)
-@click.command(help='Get public key from keypair')
-def getpub(key, lang):
-    key = load_key(key)
-    if key is None:
-        print("Invalid passphrase")
-    elif lang == 'c':
-        key.emit_c()
-    elif lang == 'rust':
-        key.emit_rust()
-    else:
-        raise ValueError("BUG: should never get here!")
 
+def open_keystore(path, source=None, insecure_perms=False, create=False):
+    """Open the keystore, getting its passphrase from the source.  With
+    create, a keystore that doesn't exist yet is created, once saved."""
+    if source is None:
+        source = passphrase.Source()
+    exists = os.path.exists(path)
+    if not exists and not create:
+        raise click.ClickException("Keystore {} does not exist".format(path))
+    if exists:
+        check_permissions(path, insecure_perms)
+    try:
+        passwd = source.get(confirm=not exists)
+        if not exists:
+            return keystores.Keystore.create(path, passwd)
+        return keystores.Keystore.load(path, passwd)
+    except passphrase.PassphraseError as e:
+        raise click.UsageError("{}".format(e))
+    except keystores.KeystoreError as e:
+        raise click.ClickException("{}".format(e))
 
-def validate_version(ctx, param, value):
+
+def get_password(passphrase_file=None, option='--passphrase-file'):
+    """The passphrase to protect a key being written.  The environment
+    variable is only for reading keys, so isn't used."""
+    source = passphrase.Source(passphrase_file, use_env=False, option=option)
     try:
-        decode_version(value)
-        return value
-    except ValueError as e:
-        raise click.BadParameter("{}".format(e))
+        return source.get(confirm=True)
+    except passphrase.PassphraseError as e:
+        raise click.UsageError("{}".format(e))
 
 
 class BasedIntParamType(click.ParamType):
@@ -112,36 +305,2095 @@ class BasedIntParamType(click.ParamType):
             self.fail('%s is not a valid integer' % value, param, ctx)
 
 
-@click.argument('outfile')
-@click.argument('infile')
+@click.option('-c', '--comment',
+              help='Comment to record in the key file')
+@click.option('--c-out', metavar='filename',
+              help='Also write the public key, as getpub gives it, to ' +
+                   'this C source file')
+@click.option('--pub-out', metavar='filename',
+              help='Also write the public key to this file')
+@click.option('--seed-file', metavar='filename',
+              help='INSECURE: derive the key from the contents of this ' +
+                   'file, for test fixtures only')
+@click.option('--backup', default=False, is_flag=True,
+              help='Rename an existing key file, rather than overwriting it')
+@click.option('--force', default=False, is_flag=True,
+              help='Overwrite an existing key file')
+@click.option('--allow-deprecated', default=False, is_flag=True,
+              help='Allow generating deprecated key types')
+@click.option('--allow-nonstandard', default=False, is_flag=True,
+              help='Allow RSA key sizes other than 2048, 3072 and 4096')
+@click.option('--bits', type=int,
+              help='Size of the key, for the rsa type (defaults to 2048)')
+@click.option('--allow-weak-exponent', default=False, is_flag=True,
+              help='Allow RSA public exponents below 65537')
+@click.option('--rsa-exponent', type=BasedIntParamType(),
+              help='Public exponent for RSA keys (defaults to 65537)')
+@click.option('--passphrase-file', metavar='filename',
+              help='Protect the key with the passphrase read from this file')
+@click.option('-p', '--password', is_flag=True,
+              help='Prompt for password to protect key')
+@click.option('-e', '--encoding', metavar='encoding', default='pem',
+              type=click.Choice(keys.ENCODINGS),
+              help='Key file encoding (defaults to pem)')
+@click.option('-f', '--format', metavar='format', default='pkcs8',
+              type=click.Choice(keys.PRIVATE_FORMATS),
+              help='Private key format (defaults to pkcs8)')
+@click.option('-t', '--type', metavar='type', required=True,
+              type=click.Choice(keygens.keys()),
+              help='Type of key, see the keytypes command')
+@click.option('-k', '--key', metavar='filename', required=True,
+              help='File to write the key to, "-" for stdout')
+@click.command(help='Generate pub/private keypair')
+def keygen(type, key, format, encoding, password, passphrase_file, rsa_exponent,
+           allow_weak_exponent, force, backup, seed_file, pub_out, bits,
+           allow_nonstandard, comment, allow_deprecated, c_out):
+    if keygens[type].deprecated and not allow_deprecated:
+        raise click.UsageError(
+                "The {} key type is deprecated, use --allow-deprecated "
+                "to generate it anyway".format(type))
+    opts = {}
+    if bits is not None or allow_nonstandard:
+        if type != 'rsa':
+            raise click.UsageError("--bits is only valid for the rsa type")
+        opts['bits'] = 2048 if bits is None else bits
+        opts['allow_nonstandard'] = allow_nonstandard
+        try:
+            keys.check_key_size(opts['bits'], allow_nonstandard)
+        except keys.RSAUsageError as e:
+            raise click.BadParameter("{}".format(e), param_hint='--bits')
+    if rsa_exponent is not None or allow_weak_exponent:
+        if not type.startswith('rsa'):
+            raise click.UsageError("--rsa-exponent is only valid for RSA keys")
+        opts['exponent'] = 65537 if rsa_exponent is None else rsa_exponent
+        opts['allow_weak'] = allow_weak_exponent
+        try:
+            keys.check_exponent(opts['exponent'], allow_weak_exponent)
+        except keys.RSAUsageError as e:
+            raise click.BadParameter("{}".format(e),
+                                     param_hint='--rsa-exponent')
+    if seed_file is not None:
+        with open(seed_file, 'rb') as f:
+            opts['seed'] = f.read()
+        click.echo("WARNING: INSECURE: key derived from {}, ".format(seed_file) +
+                   "only use it for testing", err=True)
+    if key != '-' and os.path.lexists(key) and not (force or backup):
+        raise click.UsageError(
+                "Key file {} already exists, use --force to overwrite it, "
+                "or --backup to keep a copy".format(key))
+    for out in [pub_out, c_out]:
+        if out is not None and out != '-' and os.path.lexists(out) \
+                and not force:
+            raise click.UsageError(
+                    "Public key file {} already exists, use --force to "
+                    "overwrite it".format(out))
+    if password or passphrase_file is not None:
+        password = get_password(passphrase_file)
+    else:
+        password = None
+    k = keygens[type].generate(**opts)
+    if k is not None and k.deprecated() is not None:
+        click.echo("WARNING: {}".format(k.deprecated()), err=True)
+
+    # Keys derived from a seed should always be the same, so don't
+    # record when they were made.
+    metadata = []
+    if seed_file is None:
+        now = datetime.datetime.now(datetime.timezone.utc)
+        metadata.append(('Created', now.strftime('%Y-%m-%dT%H:%M:%SZ')))
+    metadata.append(('Tool', 'imgtool ' + imgtool_pkg.imgtool_version))
+    metadata.append(('KeyType', type))
+    if comment is not None:
+        metadata.append(('Comment', comment))
+
+    if k is not None:
+        if backup and key != '-' and os.path.lexists(key):
+            click.echo("Moved existing key to {}".format(keys.backup(key)),
+                       err=True)
+        try:
+            # Render the source first, so a key without a public half
+            # fails before anything is written.
+            if c_out is not None:
+                source = io.StringIO()
+                emit_public(k, 'c', file=source)
+            k.export_private(key, passwd=password, format=format,
+                             overwrite=force, encoding=encoding,
+                             metadata=metadata)
+            if password is not None:
+                password.zeroize()
+            if pub_out is not None:
+                k.export_public(pub_out, overwrite=force)
+            if c_out is not None:
+                keys.write_public(c_out, source.getvalue().encode('utf-8'),
+                                  overwrite=force)
+        except (keys.KeyUsageError, keys.KeyFileExists) as e:
+            raise click.UsageError("{}".format(e))
+        if not isinstance(k, keys.AES):
+            click.echo("Public key fingerprint (SHA-256): {}".format(
+                format_fingerprint(k.fingerprint())), err=True)
+
+
+@click.option('--json', 'as_json', default=False, is_flag=True,
+              help='Output the list as JSON')
+@click.command(help='List the key types keygen supports')
+def keytypes(as_json):
+    types = []
+    for name in sorted(keygens):
+        kg = keygens[name]
+        types.append(collections.OrderedDict([
+            ('name', name),
+            ('description', kg.description),
+            ('pem_types', collections.OrderedDict(
+                [('pkcs8', kg.pem_types[0]), ('traditional', kg.pem_types[1])])),
+            ('usage', kg.usage),
+            ('deprecated', kg.deprecated)]))
+    if as_json:
+        print(json.dumps(types, indent=4))
+        return
+    row = "{{:<{}}} {{:<11}} {{:<16}} {{}}".format(
+            max(len(t['name']) for t in types))
+    print(row.format("TYPE", "USAGE", "PEM", "DESCRIPTION"))
+    for t in types:
+        pem = t['pem_types']['traditional'] or t['pem_types']['pkcs8']
+        print(row.format(t['name'], t['usage'], pem, t['description']))
+
+
+def format_fingerprint(digest, encoding='hex'):
+    if encoding == 'base64':
+        return base64.b64encode(digest).decode('ascii')
+    return digest.hex()
+
+
+# The getpub formats that hold the DER encoding, which an RSA key can
+# give as either of the keys.RSA_ENCODINGS.
+der_langs = ['c', 'rust', 'python', 'json', 'der', 'c-mbedtls', 'keyhash']
+
+# The getpub formats holding the point of an EC key, which can be in
+# either of the keys.POINT_FORMATS.
+point_langs = der_langs + ['raw', 'raw-c']
+
+# The getpub formats with C arrays, which the --c- options lay out.
+c_langs = ['c', 'raw-c', 'c-mbedtls', 'c-tinycrypt', 'c-zephyr', 'keyhash']
+
+# The getpub formats whose C array can be one of words, with
+# --c-word-size.
+word_langs = ['c', 'raw-c', 'keyhash']
+
+# The file name extension of each getpub format, for --key-dir.
+# --format keyhash is a C file, unless --encoding makes it otherwise.
+lang_extensions = {
+    'c': '.c', 'rust': '.rs', 'python': '.py', 'jwk': '.jwk',
+    'json': '.json', 'pem': '.pem', 'der': '.der', 'raw': '.bin',
+    'raw-c': '.c', 'c-mbedtls': '.c', 'c-tinycrypt': '.c',
+    'c-zephyr': '.c', 'keyhash': '.c',
+}
+keyhash_extensions = {'raw': '.bin', 'hex': '.txt'}
+
+# The getpub formats that can hold several keys, with their table.
+table_langs = ['c', 'c-zephyr']
+
+# The MCUBOOT_SIGN_ option of the bootloader that checks each type of
+# key, for --format c-zephyr.
+zephyr_sign_options = collections.OrderedDict([
+        ('rsa-2048', 'MCUBOOT_SIGN_RSA'),
+        ('ecdsa-p224', 'MCUBOOT_SIGN_EC'),
+        ('ecdsa-p256', 'MCUBOOT_SIGN_EC256'),
+])
+
+
+def public_der(key, rsa_encoding=None, point_format=None):
+    """The DER the source code output holds.  rsa_encoding is one of the
+    keys.RSA_ENCODINGS, for an RSA key, and point_format one of the
+    keys.POINT_FORMATS, for an EC key, the others only having one."""
+    if rsa_encoding is not None and isinstance(key, keys.RSAPublic):
+        return key.get_public_bytes(rsa_encoding)
+    if point_format is not None and isinstance(key, keys.ECDSAPublic):
+        return key.get_public_bytes(point_format)
+    return key.get_public_bytes()
+
+
+def public_raw(key, point_prefix=False, point_format=None):
+    """The raw key, with the point of an EC key in point_format."""
+    if point_format is not None and isinstance(key, keys.ECDSAPublic):
+        return key.get_raw_public_bytes(point_prefix, point_format)
+    return key.get_raw_public_bytes(point_prefix)
+
+
+def emit_public(key, lang, file=sys.stdout, name=None, point_prefix=False,
+                symbol=None, rsa_encoding=None, point_format=None,
+                key_path=None, c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the public half of the key as getpub does.  The identifiers
+    of the source code output are named after name, if it is given,
+    rather than the type of key, or symbol is the name of the array.
+    point_prefix keeps the 0x04 of a raw EC point, point_format
+    compresses it, and rsa_encoding chooses the DER of an RSA key.
+    key_path is where the key was read from, for the JSON output, and
+    c_style is the formatters.CStyle of the C output."""
+    if point_prefix and lang not in ('raw', 'raw-c'):
+        raise click.UsageError("--point-prefix is only for raw output")
+    if rsa_encoding is not None and lang not in der_langs:
+        raise click.UsageError(
+                "--rsa-encoding is only for the source code and DER output")
+    if point_format is not None and lang not in point_langs:
+        raise click.UsageError(
+                "--point-format is only for the source code, DER and raw "
+                "output")
+    if lang == 'c':
+        key.emit_c(file=file, name=name, symbol=symbol,
+                   encoded=public_der(key, rsa_encoding, point_format),
+                   style=c_style)
+    elif lang == 'rust':
+        key.emit_rust(file=file, name=name, symbol=symbol,
+                      encoded=public_der(key, rsa_encoding, point_format))
+    elif lang == 'python':
+        key.emit_python(file=file, name=name, symbol=symbol,
+                        encoded=public_der(key, rsa_encoding, point_format))
+    elif lang == 'c-mbedtls':
+        emit_c_mbedtls(key, file, name, symbol, rsa_encoding, point_format,
+                       c_style)
+    elif lang == 'c-tinycrypt':
+        emit_c_tinycrypt(key, file, name, symbol, c_style)
+    elif lang == 'raw-c':
+        key.emit_raw_c(file=file, name=name, symbol=symbol,
+                       encoded=public_raw(key, point_prefix, point_format),
+                       style=c_style)
+    elif name is not None or symbol is not None:
+        raise click.UsageError(
+                "--name and --symbol are only for source code output")
+    elif lang == 'raw':
+        key.emit_raw(file=file,
+                     encoded=public_raw(key, point_prefix, point_format))
+    elif lang == 'jwk':
+        key.emit_jwk(file=file)
+    elif lang == 'json':
+        record = key_info.public_json(
+                key, key_path, public_der(key, rsa_encoding, point_format))
+        print(json.dumps(record._asdict(), indent=4), file=file)
+    elif lang == 'pem':
+        key.emit_pem(file=file)
+    elif lang == 'der':
+        key.emit_der(file=file,
+                     encoded=public_der(key, rsa_encoding, point_format))
+    else:
+        raise ValueError("BUG: should never get here!")
+
+
+def emit_c_mbedtls(key, file=sys.stdout, name=None, symbol=None,
+                   rsa_encoding=None, point_format=None,
+                   c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the C array, and a function parsing it into an
+    mbedtls_pk_context, named init_ and the name of the array when
+    --name or --symbol gives it, or else init_pub_key.  An RSA key is the
+    SubjectPublicKeyInfo, unless rsa_encoding says otherwise, as every
+    version of mbedTLS parses that."""
+    if not isinstance(key, (keys.RSAPublic, keys.ECDSAPublic)):
+        raise click.UsageError(
+                "mbedTLS can't parse {} keys, only RSA and EC ones".format(
+                    key.shortname()))
+    if point_format == 'compressed':
+        raise click.UsageError("mbedTLS can't parse compressed points")
+    ident = key.c_identifier(name, symbol)
+    function = "init_" + (ident if name or symbol else "pub_key")
+    data = public_der(key, rsa_encoding or 'spki', point_format)
+    print(keys.formatters.format_c_mbedtls(data, ident, function, c_style),
+          end='', file=file)
+
+
+def emit_c_tinycrypt(key, file=sys.stdout, name=None, symbol=None,
+                     c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the point of a P-256 key as the 64 bytes tinycrypt takes,
+    and the hash of the key that signed images give, as C arrays."""
+    if not isinstance(key, keys.ECDSA256P1Public):
+        raise click.UsageError(
+                "tinycrypt only does P-256, not {} keys".format(
+                    keys.key_type(key)))
+    ident = key.c_identifier(name, symbol)
+    print(keys.formatters.format_c_tinycrypt(key.get_raw_public_bytes(),
+                                             key.keyhash(), ident, c_style),
+          end='', file=file)
+
+
+def emit_keyhash(key, file=sys.stdout, name=None, hash_alg='sha256',
+                 encoding='c', symbol=None, rsa_encoding=None,
+                 point_format=None, c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the hash of the public key, as a C array, in binary, or in
+    hex."""
+    digest = key.keyhash(hash_alg,
+                         public_der(key, rsa_encoding, point_format))
+    emit_digest(digest, key.shortname(), file, name, encoding, symbol,
+                c_style)
+
+
+def emit_digest(digest, shortname, file=sys.stdout, name=None, encoding='c',
+                symbol=None, c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the hash of a key as emit_keyhash does, with the C array
+    named after the shortname of the type of key, unless name or symbol
+    is given."""
+    if encoding == 'c':
+        ident = symbol or "{}_pub_key_hash".format(name or shortname)
+        print(keys.formatters.format_c(digest, ident, c_style), end='',
+              file=file)
+    elif name is not None or symbol is not None:
+        raise click.UsageError(
+                "--name and --symbol are only for source code output")
+    elif encoding == 'raw':
+        getattr(file, 'buffer', file).write(digest)
+    else:
+        print(digest.hex(), file=file)
+
+
+def c_array(key, lang, name=None, symbol=None, point_prefix=False,
+            rsa_encoding=None, point_format=None, hash_alg='sha256'):
+    """The bytes of the C array getpub writes for the lang, c, raw-c or
+    keyhash, and its name."""
+    if lang == 'keyhash':
+        digest = key.keyhash(hash_alg,
+                             public_der(key, rsa_encoding, point_format))
+        return digest, symbol or "{}_pub_key_hash".format(
+                name or key.shortname())
+    if lang == 'raw-c':
+        data = public_raw(key, point_prefix, point_format)
+    else:
+        data = public_der(key, rsa_encoding, point_format)
+    return data, key.c_identifier(name, symbol)
+
+
+def check_c_pair(c_header, c_source, lang, encoding, out, point_prefix,
+                 rsa_encoding):
+    """Refuse the options that don't go with --c-header and --c-source."""
+    if c_header is None or c_source is None:
+        raise click.UsageError("Give --c-header and --c-source together")
+    if out is not None:
+        raise click.UsageError(
+                "--out is for one file, not --c-header and --c-source")
+    if lang not in ('c', 'raw-c', 'keyhash') or encoding not in (None, 'c'):
+        raise click.UsageError(
+                "--c-header and --c-source are only for C output")
+    if point_prefix and lang != 'raw-c':
+        raise click.UsageError("--point-prefix is only for raw output")
+    if rsa_encoding is not None and lang == 'raw-c':
+        raise click.UsageError(
+                "--rsa-encoding is only for the source code and DER output")
+
+
+def read_template(path):
+    """The text of a getpub --template file."""
+    try:
+        with open(path, encoding='utf-8') as f:
+            return f.read()
+    except OSError as e:
+        raise click.ClickException("Can't read {}: {}".format(
+            path, e.strerror))
+    except UnicodeDecodeError:
+        raise click.ClickException("{} isn't UTF-8 text".format(path))
+
+
+def emit_template(key, template, text, file=sys.stdout, name=None,
+                  symbol=None, rsa_encoding=None, point_format=None,
+                  key_path=None):
+    """Write the key as the template, read from the file template, has
+    it, filled in with the key_info.TEMPLATE_FIELDS."""
+    fields = key_info.template_fields(
+            key, key_path, key.c_identifier(name, symbol),
+            public_der(key, rsa_encoding, point_format),
+            public_raw(key, False, point_format))
+    try:
+        print(keys.formatters.render_template(text, fields), end='',
+              file=file)
+    except keys.formatters.TemplateError as e:
+        raise click.ClickException("{}: {}".format(template, e))
+
+
+def write_output(path, data, mode=None):
+    """Replace the file in one step, as builds may read it while it is
+    written, so they see either the old file or the new one."""
+    try:
+        keys.write_atomic(path, data, mode)
+    except OSError as e:
+        raise click.ClickException("Can't write {}: {}".format(
+            path, e.strerror))
+
+
+def emit_key_table(loaded, file=sys.stdout, name=None, rsa_encoding=None,
+                   point_format=None, c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the keys as one C file, each as an array named after name,
+    or else its type, and its place in the list, then the bootutil_keys
+    table of them in the same order, which is the order of the key
+    indices the bootloader uses."""
+    arrays = []
+    for n, key in enumerate(loaded):
+        ident = "{}_pub_key_{}".format(name or key.shortname(), n)
+        arrays.append((public_der(key, rsa_encoding, point_format), ident))
+    print(keys.formatters.format_c_table(arrays, c_style), end='', file=file)
+
+
+def emit_zephyr_keys(loaded, file=sys.stdout, name=None, symbol=None,
+                     rsa_encoding=None, point_format=None,
+                     c_style=keys.formatters.DEFAULT_C_STYLE):
+    """Write the keys as the keys.c of a Zephyr build, with their
+    bootutil_keys table.  The arrays are named as emit_key_table names
+    them, except that a single key is named as the C output names it.
+    The bootloader checks one type of signature, so the keys have to
+    be of one type, which it has an MCUBOOT_SIGN_ option for."""
+    types = sorted(set(keys.key_type(k) for k in loaded))
+    if len(types) > 1:
+        raise click.UsageError(
+                "The bootloader checks one type of signature, but the keys "
+                "are {}".format(", ".join(types)))
+    option = zephyr_sign_options.get(types[0])
+    if option is None:
+        raise click.UsageError(
+                "The bootloader has no MCUBOOT_SIGN_ option for {} keys, "
+                "only {}".format(types[0], ", ".join(zephyr_sign_options)))
+    if len(loaded) == 1:
+        idents = [loaded[0].c_identifier(name, symbol)]
+    else:
+        idents = ["{}_pub_key_{}".format(name or k.shortname(), n)
+                  for n, k in enumerate(loaded)]
+    arrays = [(public_der(k, rsa_encoding, point_format), ident)
+              for k, ident in zip(loaded, idents)]
+    print(keys.formatters.format_c_zephyr(arrays, option, c_style), end='',
+          file=file)
+
+
+def expand_key_dirs(refs):
+    """The key references, with each directory replaced by the files in
+    it, in name order, leaving out hidden files."""
+    paths = []
+    for ref in refs:
+        if ref == '-' or not os.path.isdir(ref):
+            paths.append(ref)
+            continue
+        names = sorted(n for n in os.listdir(ref) if not n.startswith('.'))
+        found = [os.path.join(ref, n) for n in names
+                 if os.path.isfile(os.path.join(ref, n))]
+        if not found:
+            raise click.UsageError("No key files in {}".format(ref))
+        paths.extend(found)
+    return paths
+
+
+def getpub_dir(key_dir, out_dir, extension, binary, load, emit,
+               named=True, as_json=False):
+    """Write each key file in key_dir to a file of its own in out_dir,
+    named after it.  When the format is named, the identifiers in it are
+    named after the key file too, made into ones C can have.  load loads
+    the key at a path, and emit writes a key, its path and the name for
+    it to a file.  Files that aren't keys, or whose key can't be
+    written, are skipped with a warning.  Nothing is written until every
+    key is, so names that clash, or an output that would replace a file
+    of key_dir, leave out_dir as it was."""
+    try:
+        names = sorted(n for n in os.listdir(key_dir)
+                       if not n.startswith('.') and
+                       os.path.isfile(os.path.join(key_dir, n)))
+    except OSError as e:
+        raise click.ClickException("Can't read {}: {}".format(
+            key_dir, e.strerror))
+    if not names:
+        raise click.UsageError("No files in {}".format(key_dir))
+    inputs = set(os.path.abspath(os.path.join(key_dir, n)) for n in names)
+    written = collections.OrderedDict()
+    skipped = collections.OrderedDict()
+    outputs = {}
+    idents = {}
+    for n in names:
+        path = os.path.join(key_dir, n)
+        stem = os.path.splitext(n)[0]
+        out = os.path.join(out_dir, stem + extension)
+        ident = keys.formatters.identifier_from(stem) if named else None
+        buf = io.BytesIO() if binary else io.StringIO()
+        key = None
+        try:
+            key = load(path)
+            emit(key, path, buf, ident)
+        except (click.ClickException, OSError, ValueError,
+                keys.KeyUsageError) as e:
+            # One file that isn't a key shouldn't stop the rest.
+            message = (e.format_message()
+                       if isinstance(e, click.ClickException) else str(e))
+            click.echo("WARNING: Skipping {}: {}".format(path, message),
+                       err=True)
+            skipped[path] = message
+            continue
+        finally:
+            if key is not None:
+                key.zeroize()
+        if out in outputs:
+            raise click.UsageError(
+                    "{} and {} would both be written to {}".format(
+                        outputs[out], path, out))
+        if named and ident in idents:
+            raise click.UsageError(
+                    "{} and {} would both be named {}".format(
+                        idents[ident], path, ident))
+        if os.path.abspath(out) in inputs:
+            raise click.UsageError(
+                    "The key of {} would replace {}".format(path, out))
+        outputs[out] = path
+        idents[ident] = path
+        data = buf.getvalue()
+        written[path] = (out, ident, data if binary else data.encode('utf-8'))
+    if not written:
+        raise click.ClickException("No keys in {}".format(key_dir))
+    try:
+        os.makedirs(out_dir, exist_ok=True)
+    except OSError as e:
+        raise click.ClickException("Can't create {}: {}".format(
+            out_dir, e.strerror))
+    for out, _, data in written.values():
+        write_output(out, data)
+    if as_json:
+        mapping = collections.OrderedDict(
+                (path, collections.OrderedDict([('out', out),
+                                                ('name', ident)]))
+                for path, (out, ident, _) in written.items())
+        print(json.dumps(collections.OrderedDict([('keys', mapping),
+                                                  ('skipped', skipped)]),
+                         indent=4))
+    else:
+        print("Wrote {} of the files in {} to {}, skipped {}".format(
+            len(written), key_dir, out_dir, len(skipped)))
+
+
+def load_image_key(path):
+    """The key that signed the image at path: the public key in its
+    PUBKEY TLV, and None, or, when it only has a KEYHASH TLV, None and
+    that hash."""
+    try:
+        data = image.read_image(path)
+    except OSError as e:
+        raise click.ClickException("Can't read {}: {}".format(
+            path, e.strerror))
+    except image.ImageError as e:
+        raise click.ClickException("{}: {}".format(path, e))
+    try:
+        tlvs = image.read_tlvs(data)
+    except image.TLVError as e:
+        raise click.ClickException("{}: {}".format(path, e))
+    found = {}
+    for kind, value in tlvs:
+        found.setdefault(kind, value)
+    pub = found.get(image.TLV_VALUES['PUBKEY'])
+    if pub is None:
+        digest = found.get(image.TLV_VALUES['KEYHASH'])
+        if digest is None:
+            raise click.ClickException(
+                    "{} is not signed, it has neither a PUBKEY nor a "
+                    "KEYHASH TLV".format(path))
+        return None, digest
+    try:
+        key = keys.load_bytes(pub)
+    except keys.KeyUsageError as e:
+        raise click.ClickException(
+                "{}: the PUBKEY TLV isn't a public key: {}".format(path, e))
+    if key is None or keys.is_private(key):
+        raise click.ClickException(
+                "{}: the PUBKEY TLV isn't a public key".format(path))
+    return key, None
+
+
+def validate_section(ctx, param, value):
+    if value is None:
+        return None
+    try:
+        keys.formatters.check_section(value)
+    except ValueError as e:
+        raise click.BadParameter("{}".format(e))
+    return value
+
+
+def validate_identifier(ctx, param, value):
+    if value is None:
+        return None
+    try:
+        keys.formatters.check_identifier(value)
+    except ValueError as e:
+        raise click.BadParameter("{}".format(e))
+    return value
+
+
+@click.option('-l', '--lang', '--format', 'lang', metavar='lang',
+              default=valid_langs[0], type=click.Choice(valid_langs),
+              help='Output the key as C, Rust or Python source, as a JWK, as '
+                   'JSON describing it, as a PEM or DER public key, as the '
+                   'raw key, in binary or as C source, as C with a function '
+                   'parsing it with mbedTLS, as the point and hash of a '
+                   'P-256 key for tinycrypt, as the keys.c of a Zephyr '
+                   'build, or the hash of the key')
+@click.option('--allow-weak-keys', default=False, is_flag=True,
+              help='Allow keys below the minimum strength')
+@click.option('--insecure-key-perms', default=False, is_flag=True,
+              help='Use a key file accessible by others, with a warning')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the key passphrase from this file')
+@click.option('-k', '--key', metavar='filename', multiple=True,
+              help='Key file or X.509 certificate, "-" to read it from '
+                   'stdin, keystore:name for a key in a keystore, or '
+                   'agent:name for a key in ssh-agent.  Given more than '
+                   'once, or a directory of keys, the keys are written as '
+                   'one C file with their bootutil_keys table')
+@click.option('--from-image', metavar='filename',
+              help='Get the key that signed this image, from its PUBKEY '
+                   'TLV, rather than from --key.  An image with only the '
+                   'KEYHASH TLV gives its hash, with --format keyhash')
+@click.option('--key-dir', metavar='directory',
+              help='Write each key file in this directory to a file of its '
+                   'own in --out-dir, with the name of the key file, and '
+                   'its identifiers named after it, skipping files that '
+                   "aren't keys")
+@click.option('--out-dir', metavar='directory',
+              help='Directory for the files of --key-dir')
+@click.option('--json', 'as_json', default=False, is_flag=True,
+              help='With --key-dir, print the files written for each key '
+                   'file, and those skipped, as JSON')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.option('--key-format', type=click.Choice(keys.RAW_FORMATS),
+              help='Read the key file as a bare EC private scalar, as some '
+                   'provisioning tools write, rather than detecting its '
+                   'format')
+@click.option('--key-pem-type', metavar='type',
+              type=click.Choice(keys.PRIVATE_TYPES + keys.PUBLIC_TYPES),
+              help='Use the key in the PEM block of this type, of a key '
+                   'file holding several')
+@click.option('--key-index', type=click.IntRange(min=0),
+              help='Use this key, counting from 0, of a PEM key file '
+                   'holding several')
+@click.option('--ignore-cert-validity', default=False, is_flag=True,
+              help="Don't warn about a certificate that has expired or "
+                   "isn't valid yet")
+@click.option('--name', metavar='identifier', callback=validate_identifier,
+              help='Name the identifiers of the source code output after '
+                   'this, rather than the type of key')
+@click.option('--symbol', metavar='identifier', callback=validate_identifier,
+              help='Name the array of the source code output this, and '
+                   'its length this with _len added')
+@click.option('-o', '--out', metavar='filename',
+              help='Write the key to this file rather than stdout, '
+                   'replacing it in one step')
+@click.option('--c-header', metavar='filename',
+              help='Write a header declaring the C array to this file, '
+                   'with --c-source')
+@click.option('--c-source', metavar='filename',
+              help='Write the C array to this file, including the '
+                   '--c-header by name')
+@click.option('--template', metavar='filename',
+              help='Write the key as this template has it, a text file '
+                   'with fields such as {der:cbytes}, rather than in one of '
+                   'the formats')
+@click.option('--c-static', default=False, is_flag=True,
+              help='Declare the C arrays static')
+@click.option('--c-const/--c-no-const', default=True,
+              help='Declare the C arrays const, the default')
+@click.option('--c-section', metavar='name', callback=validate_section,
+              help='Put the C arrays in this linker section, with a GCC '
+                   'section attribute')
+@click.option('--c-bytes-per-line', type=click.IntRange(min=1),
+              metavar='N', help='Write N bytes to a line of the C arrays, '
+                                'rather than 8')
+@click.option('--c-trailing-comma/--c-no-trailing-comma', default=True,
+              help='End the last element of the C arrays with a comma, the '
+                   'default')
+@click.option('--c-word-size', type=click.Choice(['1', '2', '4', '8']),
+              help='Make the C array of the key, or of its hash, one of '
+                   'words of this many bytes, uint32_t for 4, rather than '
+                   'of bytes, with its length in words')
+@click.option('--c-word-endian',
+              type=click.Choice(keys.formatters.WORD_ENDIANS),
+              help='Byte order of the words of --c-word-size')
+@click.option('--rsa-encoding', type=click.Choice(list(keys.RSA_ENCODINGS)),
+              help='Encode an RSA key as the PKCS#1 RSAPublicKey, the '
+                   'default, or as the X.509 SubjectPublicKeyInfo')
+@click.option('--point-format', type=click.Choice(keys.POINT_FORMATS),
+              help='Write the point of an EC key uncompressed, the default '
+                   'and what MCUboot takes, or compressed, half the size')
+@click.option('--point-prefix', default=False, is_flag=True,
+              help='Start the raw point of an EC key with the 0x04 of an '
+                   'uncompressed point')
+@click.option('--hash', 'hash_alg', type=click.Choice(keyhash_algorithms),
+              help='Hash for --format keyhash, sha256 by default')
+@click.option('--encoding', type=click.Choice(keyhash_encodings),
+              help='Write --format keyhash as a C array, the default, in '
+                   'binary, or in hex')
+@click.command(help='Get public key from keypair or certificate')
+def getpub(key, passphrase_file, insecure_key_perms, allow_weak_keys, lang,
+           non_interactive, key_format, key_index, key_pem_type,
+           ignore_cert_validity, name, symbol, out, c_header, c_source,
+           template, point_prefix, point_format, rsa_encoding, c_static,
+           c_const, c_section, c_bytes_per_line, c_trailing_comma, hash_alg,
+           encoding, from_image, c_word_size, c_word_endian, key_dir,
+           out_dir, as_json):
+    if bool(key) + (from_image is not None) + (key_dir is not None) != 1:
+        raise click.UsageError("Give one of --key, --from-image or --key-dir")
+    if (key_dir is None) != (out_dir is None):
+        raise click.UsageError("--key-dir and --out-dir must be given "
+                               "together")
+    if as_json and key_dir is None:
+        raise click.UsageError("--json is only for --key-dir, use --format "
+                               "json to describe a key")
+    if key_dir is not None:
+        for given, option in [(out, '--out'), (name, '--name'),
+                              (symbol, '--symbol'), (c_header, '--c-header'),
+                              (c_source, '--c-source'),
+                              (template, '--template'),
+                              (key_index, '--key-index'),
+                              (key_pem_type, '--key-pem-type')]:
+            if given is not None:
+                raise click.UsageError(
+                        "{} is for a single key, --key-dir names the files "
+                        "and identifiers after the key files".format(option))
+        # These would otherwise skip every key, as emit_public refuses
+        # them for each.
+        if point_prefix and lang not in ('raw', 'raw-c'):
+            raise click.UsageError("--point-prefix is only for raw output")
+        if lang not in ('keyhash', 'c-zephyr'):
+            if rsa_encoding is not None and lang not in der_langs:
+                raise click.UsageError(
+                        "--rsa-encoding is only for the source code and DER "
+                        "output")
+            if point_format is not None and lang not in point_langs:
+                raise click.UsageError(
+                        "--point-format is only for the source code, DER "
+                        "and raw output")
+    if from_image is not None and (key_format is not None or
+                                   key_index is not None or
+                                   key_pem_type is not None):
+        raise click.UsageError(
+                "--key-format, --key-index and --key-pem-type are only for "
+                "key files")
+    if name is not None and symbol is not None:
+        raise click.UsageError("Give either --name or --symbol, not both")
+    if lang != 'keyhash' and (hash_alg is not None or encoding is not None):
+        raise click.UsageError(
+                "--hash and --encoding are only for --format keyhash")
+    binary = lang in binary_langs or encoding == 'raw'
+    if binary and out is None and key_dir is None and sys.stdout.isatty():
+        raise click.UsageError(
+                "--format {} is binary, write it to a file with "
+                "--out".format(lang))
+    paths = expand_key_dirs(key)
+    if paths.count('-') > 1:
+        raise click.UsageError("Only one key can be read from stdin")
+    table = len(paths) > 1 or any(k != '-' and os.path.isdir(k) for k in key)
+    if table:
+        if lang not in table_langs:
+            raise click.UsageError(
+                    "Several keys can only be written as C, or as "
+                    "--format c-zephyr")
+        if symbol is not None:
+            raise click.UsageError(
+                    "--symbol names a single key, use --name for several")
+        if key_index is not None or key_pem_type is not None:
+            raise click.UsageError(
+                    "--key-index and --key-pem-type are for a single key")
+        if point_prefix:
+            raise click.UsageError("--point-prefix is only for raw output")
+    word_size = int(c_word_size or 1)
+    if word_size > 1:
+        if c_word_endian is None:
+            raise click.UsageError("Give --c-word-endian with --c-word-size")
+        if lang not in word_langs or table:
+            raise click.UsageError(
+                    "--c-word-size is only for the array of a single key, "
+                    "with --format c, raw-c or keyhash")
+    elif c_word_endian is not None:
+        raise click.UsageError(
+                "--c-word-endian is only for --c-word-size 2, 4 or 8")
+    c_style = keys.formatters.CStyle(
+            static=c_static, const=c_const, section=c_section,
+            per_row=c_bytes_per_line or 8, trailing_comma=c_trailing_comma,
+            word_size=word_size, word_endian=c_word_endian)
+    if c_style != keys.formatters.DEFAULT_C_STYLE:
+        if (lang not in c_langs or encoding not in (None, 'c') or
+                template is not None):
+            raise click.UsageError(
+                    "--c-static, --c-const, --c-section, --c-bytes-per-line, "
+                    "--c-trailing-comma and --c-word-size are only for C "
+                    "output")
+    pair = c_header is not None or c_source is not None
+    if pair:
+        if table:
+            raise click.UsageError(
+                    "--c-header and --c-source are for a single key")
+        check_c_pair(c_header, c_source, lang, encoding, out, point_prefix,
+                     rsa_encoding)
+        if c_static:
+            raise click.UsageError(
+                    "--c-static can't be used with --c-header, which "
+                    "declares the array extern")
+    text = None
+    if template is not None:
+        if table or pair:
+            raise click.UsageError("--template is for a single key, "
+                                   "written to one file")
+        if lang != 'c':
+            raise click.UsageError("--template replaces --format")
+        if point_prefix:
+            raise click.UsageError("--point-prefix is only for raw output")
+        text = read_template(template)
+    source = passphrase.Source(passphrase_file, not non_interactive)
+    if key_dir is not None:
+        def load(path):
+            return load_key(path, source, insecure_key_perms,
+                            allow_weak=allow_weak_keys, key_format=key_format,
+                            check_validity=not ignore_cert_validity)
+
+        def emit(key, path, file, ident):
+            try:
+                if lang == 'keyhash':
+                    emit_keyhash(key, file, ident, hash_alg or 'sha256',
+                                 encoding or 'c', None, rsa_encoding,
+                                 point_format, c_style)
+                elif lang == 'c-zephyr':
+                    emit_zephyr_keys([key], file, ident, None, rsa_encoding,
+                                     point_format, c_style)
+                else:
+                    emit_public(key, lang, file=file, name=ident,
+                                point_prefix=point_prefix,
+                                rsa_encoding=rsa_encoding,
+                                point_format=point_format, key_path=path,
+                                c_style=c_style)
+            except keys.KeyUsageError as e:
+                raise click.UsageError(e)
+
+        if lang == 'keyhash' and encoding in keyhash_extensions:
+            extension = keyhash_extensions[encoding]
+        else:
+            extension = lang_extensions[lang]
+        named = (lang in c_langs + ['rust', 'python'] and
+                 encoding in (None, 'c'))
+        getpub_dir(key_dir, out_dir, extension, binary, load, emit, named,
+                   as_json)
+        return
+    # Where the key came from, for the JSON and template output.
+    key_path = from_image or paths[0]
+    loaded = []
+    digest = None
+    # The output is only written once there is all of it, so a key that
+    # can't be written in the format doesn't leave an empty file.
+    buf = io.BytesIO() if binary else io.StringIO()
+    try:
+        if from_image is not None:
+            image_key, digest = load_image_key(from_image)
+            if image_key is not None:
+                loaded.append(image_key)
+            elif lang != 'keyhash' or pair or text is not None:
+                raise click.ClickException(
+                        "{} only has the SHA-{} hash of the key that "
+                        "signed it, {}, use --format keyhash to write "
+                        "it".format(from_image, len(digest) * 8,
+                                    digest.hex()))
+            elif (hash_alg not in (None, 'sha{}'.format(len(digest) * 8)) or
+                    point_prefix or rsa_encoding is not None or
+                    point_format is not None):
+                raise click.UsageError(
+                        "{} only has the SHA-{} hash of the key as sign "
+                        "wrote it, which --hash, --rsa-encoding, "
+                        "--point-format and --point-prefix can't "
+                        "change".format(from_image, len(digest) * 8))
+        for path in paths:
+            loaded.append(load_key(path, source, insecure_key_perms,
+                                   allow_weak=allow_weak_keys,
+                                   key_format=key_format, index=key_index,
+                                   pem_type=key_pem_type,
+                                   check_validity=not ignore_cert_validity))
+        key = loaded[0] if loaded else None
+        if digest is not None:
+            emit_digest(digest, 'image', buf, name, encoding or 'c', symbol,
+                        c_style)
+        elif pair:
+            header, c_code = keys.formatters.format_c_pair(
+                    *c_array(key, lang, name, symbol, point_prefix,
+                             rsa_encoding, point_format,
+                             hash_alg or 'sha256'),
+                    header=os.path.basename(c_header), style=c_style)
+        elif lang == 'c-zephyr':
+            if point_prefix:
+                raise click.UsageError("--point-prefix is only for raw output")
+            emit_zephyr_keys(loaded, buf, name, symbol, rsa_encoding,
+                             point_format, c_style)
+        elif table:
+            emit_key_table(loaded, buf, name, rsa_encoding, point_format,
+                           c_style)
+        elif text is not None:
+            emit_template(key, template, text, buf, name, symbol,
+                          rsa_encoding, point_format, key_path)
+        elif lang == 'keyhash':
+            if point_prefix:
+                raise click.UsageError("--point-prefix is only for raw output")
+            emit_keyhash(key, buf, name, hash_alg or 'sha256',
+                         encoding or 'c', symbol, rsa_encoding, point_format,
+                         c_style)
+        else:
+            emit_public(key, lang, file=buf, name=name,
+                        point_prefix=point_prefix, symbol=symbol,
+                        rsa_encoding=rsa_encoding, point_format=point_format,
+                        key_path=key_path, c_style=c_style)
+    except keys.KeyUsageError as e:
+        raise click.UsageError(e)
+    finally:
+        for k in loaded:
+            k.zeroize()
+    if pair:
+        write_output(c_header, header.encode('utf-8'))
+        write_output(c_source, c_code.encode('utf-8'))
+        return
+    data = buf.getvalue()
+    if out is None or out == '-':
+        out_file = sys.stdout.buffer if binary else sys.stdout
+        out_file.write(data)
+        out_file.flush()
+    else:
+        write_output(out, data if binary else data.encode('utf-8'))
+
+
+@click.option('-l', '--lang', '--format', 'lang', metavar='lang',
+              default='c',
+              type=click.Choice(list(keys.formatters.FORMATTERS)),
+              help='Output the key as C, Rust or Python source')
+@click.option('--insecure-key-perms', default=False, is_flag=True,
+              help='Use a key file accessible by others, with a warning')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the key passphrase from this file')
+@click.option('-k', '--key', metavar='filename', required=True,
+              help='Key file, "-" to read it from stdin, or keystore:name '
+                   'for a key in a keystore')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.option('--name', metavar='identifier', callback=validate_identifier,
+              help='Name the identifiers after this, rather than "enc"')
+@click.option('--symbol', metavar='identifier', callback=validate_identifier,
+              help='Name the array this, and its length this with _len '
+                   'added')
+@click.option('-o', '--out', metavar='filename',
+              help='Write the key to this file rather than stdout, '
+                   'replacing it in one step, readable only by its owner')
+@click.option('--unsafe', default=False, is_flag=True,
+              help='Confirm that the secret key is to be written out')
+@click.command(help='Get the private key that decrypts images, as source '
+                    'code to build into the bootloader')
+def getpriv(key, passphrase_file, insecure_key_perms, lang, non_interactive,
+            name, symbol, out, unsafe):
+    if not unsafe:
+        raise click.UsageError(
+                "getpriv writes out the secret key, give --unsafe if that "
+                "is what you want")
+    if name is not None and symbol is not None:
+        raise click.UsageError("Give either --name or --symbol, not both")
+    source = passphrase.Source(passphrase_file, not non_interactive)
+    key = load_key(key, source, insecure_key_perms)
+    try:
+        data = keys.enc_private_bytes(key)
+        ident = symbol or "{}_priv_key".format(name or 'enc')
+        code = keys.formatters.FORMATTERS[lang](data, ident)
+    except keys.KeyUsageError as e:
+        raise click.UsageError(e)
+    finally:
+        key.zeroize()
+    if out is None or out == '-':
+        print(code, end='')
+        sys.stdout.flush()
+    else:
+        write_output(out, code.encode('utf-8'), mode=0o600)
+
+
+# The formats keyconvert writes, as the private format and encoding.
+convert_formats = collections.OrderedDict([
+    ('pkcs8-pem', ('pkcs8', 'pem')),
+    ('sec1-pem', ('traditional', 'pem')),
+    ('pkcs1-pem', ('traditional', 'pem')),
+    ('der', ('pkcs8', 'der')),
+])
+
+
+@click.option('--force', default=False, is_flag=True,
+              help='Overwrite an existing output file')
+@click.option('--out-passphrase-file', metavar='filename',
+              help='Protect the output with the passphrase read from ' +
+                   'this file')
+@click.option('-p', '--password', is_flag=True,
+              help='Prompt for a password to protect the output')
+@click.option('--insecure-key-perms', default=False, is_flag=True,
+              help='Use a key file accessible by others, with a warning')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the passphrase of the input key from this file')
+@click.option('--to', 'to_format', metavar='format', required=True,
+              type=click.Choice(convert_formats),
+              help='Format to write the key in')
+@click.option('-o', '--output', metavar='filename', required=True,
+              help='File to write the key to, "-" for stdout')
+@click.option('-k', '--key', metavar='filename', required=True,
+              help='Key file, "-" to read it from stdin, or keystore:name '
+                   'for a key in a keystore')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.option('--key-format', type=click.Choice(keys.RAW_FORMATS),
+              help='Read the key file as a bare EC private scalar, as some '
+                   'provisioning tools write, rather than detecting its '
+                   'format')
+@click.command(help='Convert a private key to another format')
+def keyconvert(key, output, to_format, passphrase_file, insecure_key_perms,
+               password, out_passphrase_file, force, non_interactive,
+               key_format):
+    source = passphrase.Source(passphrase_file, not non_interactive)
+    k = load_key(key, source, insecure_key_perms, allow_weak=True,
+                 key_format=key_format)
+    if not keys.is_private(k) or isinstance(k, keys.AES):
+        raise click.UsageError("Only private asymmetric keys can be converted")
+    if to_format == 'sec1-pem' and not isinstance(k, keys.ECDSAPrivate):
+        raise click.UsageError("sec1-pem is only for EC keys")
+    if to_format == 'pkcs1-pem' and not isinstance(k, keys.RSA):
+        raise click.UsageError("pkcs1-pem is only for RSA keys")
+    if output != '-' and os.path.lexists(output) and not force:
+        raise click.UsageError(
+                "Key file {} already exists, use --force to overwrite "
+                "it".format(output))
+    if password or out_passphrase_file is not None:
+        password = get_password(out_passphrase_file,
+                                option='--out-passphrase-file')
+    else:
+        password = None
+    format, encoding = convert_formats[to_format]
+    try:
+        k.export_private(output, passwd=password, format=format,
+                         overwrite=force, encoding=encoding)
+    except (keys.KeyUsageError, keys.KeyFileExists) as e:
+        raise click.UsageError("{}".format(e))
+    finally:
+        k.zeroize()
+        if password is not None:
+            password.zeroize()
+
+
+@click.argument('file')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the key passphrase from this file')
+@click.option('-e', '--encoding', metavar='encoding', default='hex',
+              type=click.Choice(['hex', 'base64']),
+              help='Encoding of the fingerprint (defaults to hex)')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.command(help='Print the SHA-256 fingerprint of a key, or of the key '
+               'that signed an image')
+def fingerprint(file, encoding, passphrase_file, non_interactive):
+    store, _ = keystores.split_key_ref(file)
+    # Only keys are read from stdin, not images.
+    if store is not None or file == '-':
+        data = None
+    else:
+        try:
+            data = image.read_image(file)
+        except image.ImageError as e:
+            raise click.ClickException("{}: {}".format(file, e))
+    if data is not None and image.is_image(data):
+        try:
+            tlvs = image.read_tlvs(data)
+        except image.TLVError as e:
+            raise click.ClickException("{}: {}".format(file, e))
+        hashes = [v for k, v in tlvs if k == image.TLV_VALUES['KEYHASH']]
+        # Signed with --public-key-format full, the image has the key
+        # itself instead, which hashes to the same fingerprint.
+        hashes += [hashlib.sha256(v).digest() for k, v in tlvs
+                   if k == image.TLV_VALUES['PUBKEY']]
+        if not hashes:
+            raise click.ClickException("{} is not signed".format(file))
+        digest = hashes[0]
+    else:
+        # Only the public half is used, so a key file others can read
+        # just gets a warning.
+        source = passphrase.Source(passphrase_file, not non_interactive)
+        key = load_key(file, source, insecure_perms=True, allow_weak=True)
+        try:
+            digest = key.fingerprint()
+        except keys.KeyUsageError as e:
+            raise click.UsageError(e)
+    print(format_fingerprint(digest, encoding))
+
+
+def key_summary(path, source):
+    """Describe the key file for keyinfo."""
+    if path == '-':
+        raw = keys.secret.read_stdin()
+    else:
+        with open(path, 'rb') as f:
+            raw = f.read()
+    summary = collections.OrderedDict([('file', path)])
+    fmt = key_info.file_format(raw)
+    # Encrypted keys are only opened when there is a passphrase to open
+    # them with, rather than prompting for it.
+    if not fmt['encrypted'] or source.given():
+        key = load_key(path, source, insecure_perms=True,
+                       allow_weak=True, check_validity=False,
+                       raw=raw if path == '-' else None)
+        summary['type'] = keys.key_type(key)
+        summary.update(key_info.describe(key))
+    summary.update(fmt)
+    summary['headers'] = collections.OrderedDict(fmt['headers'])
+    return summary
+
+
+def print_summary(summary):
+    names = collections.OrderedDict([
+            ('file', 'File'), ('type', 'Type'), ('algorithm', 'Algorithm'),
+            ('curve', 'Curve'), ('bits', 'Bits'), ('private', 'Private'),
+            ('format', 'Format'), ('encoding', 'Encoding'),
+            ('encrypted', 'Encrypted'), ('cipher', 'Cipher'),
+            ('keyhash', 'Keyhash'), ('error', 'Error')])
+    for field, name in names.items():
+        if field not in summary:
+            continue
+        value = summary[field]
+        if isinstance(value, bool):
+            value = 'yes' if value else 'no'
+        elif value is None:
+            value = 'unknown'
+        print("{:<11}{}".format(name + ':', value))
+    for name, value in summary.get('headers', {}).items():
+        print("{:<11}{}: {}".format('Header:', name, value))
+
+
+@click.argument('paths', nargs=-1, required=True)
+@click.option('--json', 'as_json', default=False, is_flag=True,
+              help='Output the summaries as JSON')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the passphrase of encrypted keys from this file')
+@click.command(help='Describe key files, or all the files in a directory')
+def keyinfo(paths, passphrase_file, as_json):
+    files = []
+    for path in paths:
+        if os.path.isdir(path):
+            files.extend(os.path.join(path, name)
+                         for name in sorted(os.listdir(path))
+                         if os.path.isfile(os.path.join(path, name)))
+        else:
+            files.append(path)
+    # Encrypted keys are only opened with a passphrase given, so there is
+    # no prompt.
+    source = passphrase.Source(passphrase_file, interactive=False)
+    summaries = []
+    failed = False
+    for path in files:
+        try:
+            summaries.append(key_summary(path, source))
+        except (click.ClickException, OSError, ValueError,
+                keys.KeyUsageError) as e:
+            # One bad file shouldn't hide the rest of a directory.
+            if len(files) == 1:
+                raise click.ClickException("{}: {}".format(path, e))
+            message = e.format_message() if isinstance(e, click.ClickException) else str(e)
+            summaries.append(collections.OrderedDict(
+                [('file', path), ('error', message)]))
+            failed = True
+    if as_json:
+        single = len(paths) == 1 and not os.path.isdir(paths[0])
+        print(json.dumps(summaries[0] if single else summaries, indent=4))
+    else:
+        for count, summary in enumerate(summaries):
+            if count > 0:
+                print()
+            print_summary(summary)
+    if failed:
+        sys.exit(1)
+
+
+def decode_hex(ctx, param, value):
+    if value is None:
+        return None
+    try:
+        return bytes.fromhex(value)
+    except ValueError:
+        raise click.BadParameter("{} is not valid hex".format(value))
+
+
+@click.option('--force', default=False, is_flag=True,
+              help='Overwrite existing output files')
+@click.option('--out-dir', metavar='directory',
+              help='Directory for the keys derived with --devices')
+@click.option('--devices', metavar='filename',
+              help='CSV file with a device ID in its first column, to ' +
+                   'derive one key per device')
+@click.option('-o', '--output', metavar='filename',
+              help='File to write the derived key to, "-" for stdout')
+@click.option('-f', '--format', metavar='format', default='raw',
+              type=click.Choice(['raw', 'c']),
+              help='Write the key as raw bytes, or a C array ' +
+                   '(defaults to raw)')
+@click.option('-l', '--length', type=int, default=32,
+              help='Length of the derived key in bytes (defaults to 32)')
+@click.option('--salt', metavar='hex', callback=decode_hex,
+              help='HKDF salt, in hex (defaults to none)')
+@click.option('-i', '--info', default='',
+              help='HKDF info, such as the device serial number.  With ' +
+                   '--devices, this is prefixed to each device ID')
+@click.option('-k', '--key', metavar='filename', required=True,
+              help='Master key file, "-" to read it from stdin')
+@click.command(help='Derive a key from a master key with HKDF-SHA256')
+def derive(key, info, salt, length, format, output, devices, out_dir, force):
+    if (devices is None) != (out_dir is None):
+        raise click.UsageError("--devices and --out-dir must be given together")
+    if (devices is None) == (output is None):
+        raise click.UsageError("Give either --output, or --devices and --out-dir")
+    try:
+        master = derivation.read_master(key)
+        if devices is None:
+            jobs = [(info, output)]
+        else:
+            ext = '.bin' if format == 'raw' else '.c'
+            jobs = [(info + dev, os.path.join(out_dir, dev + ext))
+                    for dev in derivation.read_devices(devices)]
+            os.makedirs(out_dir, exist_ok=True)
+        for context, path in jobs:
+            data = derivation.hkdf_sha256(master, context.encode('utf-8'),
+                                          length, salt)
+            if format == 'c':
+                data = derivation.c_array(data)
+            keys.write_private(path, data, overwrite=force)
+    except derivation.DeriveError as e:
+        raise click.UsageError("{}".format(e))
+    except keys.KeyFileExists as e:
+        raise click.UsageError("{}, use --force to overwrite it".format(e))
+
+
+def validate_header_size(ctx, param, value):
+    if value is None:
+        return None
+    if not image.IMAGE_HEADER_SIZE <= value <= 0xffff:
+        raise click.BadParameter(
+                "0x{:x} can't hold the 0x{:x} byte header, or is more than "
+                "the header can give, 0xffff".format(
+                    value, image.IMAGE_HEADER_SIZE))
+    return value
+
+
+# The formats sign both reads and writes images in, those it only reads
+# them in or writes them in, and their names.
+IMAGE_FORMATS = ['bin', 'ihex', 'srec']
+INPUT_FORMATS = IMAGE_FORMATS + ['elf']
+OUTPUT_FORMATS = IMAGE_FORMATS + ['uf2']
+FORMAT_NAMES = {'bin': 'binary', 'ihex': 'Intel HEX', 'srec': 'S-record',
+                'elf': 'ELF', 'uf2': 'UF2'}
+
+# The values erased flash can have.
+ERASED_VALUES = ['0xff', '0x00']
+
+# The text an S0 record holds, after its address and before its
+# checksum.
+MAX_SREC_HEADER = srec.MAX_LENGTH - 3
+
+
+def validate_uf2_family_id(ctx, param, value):
+    if value is not None and not 0 <= value <= 0xffffffff:
+        raise click.BadParameter("{} doesn't fit the 32 bits of a UF2 "
+                                 "family ID".format(value))
+    return value
+
+
+def validate_load_addr(ctx, param, value):
+    """An address the header gives as its load address, --rom-fixed or
+    --load-addr."""
+    if value is not None and not 0 <= value <= 0xffffffff:
+        raise click.BadParameter("{} doesn't fit the 32 bits of the load "
+                                 "address of the header".format(value))
+    return value
+
+
+def validate_ram_size(ctx, param, value):
+    if value is not None and not 0 < value <= 1 << 32:
+        raise click.BadParameter("{} isn't the size of RAM in the 32 bit "
+                                 "address space".format(value))
+    return value
+
+
+# A dependency of the image, as -d gives it.
+DEPENDENCY = re.compile(r'\(\s*(\d+)\s*,\s*([^\s()]+)\s*\)\Z')
+
+
+def validate_dependencies(ctx, param, value):
+    """The (image index, SemiSemVersion) of each "(image-id, version)"
+    given."""
+    dependencies = []
+    for text in value:
+        m = DEPENDENCY.match(text.strip())
+        if m is None:
+            raise click.BadParameter(
+                    '{!r} is not "(image-id, version)"'.format(text))
+        image_id = int(m.group(1))
+        if image_id > image.MAX_IMAGE_ID:
+            raise click.BadParameter(
+                    "Image index {} is more than the DEPENDENCY TLV holds, "
+                    "{}".format(image_id, image.MAX_IMAGE_ID))
+        if image_id in (d[0] for d in dependencies):
+            raise click.BadParameter(
+                    "Image {} is given more than once".format(image_id))
+        try:
+            version = decode_version(m.group(2))
+        except ValueError as e:
+            raise click.BadParameter("{}".format(e))
+        dependencies.append((image_id, version))
+    return dependencies
+
+
+def validate_custom_tlvs(ctx, param, value):
+    """The (type, value) of each custom TLV, its value given in hex,
+    starting 0x, or else as text."""
+    tlvs = []
+    for tag, text in value:
+        kind = BasedIntParamType().convert(tag, param, ctx)
+        if kind not in image.CUSTOM_TLV_TYPES:
+            raise click.BadParameter(
+                    "TLV type {} isn't one left for custom TLVs, 0x{:x} to "
+                    "0x{:x}".format(tag, image.CUSTOM_TLV_TYPES[0],
+                                    image.CUSTOM_TLV_TYPES[-1]))
+        if kind in (t[0] for t in tlvs):
+            raise click.BadParameter(
+                    "TLV type {} is given more than once".format(tag))
+        if text[:2].lower() == '0x':
+            try:
+                data = bytes.fromhex(text[2:])
+            except ValueError:
+                raise click.BadParameter("{} is not valid hex".format(text))
+        else:
+            data = text.encode('utf-8')
+        if len(data) > 0xffff:
+            raise click.BadParameter(
+                    "The value of TLV type {} is more than the 0xffff "
+                    "bytes a TLV holds".format(tag))
+        tlvs.append((kind, data))
+    return tlvs
+
+
+def validate_boot_record(ctx, param, value):
+    if value is not None and len(value) > boot_records.MAX_SW_TYPE_LENGTH:
+        raise click.BadParameter(
+                "{} is longer than the {} characters the attestation "
+                "service keeps of the software type".format(
+                    value, boot_records.MAX_SW_TYPE_LENGTH))
+    return value
+
+
+def validate_security_counter(ctx, param, value):
+    if value is None or value == 'auto':
+        return value
+    counter = BasedIntParamType().convert(value, param, ctx)
+    if not 0 <= counter <= 0xffffffff:
+        raise click.BadParameter(
+                "{} doesn't fit the 32 bits of the SEC_CNT "
+                "TLV".format(value))
+    return counter
+
+
+def validate_version(ctx, param, value):
+    try:
+        decode_version(value)
+        return value
+    except ValueError as e:
+        raise click.BadParameter("{}".format(e))
+
+
+@click.argument('outfile', metavar='OUTFILE|-')
+@click.argument('infile', metavar='INFILE|-')
+@click.option('--force', default=False, is_flag=True,
+              help='Overwrite OUTFILE if it exists')
+@click.option('--verify/--no-verify', default=True,
+              help='Read OUTFILE back once it is written, and check it as '
+                   'the bootloader would, its hash and its signature by '
+                   'the key, deleting it if it fails.  On unless '
+                   '--no-verify is given')
 @click.option('-M', '--max-sectors', type=int,
               help='When padding allow for this amount of sectors (defaults to 128)')
 @click.option('--pad', default=False, is_flag=True,
-              help='Pad image to --slot-size bytes, adding trailer magic')
+              help='Pad image to --slot-size bytes, ending with the '
+                   'trailer magic, to be written to the secondary slot as '
+                   'an upgrade')
+@click.option('--confirm', default=False, is_flag=True,
+              help='Pad the image as --pad does, and mark it confirmed, '
+                   'with the image_ok flag of the trailer set, so the '
+                   "bootloader doesn't expect it to be tested")
+@click.option('--overwrite-only', default=False, is_flag=True,
+              help='Pad for a bootloader built to overwrite the primary '
+                   'slot rather than swap, with a trailer of the flags and '
+                   'the magic alone, without the swap status area')
+@click.option('--no-size-check', default=False, is_flag=True,
+              help="Don't refuse an image that, with the trailer, doesn't "
+                   'fit --slot-size, for layouts with the trailer '
+                   'elsewhere.  --pad still needs the room')
 @click.option('-S', '--slot-size', type=BasedIntParamType(), required=True,
               help='Size of the slot where the image will be written')
 @click.option('--included-header', default=False, is_flag=True,
-              help='Image has gap for header')
-@click.option('-H', '--header-size', type=BasedIntParamType(), required=True)
-@click.option('-v', '--version', callback=validate_version,  required=True)
-@click.option('--align', type=click.Choice(['1', '2', '4', '8']),
-              required=True)
-@click.option('-k', '--key', metavar='filename')
+              help='Image has gap for header, the default')
+@click.option('--pad-header', default=False, is_flag=True,
+              help='Add --header-size bytes of --erased-val to the start '
+                   "of the image for the header, when it wasn't linked with "
+                   'room for it')
+@click.option('--input-format', type=click.Choice(INPUT_FORMATS),
+              help='Read the image as binary, Intel HEX, S-records or ELF, '
+                   'rather than by the extension of its name, .hex for '
+                   'Intel HEX, .srec, .s19, .s28, .s37 or .mot for '
+                   'S-records, and .elf or .axf for ELF')
+@click.option('--force-raw', default=False, is_flag=True,
+              help='Sign an image that starts with the image magic as it '
+                   'is, rather than as a signed image to sign again, with '
+                   'its old header and TLVs stripped')
+@click.option('--keep-protected-tlvs', default=False, is_flag=True,
+              help='Keep the custom protected TLVs of a signed image '
+                   'signed again, but for those --custom-tlv-protected '
+                   'gives anew')
+@click.option('--fill-gaps', default=False, is_flag=True,
+              help='Fill the gaps between the regions of an Intel HEX, '
+                   'S-record or ELF image with erased bytes, rather than '
+                   'refusing it')
+@click.option('--erased-val', type=click.Choice(ERASED_VALUES),
+              default='0xff',
+              help='Value of erased flash, which fills the room --pad-header '
+                   'adds, the padding and trailer --pad adds, and gaps '
+                   '--fill-gaps fills, 0xff unless given')
+@click.option('--endian', type=click.Choice(list(image.ENDIANS)),
+              default='little',
+              help='Byte order of the header and the TLVs, that of the '
+                   'target the bootloader runs on, little unless given')
+@click.option('--output-format', type=click.Choice(OUTPUT_FORMATS),
+              help='Write the signed image as binary, Intel HEX, S-records '
+                   'or UF2, rather than by the extension of its name, as '
+                   'for --input-format, and .uf2 for UF2, or as the image '
+                   'was read, for stdout')
+@click.option('--hex-addr', type=BasedIntParamType(),
+              help='Address of the start of the Intel HEX, S-record or UF2 '
+                   'output, that of the slot, by default where the image '
+                   'read starts, less the header --pad-header adds')
+@click.option('--rom-fixed', type=BasedIntParamType(),
+              callback=validate_load_addr,
+              help='Address in flash the image was linked to run from, for '
+                   'the bootloader to boot it from that slot alone, '
+                   'without swapping it, and the address of the Intel HEX, '
+                   'S-record or UF2 output')
+@click.option('--load-addr', type=BasedIntParamType(),
+              callback=validate_load_addr,
+              help='Address in RAM the image was linked to run from, for '
+                   'the bootloader to copy it there, header and TLVs '
+                   'included, before running it')
+@click.option('--ram-start', type=BasedIntParamType(), default='0',
+              callback=validate_load_addr,
+              help='Start of the RAM that --ram-size gives the size of, 0 '
+                   'unless given')
+@click.option('--ram-size', type=BasedIntParamType(),
+              callback=validate_ram_size,
+              help='Size of the RAM the bootloader loads images into, for '
+                   '--load-addr to be refused if the image falls outside it')
+@click.option('--set-flag', 'set_flags', multiple=True,
+              type=click.Choice(list(image.IMAGE_F)),
+              help='Set this flag in the header, for test images and '
+                   'special boot modes.  RAM_LOAD needs --load-addr, and '
+                   'ROM_FIXED --rom-fixed.  Given once for each flag')
+@click.option('--srec-header', metavar='TEXT',
+              help='Start the S-record output with an S0 record of this '
+                   'text, which it has none of unless given')
+@click.option('--uf2-family-id', type=BasedIntParamType(),
+              callback=validate_uf2_family_id,
+              help='Family ID of the UF2 blocks, for a UF2 bootloader to '
+                   'refuse those of other devices')
+@click.option('--uf2-skip-padding', default=False, is_flag=True,
+              help='Leave the blocks of nothing but the padding --pad adds '
+                   'out of the UF2 output, to keep it small')
+@click.option('-H', '--header-size', type=BasedIntParamType(), required=True,
+              callback=validate_header_size,
+              help='Size of the room for the header at the start of the '
+                   'image, which the header records, such as 0x200 where '
+                   'the vector table has to be aligned')
+@click.option('-v', '--version', callback=validate_version,  required=True,
+              help='Version of the image, major.minor.revision+build, the '
+                   'later parts 0 when left out')
+@click.option('--align',
+              type=click.Choice([str(n) for n in image.WRITE_SIZES]),
+              required=True,
+              help='Size flash is written in, at most --max-align')
+@click.option('--max-align',
+              type=click.Choice([str(n) for n in image.MAX_ALIGNS]),
+              default=str(image.BOOT_MAX_ALIGN),
+              help="The bootloader's MAX_FLASH_ALIGN, the room each flag "
+                   'of the trailer --pad adds has, 8 unless given, and 16 '
+                   'or 32 for flash written 16 or 32 bytes at a time')
+@click.option('--custom-tlv-protected', metavar='TYPE VALUE', nargs=2,
+              multiple=True, callback=validate_custom_tlvs,
+              help='Add a protected TLV of this type, 0xa0 to 0xff, with '
+                   'this value, in hex if it starts 0x, or else as text, '
+                   'covered by the signature.  Given once for each TLV')
+@click.option('-s', '--security-counter', metavar='N|auto',
+              callback=validate_security_counter,
+              help='Security counter of the image, for rollback '
+                   'protection, or auto to take it from --version, as '
+                   'major << 24 | minor << 16 | revision')
+@click.option('--boot-record', metavar='SW_TYPE',
+              callback=validate_boot_record,
+              help='Add a protected BOOT_RECORD TLV, the CBOR record the '
+                   'TF-M attestation service reports the image by, of this '
+                   'software type, such as SPE or NSPE, at most 12 '
+                   'characters.  Needs a key, for the signer ID')
+@click.option('-d', '--dependencies', metavar='"(image-id, version)"',
+              multiple=True, callback=validate_dependencies,
+              help='Image this one needs, at this version or later, for '
+                   'the bootloader of a product of several images to '
+                   'check.  Given once for each image')
+@click.option('--public-key-format', type=click.Choice(['hash', 'full']),
+              default='hash',
+              help='Name the key in a KEYHASH TLV, the hash of it, the '
+                   'default, or give all of it, in a PUBKEY TLV, for a '
+                   'bootloader that looks it up in its own storage')
+@click.option('--keyhash-alg', type=click.Choice(keyhash_algorithms),
+              help='Hash of the public key in the KEYHASH TLV, sha256 '
+                   'unless given')
+@click.option('--sha', type=click.Choice(['auto'] + list(image.IMAGE_HASHES)),
+              default='auto',
+              help='Hash of the image, SHA256, SHA384 or SHA512, auto for '
+                   'the one the key signs by default: SHA384 for a P-384 '
+                   'key, and SHA256 for the others.  P-256 and Ed25519 '
+                   'keys can also sign SHA512')
+@click.option('--deterministic', default=False, is_flag=True,
+              help='Sign so the same image, key and options always give '
+                   'the same bytes, with RFC 6979 ECDSA signatures, and the '
+                   'TLVs in the order of their types.  Refused for RSA '
+                   'keys, whose PSS salt is random')
+@click.option('--rsa-pkcs1-15', default=False, is_flag=True,
+              help='Refused: the bootloader only verifies RSA-PSS '
+                   'signatures, not PKCS#1 v1.5 ones')
+@click.option('--allow-weak-keys', default=False, is_flag=True,
+              help='Allow signing with a key below the minimum strength')
+@click.option('--insecure-key-perms', default=False, is_flag=True,
+              help='Use a key file accessible by others, with a warning')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the key passphrase from this file')
+@click.option('-k', '--key', metavar='filename',
+              help='Key file, "-" to read it from stdin, keystore:name '
+                   'for a key in a keystore, or agent:name for a key in '
+                   'ssh-agent')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.option('--key-format', type=click.Choice(keys.RAW_FORMATS),
+              help='Read the key file as a bare EC private scalar, as some '
+                   'provisioning tools write, rather than detecting its '
+                   'format')
+@click.option('--key-pem-type', metavar='type',
+              type=click.Choice(keys.PRIVATE_TYPES + keys.PUBLIC_TYPES),
+              help='Use the key in the PEM block of this type, of a key '
+                   'file holding several')
+@click.option('--key-index', type=click.IntRange(min=0),
+              help='Use this key, counting from 0, of a PEM key file '
+                   'holding several')
 @click.command(help='Create a signed or unsigned image')
-def sign(key, align, version, header_size, included_header, slot_size, pad,
-         max_sectors, infile, outfile):
-    img = image.Image.load(infile, version=decode_version(version),
-                           header_size=header_size,
-                           included_header=included_header, pad=pad,
-                           align=int(align), slot_size=slot_size,
-                           max_sectors=max_sectors)
-    key = load_key(key) if key else None
-    img.sign(key)
+def sign(key, passphrase_file, insecure_key_perms, allow_weak_keys,
+         non_interactive, key_format, key_index, key_pem_type, align, version,
+         header_size, input_format, output_format, hex_addr, rom_fixed,
+         load_addr, ram_start, ram_size, set_flags, srec_header, uf2_family_id,
+         uf2_skip_padding, force_raw, keep_protected_tlvs, fill_gaps,
+         erased_val, endian, max_align, included_header, pad_header,
+         slot_size, pad, confirm, overwrite_only, no_size_check, max_sectors,
+         rsa_pkcs1_15, deterministic, sha, keyhash_alg, public_key_format,
+         dependencies, security_counter, boot_record, custom_tlv_protected,
+         force, verify, infile, outfile):
+    if key == '-' and infile == '-':
+        raise click.UsageError("The key and the image can't both be read "
+                               "from stdin")
+    if outfile != '-':
+        if infile != '-' and same_file(infile, outfile):
+            raise click.UsageError("{} is both the image and the output, "
+                                   "which would overwrite the image it is "
+                                   "signed from".format(outfile))
+        if os.path.lexists(outfile) and not force:
+            raise click.UsageError("Output file {} already exists, use "
+                                   "--force to overwrite it".format(outfile))
+    if rsa_pkcs1_15:
+        raise click.UsageError("The bootloader only verifies RSA-PSS "
+                               "signatures, with SHA256 and a 32 byte salt, "
+                               "so --rsa-pkcs1-15 is no longer supported")
+    if included_header and pad_header:
+        raise click.UsageError("Give either --included-header or "
+                               "--pad-header, not both")
+    if boot_record is not None and key is None:
+        raise click.UsageError("--boot-record needs a key, -k, for the "
+                               "signer ID of the record")
+    if force_raw and keep_protected_tlvs:
+        raise click.UsageError("--keep-protected-tlvs is for an image "
+                               "signed again, which --force-raw signs as it "
+                               "is")
+    if keyhash_alg is not None and public_key_format == 'full':
+        raise click.UsageError("--keyhash-alg is only for --public-key-format "
+                               "hash, a PUBKEY TLV holds the key itself")
+    input_format = input_format or image.file_format(infile)
+    if input_format not in INPUT_FORMATS:
+        raise click.UsageError("Images can't be read from {}, give "
+                               "--input-format".format(
+                                   FORMAT_NAMES[input_format]))
+    if fill_gaps and input_format == 'bin':
+        raise click.UsageError("--fill-gaps is only for Intel HEX, "
+                               "S-record and ELF images, a binary one has "
+                               "no gaps")
+    if output_format is None:
+        output_format = (input_format if outfile == '-' else
+                         image.file_format(outfile))
+    if output_format not in OUTPUT_FORMATS:
+        raise click.UsageError("The signed image can't be written as {}, "
+                               "give --output-format".format(
+                                   FORMAT_NAMES[output_format]))
+    if rom_fixed is not None and load_addr is not None:
+        raise click.UsageError("Give either --rom-fixed or --load-addr, "
+                               "not both")
+    check_flags(set_flags, load_addr, rom_fixed)
+    if ram_size is not None:
+        if load_addr is None:
+            raise click.UsageError("--ram-size is only for --load-addr, "
+                                   "the RAM it is checked against")
+        if not ram_start <= load_addr < ram_start + ram_size:
+            raise click.UsageError(
+                    "--load-addr 0x{:x} isn't in the RAM from 0x{:x} to "
+                    "0x{:x}".format(load_addr, ram_start,
+                                    ram_start + ram_size))
+    if rom_fixed is not None and hex_addr is not None and \
+            hex_addr != rom_fixed:
+        raise click.UsageError("--hex-addr 0x{:x} isn't the --rom-fixed "
+                               "0x{:x} the image was linked for".format(
+                                   hex_addr, rom_fixed))
+    if output_format != 'bin' and hex_addr is None:
+        hex_addr = rom_fixed
+    if hex_addr is not None and output_format == 'bin':
+        raise click.UsageError("--hex-addr is only for Intel HEX, S-record "
+                               "and UF2 output, give --output-format ihex, "
+                               "srec or uf2")
+    if output_format != 'bin' and hex_addr is None and input_format == 'bin':
+        raise click.UsageError("Give --hex-addr for the address of {} "
+                               "output of a binary image".format(
+                                   FORMAT_NAMES[output_format]))
+    if srec_header is not None:
+        if output_format != 'srec':
+            raise click.UsageError("--srec-header is only for S-record "
+                                   "output, give --output-format srec")
+        srec_header = srec_header.encode('utf-8')
+        if len(srec_header) > MAX_SREC_HEADER:
+            raise click.UsageError("--srec-header is {} bytes, more than the "
+                                   "{} an S0 record holds".format(
+                                       len(srec_header), MAX_SREC_HEADER))
+    if output_format != 'uf2':
+        if uf2_family_id is not None:
+            raise click.UsageError("--uf2-family-id is only for UF2 output, "
+                                   "give --output-format uf2")
+        if uf2_skip_padding:
+            raise click.UsageError("--uf2-skip-padding is only for UF2 "
+                                   "output, give --output-format uf2")
+    if overwrite_only and max_sectors is not None:
+        raise click.UsageError("--max-sectors is only for the swap status "
+                               "area of the trailer, which --overwrite-only "
+                               "leaves out")
+    if int(align) > int(max_align):
+        raise click.UsageError("--align {} is more than --max-align {}, the "
+                               "room each flag of the trailer has".format(
+                                   align, max_align))
+    if (pad or confirm) and slot_size % int(max_align) != 0:
+        raise click.UsageError("--slot-size 0x{:x} isn't a multiple of "
+                               "--max-align {}, so the trailer can't end "
+                               "the slot".format(slot_size, max_align))
+    version = decode_version(version)
+    if security_counter == 'auto':
+        security_counter = image.security_counter_from_version(version)
+    # The image is named in errors as the key is, stdin for "-".
+    name = 'stdin' if infile == '-' else infile
+    # A binary image signed as a binary is streamed, so that an image of
+    # any size can be signed in little memory, unless the key is in
+    # ssh-agent, which hashes what it signs with ECDSA keys itself, so
+    # has to be given the whole image.
+    stream = output_format == 'bin' and not (key and keys.is_agent_ref(key))
+    try:
+        img = image.Image.load(infile, version=version,
+                               header_size=header_size,
+                               pad_header=pad_header, fmt=input_format,
+                               force_raw=force_raw, stream=stream,
+                               keep_protected=keep_protected_tlvs,
+                               fill_gaps=fill_gaps,
+                               erased_val=int(erased_val, 16),
+                               max_align=int(max_align), pad=pad,
+                               align=int(align), slot_size=slot_size,
+                               max_sectors=max_sectors,
+                               overwrite_only=overwrite_only,
+                               size_check=not no_size_check,
+                               deterministic=deterministic, endian=endian,
+                               dependencies=dependencies,
+                               security_counter=security_counter,
+                               custom_protected=custom_tlv_protected,
+                               boot_record=boot_record,
+                               rom_fixed=rom_fixed, load_addr=load_addr,
+                               flags=list(set_flags),
+                               keyhash_alg=keyhash_alg or 'sha256',
+                               public_key_format=public_key_format)
+    except image.HeaderNotBlank as e:
+        raise click.ClickException(
+                "{}: {}, give --pad-header if it wasn't linked with room "
+                "for the header".format(name, e))
+    except image.ImageGaps as e:
+        raise click.ClickException(
+                "{}: {}, give --fill-gaps to fill them with erased "
+                "bytes".format(
+                    name, e))
+    except image.NotResignable as e:
+        raise click.ClickException(
+                "{}: {}, give --force-raw to sign it as it is".format(
+                    name, e))
+    except image.ImageError as e:
+        raise click.ClickException("{}: {}".format(name, e))
+    if keep_protected_tlvs and img.resigned is None:
+        raise click.ClickException(
+                "{}: --keep-protected-tlvs is for an image signed already, "
+                "to sign again, which this isn't".format(name))
+    if rom_fixed is not None and img.base_addr is not None and \
+            img.base_addr != rom_fixed:
+        raise click.ClickException(
+                "{}: The image starts at 0x{:x}, not the --rom-fixed 0x{:x} "
+                "it was linked for".format(name, img.base_addr, rom_fixed))
+    source = passphrase.Source(passphrase_file, not non_interactive)
+    key = load_key(key, source, insecure_key_perms,
+                   allow_weak=allow_weak_keys, key_format=key_format,
+                   index=key_index, pem_type=key_pem_type) if key else None
+    try:
+        img.sha = image_sha(key, sha)
+        img.sign(key)
+        # The public half checks the signature once the key is zeroized.
+        public = keys.public_key(key) if key is not None else None
+    except keys.KeyUsageError as e:
+        raise click.UsageError(e)
+    except image.ImageError as e:
+        raise click.ClickException("{}: {}".format(name, e))
+    finally:
+        if key is not None:
+            key.zeroize()
+
+    # The bootloader copies all of the signed image, up to the end of
+    # its TLVs, to RAM.
+    if ram_size is not None and \
+            load_addr + img.length() > ram_start + ram_size:
+        raise click.ClickException(
+                "{}: The signed image is 0x{:x} bytes, which at --load-addr "
+                "0x{:x} runs past the end of the RAM, at 0x{:x}".format(
+                    name, img.length(), load_addr,
+                    ram_start + ram_size))
+
+    if pad or confirm:
+        try:
+            img.pad_to(slot_size, confirm)
+        except image.ImageError as e:
+            raise click.ClickException("{}: {}".format(name, e))
+
+    try:
+        img.save(outfile, output_format, hex_addr, srec_header,
+                 uf2_family_id, uf2_skip_padding)
+    except image.ImageError as e:
+        raise click.ClickException("{}: {}".format(name, e))
+
+    # What is written to stdout can't be read back.
+    if verify and outfile != '-':
+        verify_output(outfile, output_format, public, img.erased_val)
+
+
+def verify_output(path, fmt, key, erased_val):
+    """Read the signed image back from path, where sign wrote it as
+    fmt, and check it as the bootloader would, with key, the public key
+    it was signed by, or None if it is unsigned.  An image that fails is
+    deleted, so it can't be flashed by mistake."""
+    try:
+        if fmt == 'bin':
+            # Mapped rather than read, as a streamed image may be large.
+            with open(path, 'rb') as f, mmap.mmap(
+                    f.fileno(), 0, access=mmap.ACCESS_READ) as data:
+                image.verify_image(data, key)
+        else:
+            image.verify_image(image.read_image(path, fmt, erased_val), key)
+        return
+    except OSError as e:
+        problem = e.strerror
+    except (image.ImageError, image.TLVError) as e:
+        problem = str(e)
+    try:
+        os.unlink(path)
+    except OSError:
+        pass
+    raise click.ClickException(
+            "{}: The signed image doesn't verify, so it was deleted: "
+            "{}".format(path, problem))
+
+
+def check_flags(flags, load_addr, rom_fixed):
+    """Refuse header flags, as --set-flag gives them, that don't go
+    together, or with the other options."""
+    for name in set(flags):
+        if flags.count(name) > 1:
+            raise click.UsageError("--set-flag {} is given more than "
+                                   "once".format(name))
+    if 'RAM_LOAD' in flags and load_addr is None:
+        raise click.UsageError("--set-flag RAM_LOAD needs --load-addr, the "
+                               "address in RAM the header gives")
+    if 'ROM_FIXED' in flags and rom_fixed is None:
+        raise click.UsageError("--set-flag ROM_FIXED needs --rom-fixed, the "
+                               "address in flash the header gives")
+    if 'COMPRESSED_LZMA1' in flags and 'COMPRESSED_LZMA2' in flags:
+        raise click.UsageError("Set either COMPRESSED_LZMA1 or "
+                               "COMPRESSED_LZMA2, not both")
+    if 'COMPRESSED_ARM_THUMB_FLT' in flags and \
+            'COMPRESSED_LZMA2' not in flags:
+        raise click.UsageError("COMPRESSED_ARM_THUMB_FLT is only for "
+                               "COMPRESSED_LZMA2, set it too")
+
+
+def image_sha(key, sha):
+    """The hash of the image to sign with the key, as --sha gives it,
+    which has to be the one the bootloader expects the key to sign."""
+    if key is None:
+        return '256' if sha == 'auto' else sha
+    # A key that can't sign images says so, before its hash is asked.
+    key.sig_tlv()
+    wanted = key.sig_hashes()
+    if sha == 'auto':
+        return wanted[0]
+    if sha not in wanted:
+        raise click.UsageError(
+                "The {} key signs the {} hash of the image, so it can't "
+                "be used with --sha {}".format(
+                    keys.key_type(key),
+                    " or ".join("SHA" + w for w in wanted), sha))
+    return sha
+
+
+def pubkey_type(der):
+    """The keygen type of the key in a PUBKEY TLV, or None if it isn't
+    one imgtool can read."""
+    try:
+        key = keys.load_bytes(der)
+    except keys.KeyUsageError:
+        return None
+    if key is None or keys.is_private(key):
+        return None
+    return keys.key_type(key)
+
+
+def image_summary(path, erased_val=0xff, max_align=image.BOOT_MAX_ALIGN):
+    """What dumpinfo prints about the signed image at path: its header,
+    with the version as sign takes it, the type and length of each of
+    its TLVs, with what those the bootloader checks hold, and the flags
+    of its trailer, if it is padded, for flash that erases to
+    erased_val, and a bootloader with this MAX_FLASH_ALIGN.  The byte
+    order of the image is found from the magic of its header."""
+    try:
+        data = image.read_image(path)
+    except OSError as e:
+        raise click.ClickException("Can't read {}: {}".format(
+            path, e.strerror))
+    except image.ImageError as e:
+        raise click.ClickException("{}: {}".format(path, e))
+    names = dict((v, k) for k, v in image.TLV_VALUES.items())
+    try:
+        header = image.read_header(data)
+        protected, tlvs = image.read_tlv_areas(data)
+        image_hash = next((names[k] for k, v in tlvs
+                           if names.get(k) in image.IMAGE_HASHES.values()),
+                          None)
+        entries = []
+        for kind, value in protected + tlvs:
+            entry = collections.OrderedDict([
+                    ('type', kind), ('name', names.get(kind)),
+                    ('length', len(value)),
+                    ('protected', len(entries) < len(protected))])
+            if kind == image.TLV_VALUES['SEC_CNT']:
+                entry['security_counter'] = image.decode_security_counter(
+                        value, header.endian)
+            elif kind == image.TLV_VALUES['DEPENDENCY']:
+                image_id, version = image.decode_dependency(value,
+                                                            header.endian)
+                entry['image_id'] = image_id
+                entry['version'] = format_version(version)
+            elif kind == image.TLV_VALUES['BOOT_RECORD']:
+                entry['boot_record'] = image.decode_boot_record(value)
+            elif kind in image.CUSTOM_TLV_TYPES:
+                entry['value'] = value.hex()
+            elif names.get(kind) == 'ECDSASIG':
+                entry['algorithm'] = image.ECDSASIG_ALGORITHMS.get(
+                        image_hash, 'ECDSA')
+            elif kind == image.TLV_VALUES['PUBKEY']:
+                entry['key_type'] = pubkey_type(value)
+            elif names.get(kind) in image.SIG_ALGORITHMS:
+                entry['algorithm'] = image.SIG_ALGORITHMS[names[kind]]
+            entries.append(entry)
+    except image.TLVError as e:
+        raise click.ClickException("{}: {}".format(path, e))
+    # How the image gives the key that signed it, if it is signed.
+    kinds = [k for k, v in tlvs]
+    if image.TLV_VALUES['PUBKEY'] in kinds:
+        public_key = 'full'
+    elif image.TLV_VALUES['KEYHASH'] in kinds:
+        public_key = 'hash'
+    else:
+        public_key = None
+    return collections.OrderedDict([
+            ('file', path),
+            ('version', format_version(header.version)),
+            ('endian', header.endian),
+            ('header_size', header.hdr_size),
+            ('image_size', header.img_size),
+            ('protected_tlv_size', header.protect_tlv_size),
+            ('load_addr', header.load_addr),
+            ('flags', header.flags),
+            ('flag_names', image.flag_names(header.flags)),
+            ('rom_fixed', header.load_addr
+                          if header.flags & image.IMAGE_F['ROM_FIXED']
+                          else None),
+            ('ram_load', header.load_addr
+                         if header.flags & image.IMAGE_F['RAM_LOAD']
+                         else None),
+            ('public_key', public_key),
+            ('tlvs', entries),
+            ('trailer', image.read_trailer(data, erased_val, max_align,
+                                           header.endian))])
+
+
+@click.argument('file')
+@click.option('--erased-val', type=click.Choice(ERASED_VALUES),
+              default='0xff',
+              help='Value of erased flash, which the trailer flags that '
+                   "aren't set have")
+@click.option('--max-align',
+              type=click.Choice([str(n) for n in image.MAX_ALIGNS]),
+              default=str(image.BOOT_MAX_ALIGN),
+              help='The room each flag of the trailer has, as sign '
+                   '--max-align gives it')
+@click.option('--json', 'as_json', default=False, is_flag=True,
+              help='Output the header and TLVs as JSON')
+@click.command(help='Print the header, TLVs and trailer of a signed image')
+def dumpinfo(file, as_json, erased_val, max_align):
+    summary = image_summary(file, int(erased_val, 16), int(max_align))
+    if as_json:
+        print(json.dumps(summary, indent=4))
+        return
+    print("{:<11}{}".format('File:', summary['file']))
+    print("{:<11}{}".format('Version:', summary['version']))
+    print("{:<11}{}-endian".format('Endian:', summary['endian']))
+    print("{:<11}0x{:x} bytes".format('Header:', summary['header_size']))
+    print("{:<11}0x{:x} bytes".format('Image:', summary['image_size']))
+    print("{:<11}0x{:08x}".format('Load addr:', summary['load_addr']))
+    line = "{:<11}0x{:08x}".format('Flags:', summary['flags'])
+    if summary['flag_names']:
+        line += ": {}".format(", ".join(summary['flag_names']))
+    print(line)
+    if summary['rom_fixed'] is not None:
+        print("{:<11}0x{:08x}".format('ROM fixed:', summary['rom_fixed']))
+    if summary['ram_load'] is not None:
+        print("{:<11}0x{:08x}".format('RAM load:', summary['ram_load']))
+    print("{:<11}{}".format('Key:', {
+            'full': 'full, in the PUBKEY TLV',
+            'hash': 'hash, in the KEYHASH TLV',
+            None: 'none, unsigned'}[summary['public_key']]))
+    for tlv in summary['tlvs']:
+        line = "{:<11}{} (0x{:02x}), {} bytes".format(
+                'TLV:', tlv['name'] or 'unknown', tlv['type'], tlv['length'])
+        if tlv['protected']:
+            line += ", protected"
+        if 'security_counter' in tlv:
+            line += ": {}".format(tlv['security_counter'])
+        elif 'image_id' in tlv:
+            line += ": image {}, version {} or later".format(
+                    tlv['image_id'], tlv['version'])
+        elif 'value' in tlv:
+            line += ": {}".format(tlv['value'])
+        elif 'algorithm' in tlv:
+            line += ": {}".format(tlv['algorithm'])
+        elif tlv.get('key_type'):
+            line += ": {}".format(tlv['key_type'])
+        print(line)
+        # The boot record is a map, each field on a line of its own.
+        for name, value in tlv.get('boot_record', {}).items():
+            print("{:<11}  {}: {}".format('', name, value))
+    trailer = summary['trailer']
+    if trailer is None:
+        print("{:<11}none, not padded".format('Trailer:'))
+    else:
+        print("{:<11}copy_done {}, image_ok {}".format(
+                'Trailer:', trailer['copy_done'], trailer['image_ok']))
+
+
+@click.group(name='keystore', help='Manage keystores of named keys')
+def keystore():
+    pass
+
+
+@click.argument('name')
+@click.argument('store')
+@click.option('--allow-deprecated', default=False, is_flag=True,
+              help='Allow generating deprecated key types')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the keystore passphrase from this file')
+@click.option('-k', '--key', metavar='filename',
+              help='Key file to add to the keystore, "-" to read it from '
+                   'stdin')
+@click.option('-t', '--type', metavar='type',
+              type=click.Choice(keygens.keys()),
+              help='Type of key to generate and add, see the keytypes command')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.command(name='add', help='Add a key to a keystore, creating the '
+               'keystore if needed')
+def keystore_add(type, key, passphrase_file, allow_deprecated, non_interactive,
+                 store, name):
+    if (type is None) == (key is None):
+        raise click.UsageError("Give either --type or --key")
+    if type is not None:
+        if keygens[type].deprecated and not allow_deprecated:
+            raise click.UsageError(
+                    "The {} key type is deprecated, use --allow-deprecated "
+                    "to generate it anyway".format(type))
+        k = keygens[type].generate()
+    else:
+        # An encrypted key has its own passphrase, not the keystore's.
+        k = load_key(key, passphrase.Source(interactive=not non_interactive),
+                     allow_weak=True)
+    ks = open_keystore(store,
+                       passphrase.Source(passphrase_file, not non_interactive),
+                       create=True)
+    try:
+        ks.add(name, k)
+    except keystores.KeystoreError as e:
+        raise click.ClickException("{}".format(e))
+    ks.save()
+
+
+@click.argument('name')
+@click.argument('store')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the keystore passphrase from this file')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.command(name='remove', help='Remove a key from a keystore')
+def keystore_remove(passphrase_file, non_interactive, store, name):
+    ks = open_keystore(store,
+                       passphrase.Source(passphrase_file, not non_interactive))
+    try:
+        ks.remove(name)
+    except keystores.KeystoreError as e:
+        raise click.ClickException("{}".format(e))
+    ks.save()
+
+
+@click.argument('store')
+@click.option('--passphrase-file', metavar='filename',
+              help='Read the keystore passphrase from this file')
+@click.option('--non-interactive', default=False, is_flag=True,
+              help='Never prompt for a passphrase, fail instead')
+@click.command(name='list', help='List the keys in a keystore')
+def keystore_list(passphrase_file, non_interactive, store):
+    ks = open_keystore(store,
+                       passphrase.Source(passphrase_file, not non_interactive))
+    names = ks.names()
+    row = "{{:<{}}} {{:<16}} {{}}".format(max([4] + [len(n) for n in names]))
+    print(row.format("NAME", "TYPE", "CREATED"))
+    for name in names:
+        print(row.format(name, *ks.info(name)))
 
-    if pad:
-        img.pad_to(slot_size)
 
-    img.save(outfile)
+keystore.add_command(keystore_add)
+keystore.add_command(keystore_remove)
+keystore.add_command(keystore_list)
 
 
 class AliasesGroup(click.Group):
@@ -171,8 +2423,16 @@ def imgtool():
 
 
 imgtool.add_command(keygen)
+imgtool.add_command(keytypes)
+imgtool.add_command(keystore)
+imgtool.add_command(derive)
+imgtool.add_command(fingerprint)
+imgtool.add_command(keyinfo)
+imgtool.add_command(keyconvert)
 imgtool.add_command(getpub)
+imgtool.add_command(getpriv)
 imgtool.add_command(sign)
+imgtool.add_command(dumpinfo)
 
 
 if __name__ == '__main__':
@@ -0,0 +1,160 @@
+# Copyright 2019 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+Boot records, the CBOR map describing a software component that the
+bootloader hands on to the TF-M initial attestation service.
+"""
+
+from collections import OrderedDict
+
+# The keys of the software component map, as the attestation service
+# gives them.
+SW_COMPONENT_TYPE = 1
+MEASUREMENT_VALUE = 2
+SW_COMPONENT_VERSION = 4
+SIGNER_ID = 5
+MEASUREMENT_DESCRIPTION = 6
+
+KEY_NAMES = OrderedDict([
+    (SW_COMPONENT_TYPE, 'sw_type'),
+    (SW_COMPONENT_VERSION, 'version'),
+    (SIGNER_ID, 'signer_id'),
+    (MEASUREMENT_DESCRIPTION, 'measurement_description'),
+    (MEASUREMENT_VALUE, 'measurement_value'),
+])
+
+# The attestation service keeps at most this many characters of the
+# type.
+MAX_SW_TYPE_LENGTH = 12
+
+# The major types of CBOR that a boot record uses.
+MAJOR_UINT = 0
+MAJOR_BYTES = 2
+MAJOR_TEXT = 3
+MAJOR_MAP = 5
+
+class BootRecordError(Exception):
+    pass
+
+def _head(major, value):
+    """The head of a CBOR data item, its major type and the argument,
+    in the fewest bytes that hold it."""
+    if value < 24:
+        return bytes([major << 5 | value])
+    for info, size in ((24, 1), (25, 2), (26, 4), (27, 8)):
+        if value < 1 << (8 * size):
+            return bytes([major << 5 | info]) + value.to_bytes(size, 'big')
+    raise BootRecordError("0x{:x} is too big for CBOR".format(value))
+
+def encode(value):
+    """The CBOR encoding of value, an unsigned int, str, bytes, or a
+    dict of them, its entries in the order the dict gives them."""
+    if isinstance(value, bool):
+        raise BootRecordError("booleans aren't used in boot records")
+    if isinstance(value, int):
+        if value < 0:
+            raise BootRecordError("negative ints aren't used in boot records")
+        return _head(MAJOR_UINT, value)
+    if isinstance(value, (bytes, bytearray)):
+        return _head(MAJOR_BYTES, len(value)) + bytes(value)
+    if isinstance(value, str):
+        raw = value.encode('utf-8')
+        return _head(MAJOR_TEXT, len(raw)) + raw
+    if isinstance(value, dict):
+        return _head(MAJOR_MAP, len(value)) + b''.join(
+                encode(k) + encode(v) for k, v in value.items())
+    raise BootRecordError("{} isn't used in boot records".format(
+            type(value).__name__))
+
+def _decode(data, off):
+    """The value of the CBOR data item at off in data, and the offset
+    just past it."""
+    if off >= len(data):
+        raise BootRecordError("the CBOR is cut short")
+    major, info = data[off] >> 5, data[off] & 0x1f
+    off += 1
+    if info < 24:
+        value = info
+    elif info <= 27:
+        size = 1 << (info - 24)
+        if off + size > len(data):
+            raise BootRecordError("the CBOR is cut short")
+        value = int.from_bytes(data[off:off + size], 'big')
+        off += size
+    else:
+        raise BootRecordError("indefinite lengths aren't used in boot "
+                              "records")
+    if major == MAJOR_UINT:
+        return value, off
+    if major in (MAJOR_BYTES, MAJOR_TEXT):
+        if off + value > len(data):
+            raise BootRecordError("the CBOR is cut short")
+        raw = bytes(data[off:off + value])
+        if major == MAJOR_TEXT:
+            try:
+                raw = raw.decode('utf-8')
+            except UnicodeDecodeError:
+                raise BootRecordError("a CBOR text string isn't UTF-8")
+        return raw, off + value
+    if major == MAJOR_MAP:
+        result = OrderedDict()
+        for _ in range(value):
+            k, off = _decode(data, off)
+            v, off = _decode(data, off)
+            result[k] = v
+        return result, off
+    raise BootRecordError("CBOR major type {} isn't used in boot "
+                          "records".format(major))
+
+def decode(data):
+    """The value of the CBOR data item that is the whole of data."""
+    value, off = _decode(data, 0)
+    if off != len(data):
+        raise BootRecordError("0x{:x} bytes follow the CBOR".format(
+                len(data) - off))
+    return value
+
+def create(sw_type, version, signer_id, description, measurement_size):
+    """The boot record of a software component of sw_type and version,
+    its major.minor.revision string, signed by the key that signer_id is
+    the hash of.  The measurement, the image hash described by
+    description, isn't known until the record itself is hashed, so it
+    is left as measurement_size zero bytes, last in the record, for the
+    bootloader to fill in from the hash TLV."""
+    if len(sw_type) > MAX_SW_TYPE_LENGTH:
+        raise BootRecordError(
+                "The software type '{}' is longer than the {} characters "
+                "the attestation service keeps".format(
+                    sw_type, MAX_SW_TYPE_LENGTH))
+    return encode(OrderedDict([
+        (SW_COMPONENT_TYPE, sw_type),
+        (SW_COMPONENT_VERSION, version),
+        (SIGNER_ID, bytes(signer_id)),
+        (MEASUREMENT_DESCRIPTION, description),
+        (MEASUREMENT_VALUE, bytes(measurement_size)),
+    ]))
+
+def parse(data):
+    """The fields of the boot record data, by name, in the order
+    KEY_NAMES gives them, with the bytes as hex strings."""
+    record = decode(data)
+    if not isinstance(record, dict):
+        raise BootRecordError("the boot record isn't a CBOR map")
+    fields = OrderedDict()
+    for key, name in KEY_NAMES.items():
+        if key in record:
+            value = record[key]
+            fields[name] = value.hex() if isinstance(value, bytes) else value
+    return fields
@@ -0,0 +1,73 @@
+"""
+Tests for boot records
+"""
+
+import os.path
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import boot_record
+
+class CBOR(unittest.TestCase):
+
+    def test_examples(self):
+        """The examples of RFC 8949, appendix A, that boot records use."""
+        for value, encoded in [
+                (0, '00'),
+                (23, '17'),
+                (24, '1818'),
+                (100, '1864'),
+                (1000, '1903e8'),
+                (1000000, '1a000f4240'),
+                (1000000000000, '1b000000e8d4a51000'),
+                (b'', '40'),
+                (b'\x01\x02\x03\x04', '4401020304'),
+                ('', '60'),
+                ('a', '6161'),
+                ('IETF', '6449455446'),
+                ('ü', '62c3bc'),
+                ({}, 'a0'),
+                ({1: 2, 3: 4}, 'a201020304')]:
+            self.assertEqual(boot_record.encode(value).hex(), encoded, value)
+            self.assertEqual(boot_record.decode(bytes.fromhex(encoded)),
+                             value)
+
+    def test_refused(self):
+        for value in [-1, True, 1.5, [1], 1 << 64]:
+            with self.assertRaises(boot_record.BootRecordError):
+                boot_record.encode(value)
+        for encoded in ['18', '5f', '4401', '9f', 'a101', '0000', '62c3']:
+            with self.assertRaises(boot_record.BootRecordError):
+                boot_record.decode(bytes.fromhex(encoded))
+
+class Records(unittest.TestCase):
+
+    def test_create(self):
+        data = boot_record.create('SPE', '1.2.3', b'\xaa' * 32, 'SHA256', 32)
+        self.assertEqual(
+                data.hex(),
+                'a5' + '0163535045' + '0465312e322e33' +
+                '055820' + 'aa' * 32 + '0666534841323536' +
+                '025820' + '00' * 32)
+        self.assertEqual(boot_record.parse(data), {
+                'sw_type': 'SPE',
+                'version': '1.2.3',
+                'signer_id': 'aa' * 32,
+                'measurement_description': 'SHA256',
+                'measurement_value': '00' * 32})
+        self.assertEqual(list(boot_record.parse(data)),
+                         list(boot_record.KEY_NAMES.values()))
+
+    def test_sw_type(self):
+        boot_record.create('A' * 12, '0.0.0', b'', 'SHA256', 32)
+        with self.assertRaises(boot_record.BootRecordError):
+            boot_record.create('A' * 13, '0.0.0', b'', 'SHA256', 32)
+
+    def test_not_a_map(self):
+        with self.assertRaises(boot_record.BootRecordError):
+            boot_record.parse(bytes.fromhex('01'))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,83 @@
+# Copyright 2019 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+Derivation of per-device keys from a master secret, with HKDF-SHA256
+(RFC 5869).
+"""
+
+import csv
+import re
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.hashes import SHA256
+from cryptography.hazmat.primitives.kdf.hkdf import HKDF
+
+from .keys.aes import pem_decode
+from .keys.formatters import format_c
+from .keys.secret import read_stdin
+
+# HKDF can give at most 255 blocks of the hash output.
+MAX_LENGTH = 255 * 32
+
+# Device IDs become file names, so keep them to something safe.
+DEVICE_ID = re.compile(r'^[A-Za-z0-9][A-Za-z0-9._-]*$')
+
+class DeriveError(Exception):
+    pass
+
+def hkdf_sha256(secret, info, length, salt=None):
+    """Derive length bytes from the secret."""
+    if not 0 < length <= MAX_LENGTH:
+        raise DeriveError("Derived key length must be from 1 to {} bytes".format(
+            MAX_LENGTH))
+    return HKDF(algorithm=SHA256(), length=length, salt=salt, info=info,
+                backend=default_backend()).derive(secret)
+
+def read_master(path):
+    """Read the master secret, either an AES key file as keygen writes,
+    or raw bytes.  A path of "-" reads it from stdin."""
+    if path == '-':
+        with read_stdin() as buf:
+            raw = bytes(buf)
+    else:
+        with open(path, 'rb') as f:
+            raw = f.read()
+    secret = pem_decode(raw)
+    if secret is None:
+        secret = raw
+    if not secret:
+        raise DeriveError("Master key file {} is empty".format(path))
+    return secret
+
+def read_devices(path):
+    """Read the device IDs from the first column of a CSV file.  Rows
+    that are empty, or start with "#", are skipped."""
+    with open(path, newline='') as f:
+        rows = list(csv.reader(f))
+    devices = []
+    for row in rows:
+        if not row or not row[0].strip() or row[0].startswith('#'):
+            continue
+        dev = row[0].strip()
+        if not DEVICE_ID.match(dev):
+            raise DeriveError("Invalid device ID: {!r}".format(dev))
+        devices.append(dev)
+    if len(set(devices)) != len(devices):
+        raise DeriveError("Duplicate device IDs in {}".format(path))
+    return devices
+
+def c_array(data, name='derived_key'):
+    """Format the key as C source."""
+    return format_c(data, name).encode('utf-8')
@@ -0,0 +1,87 @@
+"""
+Tests for key derivation
+"""
+
+import os.path
+import sys
+import tempfile
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool.derive import (DeriveError, c_array, hkdf_sha256, read_devices,
+                            read_master)
+from imgtool import keys
+
+# The SHA-256 test cases from RFC 5869, appendix A, as (IKM, salt,
+# info, L, OKM).
+RFC5869 = [
+        (bytes([0x0b] * 22),
+         bytes(range(0x00, 0x0d)),
+         bytes(range(0xf0, 0xfa)),
+         42,
+         '3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf'
+         '34007208d5b887185865'),
+        (bytes(range(0x00, 0x50)),
+         bytes(range(0x60, 0xb0)),
+         bytes(range(0xb0, 0x100)),
+         82,
+         'b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c'
+         '59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71'
+         'cc30c58179ec3e87c14c01d5c1f3434f1d87'),
+        (bytes([0x0b] * 22),
+         b'',
+         b'',
+         42,
+         '8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d'
+         '9d201395faa4b61a96c8'),
+]
+
+class Derive(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_rfc5869(self):
+        for ikm, salt, info, length, okm in RFC5869:
+            self.assertEqual(hkdf_sha256(ikm, info, length, salt).hex(), okm)
+
+    def test_length(self):
+        self.assertRaises(DeriveError, hkdf_sha256, b'secret', b'', 0)
+        self.assertRaises(DeriveError, hkdf_sha256, b'secret', b'', 255 * 32 + 1)
+        self.assertEqual(len(hkdf_sha256(b'secret', b'', 255 * 32)), 255 * 32)
+
+    def test_master(self):
+        k = keys.AES.generate()
+        pem = self.tname('master.pem')
+        k.export_private(pem)
+        self.assertEqual(read_master(pem), k.key)
+        raw = self.tname('master.bin')
+        with open(raw, 'wb') as f:
+            f.write(b'any length of secret')
+        self.assertEqual(read_master(raw), b'any length of secret')
+
+    def test_devices(self):
+        path = self.tname('devices.csv')
+        with open(path, 'w') as f:
+            f.write('# serial,batch\nSN-0001,a\n\nSN-0002,b\n')
+        self.assertEqual(read_devices(path), ['SN-0001', 'SN-0002'])
+        for bad in ['../etc,a\n', 'SN-1\nSN-1\n']:
+            with open(path, 'w') as f:
+                f.write(bad)
+            self.assertRaises(DeriveError, read_devices, path)
+
+    def test_c_array(self):
+        text = c_array(bytes(range(10))).decode('utf-8')
+        self.assertIn('0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,\n'
+                      '    0x08, 0x09,\n};', text)
+        self.assertIn('derived_key_len = 10;', text)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,76 @@
+# Copyright 2019 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+The loadable segments of ELF files, as the linker writes them before
+objcopy makes a binary of them.
+"""
+
+import struct
+
+ELF_MAGIC = b'\x7fELF'
+ELFCLASS32 = 1
+ELFDATA2LSB = 1
+
+# The header after e_ident, and a program header, of a 32-bit ELF file.
+EHDR_FORMAT = '<HHIIIIIHHHHHH'
+EHDR_SIZE = 16 + struct.calcsize(EHDR_FORMAT)
+PHDR_FORMAT = '<IIIIIIII'
+PHDR_SIZE = struct.calcsize(PHDR_FORMAT)
+
+PT_LOAD = 1
+
+class ElfError(Exception):
+    pass
+
+def read(data):
+    """The (physical address, data) of each loadable segment of the
+    32-bit little-endian ELF file data, as the image holds them, in the
+    order of the program headers.  The bss of a segment, the memory past
+    the data the file gives it, is zeroed at run time rather than
+    loaded, so it is left out, and so are segments of nothing else.
+    Segments that overlap are refused."""
+    if data[:4] != ELF_MAGIC:
+        raise ElfError("not an ELF file")
+    if data[4] != ELFCLASS32 or data[5] != ELFDATA2LSB:
+        raise ElfError("a {}-bit {} ELF file, only 32-bit little-endian "
+                       "ones are supported".format(
+                           {1: 32, 2: 64}.get(data[4], '?'),
+                           {1: 'little-endian', 2: 'big-endian'}.get(
+                               data[5], 'unknown endian')))
+    if len(data) < EHDR_SIZE:
+        raise ElfError("the ELF header is cut short")
+    (_, _, _, _, phoff, _, _, _, phentsize, phnum, _, _,
+     _) = struct.unpack(EHDR_FORMAT, data[16:EHDR_SIZE])
+    if phnum and phentsize < PHDR_SIZE:
+        raise ElfError("program headers of {} bytes, not {}".format(
+                phentsize, PHDR_SIZE))
+    segments = []
+    for n in range(phnum):
+        off = phoff + n * phentsize
+        if off + PHDR_SIZE > len(data):
+            raise ElfError("program header {} is past the end of the "
+                           "file".format(n))
+        (p_type, p_offset, _, p_paddr, p_filesz, _, _,
+         _) = struct.unpack(PHDR_FORMAT, data[off:off + PHDR_SIZE])
+        if p_type != PT_LOAD or p_filesz == 0:
+            continue
+        if p_offset + p_filesz > len(data):
+            raise ElfError("segment {} is past the end of the file".format(n))
+        for m, (addr, seg) in segments:
+            if p_paddr < addr + len(seg) and addr < p_paddr + p_filesz:
+                raise ElfError("segments {} and {} overlap, at 0x{:x}".format(
+                        m, n, max(addr, p_paddr)))
+        segments.append((n, (p_paddr, data[p_offset:p_offset + p_filesz])))
+    return [segment for n, segment in segments]
@@ -0,0 +1,88 @@
+"""
+Tests for reading ELF files
+"""
+
+import os.path
+import struct
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import elf
+
+PT_NOTE = 4
+
+def build_elf(segments, ident=b'\x7fELF\x01\x01\x01', phentsize=32):
+    """A minimal 32-bit ELF executable for ARM, of program headers only,
+    for the (type, physical address, data, memory size) segments, the
+    data of each following the headers in turn.  The virtual address of
+    each is its physical one, plus 0x20000000, as for a segment that is
+    copied to RAM."""
+    phoff = 52
+    off = phoff + len(segments) * phentsize
+    headers = b''
+    contents = b''
+    for p_type, paddr, data, memsz in segments:
+        headers += struct.pack('<IIIIIIII', p_type, off + len(contents),
+                               paddr + 0x20000000, paddr, len(data), memsz,
+                               5, 4).ljust(phentsize, b'\0')
+        contents += data
+    ehdr = ident.ljust(16, b'\0') + struct.pack(
+            '<HHIIIIIHHHHHH', 2, 40, 1, 0, phoff, 0, 0x05000000, 52,
+            phentsize, len(segments), 40, 0, 0)
+    return ehdr + headers + contents
+
+class ReadElf(unittest.TestCase):
+
+    def test_segments(self):
+        """Loadable segments come by their physical address, without
+        their bss, and other segments and bss-only ones are skipped."""
+        text = bytes(range(64))
+        data = b'\xaa' * 8
+        self.assertEqual(elf.read(build_elf([
+                (elf.PT_LOAD, 0x08000000, text, 64),
+                (PT_NOTE, 0x08000040, b'note', 4),
+                (elf.PT_LOAD, 0x08000040, data, 0x100),
+                (elf.PT_LOAD, 0x08000048, b'', 0x400)])),
+                [(0x08000000, text), (0x08000040, data)])
+
+    def test_no_segments(self):
+        self.assertEqual(elf.read(build_elf([])), [])
+
+    def test_longer_headers(self):
+        """Program headers can be longer than the fields read."""
+        self.assertEqual(elf.read(build_elf([(elf.PT_LOAD, 0, b'abc', 3)],
+                                            phentsize=40)),
+                         [(0, b'abc')])
+
+    def test_overlap(self):
+        with self.assertRaises(elf.ElfError) as cm:
+            elf.read(build_elf([(elf.PT_LOAD, 0x1000, bytes(32), 32),
+                                (elf.PT_LOAD, 0x1010, bytes(32), 32)]))
+        self.assertEqual(str(cm.exception),
+                         'segments 0 and 1 overlap, at 0x1010')
+        # Segments that only touch are fine.
+        elf.read(build_elf([(elf.PT_LOAD, 0x1000, bytes(32), 32),
+                            (elf.PT_LOAD, 0x1020, bytes(32), 32)]))
+
+    def test_refused(self):
+        good = build_elf([(elf.PT_LOAD, 0, bytes(16), 16)])
+        for data, message in [
+                (b'\0' * 64, 'not an ELF file'),
+                (build_elf([], ident=b'\x7fELF\x02\x01\x01'),
+                 'a 64-bit little-endian ELF file, only 32-bit '
+                 'little-endian ones are supported'),
+                (build_elf([], ident=b'\x7fELF\x01\x02\x01'),
+                 'a 32-bit big-endian ELF file'),
+                (good[:40], 'the ELF header is cut short'),
+                (good[:60], 'program header 0 is past the end of the file'),
+                (good[:-1], 'segment 0 is past the end of the file'),
+                (build_elf([(elf.PT_LOAD, 0, bytes(16), 16)], phentsize=16),
+                 'program headers of 16 bytes, not 32')]:
+            with self.assertRaises(elf.ElfError) as cm:
+                elf.read(data)
+            self.assertIn(message, str(cm.exception))
+
+if __name__ == '__main__':
+    unittest.main()
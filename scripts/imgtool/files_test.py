@@ -0,0 +1,41 @@
+"""
+Tests for file paths
+"""
+
+import os
+import os.path
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool.files import same_file
+from imgtool.testutil import TempDirTest
+
+class SameFile(TempDirTest):
+    def test_existing(self):
+        with open(self.tname('a.bin'), 'wb') as f:
+            f.write(b'a')
+        with open(self.tname('b.bin'), 'wb') as f:
+            f.write(b'a')
+        os.symlink('a.bin', self.tname('link.bin'))
+        self.assertTrue(same_file(self.tname('a.bin'), self.tname('a.bin')))
+        self.assertTrue(same_file(self.tname('link.bin'),
+                                  self.tname('a.bin')))
+        self.assertTrue(same_file(
+                os.path.join(self.test_dir.name, '.', 'a.bin'),
+                self.tname('a.bin')))
+        self.assertFalse(same_file(self.tname('a.bin'),
+                                   self.tname('b.bin')))
+
+    def test_missing(self):
+        """A path not yet written is the same file as one that resolves
+        to it, through a symlink that dangles until it is written."""
+        os.symlink('new.bin', self.tname('link.bin'))
+        self.assertTrue(same_file(self.tname('link.bin'),
+                                  self.tname('new.bin')))
+        self.assertFalse(same_file(self.tname('other.bin'),
+                                   self.tname('new.bin')))
+
+if __name__ == '__main__':
+    unittest.main()
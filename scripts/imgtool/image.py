@@ -17,32 +17,143 @@
 Image signing and management.
 """
 
+from . import boot_record
+from . import elf
+from . import srec
+from . import uf2
 from . import version as versmod
-from intelhex import IntelHex
+from intelhex import IntelHex, IntelHexError
+import collections
+import contextlib
 import hashlib
+import shutil
 import struct
+import sys
 import os.path
+import tempfile
 
 IMAGE_MAGIC = 0x96f3b83d
 IMAGE_HEADER_SIZE = 32
 BIN_EXT = "bin"
 INTEL_HEX_EXT = "hex"
+SREC_EXTS = ("srec", "s19", "s28", "s37", "mot")
+ELF_EXTS = ("elf", "axf")
+UF2_EXT = "uf2"
+
+# The names of the formats images are written in with addresses.
+ADDRESSED_FORMATS = {'ihex': 'Intel HEX', 'srec': 'S-records', 'uf2': 'UF2'}
 DEFAULT_MAX_SECTORS = 128
 
+# A binary image signed as it is streamed is read, hashed and written
+# this many bytes at a time, so signing it takes no more memory however
+# big it is.
+CHUNK_SIZE = 0x10000
+
 # Image header flags.
 IMAGE_F = {
         'PIC':                   0x0000001,
-        'NON_BOOTABLE':          0x0000010, }
+        'NON_BOOTABLE':          0x0000010,
+        'RAM_LOAD':              0x0000020,
+        'ROM_FIXED':             0x0000100,
+        'COMPRESSED_LZMA1':      0x0000200,
+        'COMPRESSED_LZMA2':      0x0000400,
+        'COMPRESSED_ARM_THUMB_FLT': 0x0000800, }
 
 TLV_VALUES = {
         'KEYHASH': 0x01,
+        'PUBKEY': 0x02,
         'SHA256': 0x10,
+        'SHA384': 0x11,
+        'SHA512': 0x12,
         'RSA2048': 0x20,
         'ECDSA224': 0x21,
-        'ECDSA256': 0x22, }
+        'ECDSASIG': 0x22,
+        'RSA3072': 0x23,
+        'ED25519': 0x24,
+        'ECDSABP256': 0x26,
+        'DEPENDENCY': 0x40,
+        'SEC_CNT': 0x50,
+        'BOOT_RECORD': 0x60, }
+
+# The algorithm of the signature each signature TLV holds, all of them
+# of the SHA256 hash of the image.
+SIG_ALGORITHMS = {
+        'RSA2048': 'RSA-2048 PSS',
+        'ECDSA224': 'ECDSA P-224',
+        'ECDSASIG': 'ECDSA P-256',
+        'RSA3072': 'RSA-3072 PSS',
+        'ED25519': 'Ed25519',
+        'ECDSABP256': 'ECDSA brainpoolP256r1', }
+
+# ECDSASIG holds the signatures of both P-256 and P-384 keys, the first
+# signing the SHA256 or SHA512 hash of the image, and the second the
+# SHA384 hash.
+ECDSASIG_ALGORITHMS = {
+        'SHA256': 'ECDSA P-256',
+        'SHA384': 'ECDSA P-384',
+        'SHA512': 'ECDSA P-256', }
+
+# The TLV of the hash of the image each sign --sha gives.
+IMAGE_HASHES = collections.OrderedDict([
+        ('256', 'SHA256'),
+        ('384', 'SHA384'),
+        ('512', 'SHA512'), ])
+
+HEADER_FORMAT = ('<' +
+    # type ImageHdr struct {
+    'I' +   # Magic uint32
+    'I' +   # LoadAddr uint32
+    'H' +   # HdrSz uint16
+    'H' +   # ProtectTLVSize uint16
+    'I' +   # ImgSz uint32
+    'I' +   # Flags uint32
+    'BBHI' + # Vers  ImageVersion
+    'I'     # Pad2  uint32
+    ) # }
+assert struct.calcsize(HEADER_FORMAT) == IMAGE_HEADER_SIZE
+
+# The byte orders the header and the TLVs can be written in, for the
+# bootloader of a little-endian or a big-endian target, and the struct
+# prefix of each.  The formats here are written little-endian.
+ENDIANS = collections.OrderedDict([('little', '<'), ('big', '>')])
+
+def _format(fmt, endian):
+    """The little-endian struct format fmt, in the byte order endian."""
+    return ENDIANS[endian] + fmt[1:]
+
+# The fields of the header of a signed image, as read_header reads them,
+# and the byte order it is written in.
+ImageHeader = collections.namedtuple('ImageHeader', [
+        'load_addr', 'hdr_size', 'protect_tlv_size', 'img_size', 'flags',
+        'version', 'endian'])
 
 TLV_INFO_SIZE = 4
 TLV_INFO_MAGIC = 0x6907
+TLV_PROT_INFO_MAGIC = 0x6908
+
+# The value of a DEPENDENCY TLV: the index of the image depended on, and
+# the lowest version of it that will do.
+DEPENDENCY_FORMAT = '<BBH' + 'BBHI'
+
+# The TLV types left for vendors to give their own TLVs, such as those
+# of sign --custom-tlv-protected.
+CUSTOM_TLV_TYPES = range(0xa0, 0x100)
+
+# The most images a product can have, by the size of the image index
+# of a DEPENDENCY TLV.
+MAX_IMAGE_ID = 0xff
+
+# The bootloader's MAX_FLASH_ALIGN, the room each flag of the trailer
+# has, before the magic, by default, and the others it can be built
+# with, for flash written 16 or 32 bytes at a time.
+BOOT_MAX_ALIGN = 8
+MAX_ALIGNS = (8, 16, 32)
+
+# The sizes flash can be written in, --align.
+WRITE_SIZES = (1, 2, 4, 8, 16, 32)
+
+# The value of a flag of the trailer that is set, such as image_ok.
+BOOT_FLAG_SET = 0x01
 
 boot_magic = bytes([
     0x77, 0xc2, 0x95, 0xf3,
@@ -50,43 +161,555 @@ boot_magic = bytes([
     0x35, 0x52, 0x50, 0x0f,
     0x2c, 0xb6, 0x79, 0x80, ])
 
+def trailer_magic(endian='little'):
+    """The boot magic that ends the trailer, in the byte order endian.
+    The bootloader holds it as four 32-bit words, so a big-endian one
+    looks for each word byte swapped."""
+    return struct.pack(_format('<4I', endian),
+                       *struct.unpack('<4I', boot_magic))
+
+class ImageError(Exception):
+    """The image can't be signed as asked."""
+    pass
+
+class HeaderNotBlank(ImageError):
+    """The image doesn't start with room for the header."""
+    pass
+
+class ImageGaps(ImageError):
+    """The Intel HEX, S-record or ELF image isn't one contiguous
+    region."""
+    pass
+
+class NotResignable(ImageError):
+    """The image starts with the image magic, but isn't a signed image
+    that can be signed again."""
+    pass
+
+class TLVError(Exception):
+    """The image isn't signed, or its TLV area is corrupt."""
+    pass
+
 class TLV():
-    def __init__(self):
+    def __init__(self, magic=TLV_INFO_MAGIC, endian='little'):
+        self.magic = magic
+        self.endian = endian
         self.buf = bytearray()
 
     def add(self, kind, payload):
-        """Add a TLV record.  Kind should be a string found in TLV_VALUES above."""
-        buf = struct.pack('<BBH', TLV_VALUES[kind], 0, len(payload))
+        """Add a TLV record.  Kind should be a string found in TLV_VALUES
+        above, or the number of a custom TLV."""
+        if not isinstance(kind, int):
+            kind = TLV_VALUES[kind]
+        buf = struct.pack(_format('<BBH', self.endian), kind, 0,
+                          len(payload))
         self.buf += buf
         self.buf += payload
 
     def get(self):
-        header = struct.pack('<HH', TLV_INFO_MAGIC, TLV_INFO_SIZE + len(self.buf))
+        """The TLV area, or nothing if it has no TLVs, as the protected
+        area is left out then."""
+        if len(self.buf) == 0:
+            return bytes()
+        if TLV_INFO_SIZE + len(self.buf) > 0xffff:
+            raise ImageError(
+                    "The TLVs are 0x{:x} bytes, more than the 0xffff their "
+                    "info header holds".format(
+                        TLV_INFO_SIZE + len(self.buf)))
+        header = struct.pack(_format('<HH', self.endian), self.magic,
+                             TLV_INFO_SIZE + len(self.buf))
         return header + bytes(self.buf)
 
+def security_counter_from_version(version):
+    """The security counter sign --security-counter auto gives an image
+    of the SemiSemVersion, which increases with the version, as the
+    major, minor and revision parts in turn, ignoring the build."""
+    return (version.major << 24) + (version.minor << 16) + version.revision
+
+def decode_security_counter(value, endian='little'):
+    """The security counter of a SEC_CNT TLV."""
+    if len(value) != 4:
+        raise TLVError("SEC_CNT TLV of {} bytes, rather than 4".format(
+            len(value)))
+    return struct.unpack(_format('<I', endian), value)[0]
+
+def encode_dependency(image_id, version, endian='little'):
+    """The value of the DEPENDENCY TLV on the image of the index image_id,
+    at version, a SemiSemVersion, or later."""
+    return struct.pack(_format(DEPENDENCY_FORMAT, endian), image_id, 0, 0,
+                       *version)
+
+def decode_dependency(value, endian='little'):
+    """The image index and SemiSemVersion of a DEPENDENCY TLV."""
+    if len(value) != struct.calcsize(DEPENDENCY_FORMAT):
+        raise TLVError("DEPENDENCY TLV of {} bytes, rather than {}".format(
+            len(value), struct.calcsize(DEPENDENCY_FORMAT)))
+    image_id, _, _, major, minor, revision, build = struct.unpack(
+            _format(DEPENDENCY_FORMAT, endian), value)
+    return image_id, versmod.SemiSemVersion(major, minor, revision, build)
+
+def flag_names(flags):
+    """The names, in IMAGE_F, of the flags set in the flags of a header,
+    in the order of their bits, and the value in hex of any bits set
+    that aren't flags."""
+    names = [name for name, bit in sorted(IMAGE_F.items(),
+                                          key=lambda item: item[1])
+             if flags & bit]
+    unknown = flags & ~sum(IMAGE_F.values())
+    if unknown:
+        names.append('0x{:x}'.format(unknown))
+    return names
+
+def decode_boot_record(value):
+    """The fields of a BOOT_RECORD TLV, as boot_record.parse gives
+    them."""
+    try:
+        return boot_record.parse(value)
+    except boot_record.BootRecordError as e:
+        raise TLVError("BOOT_RECORD TLV: {}".format(e))
+
+def read_signed(data, erased_val=0xff):
+    """The ImageHeader, the protected TLVs and the body of data, a signed
+    image, to sign it again, or None if it doesn't start with the image
+    magic.  Raises TLVError if it does, but isn't an image as imgtool
+    signs them: the header and the TLV areas have to hold together, the
+    hash TLV has to be the hash of the image, and nothing but erased
+    flash, or padding up to a trailer, can follow the TLVs."""
+    if not is_image(data):
+        return None
+    header = read_header(data)
+    if header.hdr_size < IMAGE_HEADER_SIZE:
+        raise TLVError("The header size 0x{:x} is less than the 0x{:x} "
+                       "bytes of the header".format(header.hdr_size,
+                                                    IMAGE_HEADER_SIZE))
+    protected, tlvs = read_tlv_areas(data)
+    hashed = header.hdr_size + header.img_size + header.protect_tlv_size
+    _, end = _read_tlv_area(data, hashed, TLV_INFO_MAGIC, "TLV",
+                            header.endian)
+    _check_hash(data, header, tlvs)
+    rest = bytes(data[end:])
+    if rest.strip(bytes([erased_val])) and \
+            not rest.endswith(trailer_magic(header.endian)):
+        raise TLVError("0x{:x} bytes that aren't a trailer follow the "
+                       "TLVs".format(len(rest)))
+    return (header, protected,
+            data[header.hdr_size:header.hdr_size + header.img_size])
+
+def _check_hash(data, header, tlvs):
+    """The name and value of the first hash TLV of tlvs, those of the
+    signed image data with the ImageHeader header, which has to be the
+    hash of its header, body and protected TLVs."""
+    names = dict((v, k) for k, v in TLV_VALUES.items())
+    digests = [(names[k], v) for k, v in tlvs
+               if names.get(k) in IMAGE_HASHES.values()]
+    if not digests:
+        raise TLVError("There is no hash TLV")
+    name, digest = digests[0]
+    hashed = header.hdr_size + header.img_size + header.protect_tlv_size
+    # A view, so that an image mapped from its file isn't copied.
+    sha = hashlib.new(name.lower())
+    with memoryview(data) as view:
+        sha.update(view[:hashed])
+    if sha.digest() != digest:
+        raise TLVError("The {} TLV isn't the hash of the image".format(name))
+    return name, digest
+
+def verify_image(data, key=None):
+    """Check data, a signed image, as the bootloader checks an image
+    before it boots it: the header and the TLV areas have to hold
+    together, and the hash TLV has to be the hash of the image.  With
+    key, the public key it was signed by, the KEYHASH or PUBKEY TLV has
+    to give that key, and the signature TLV has to be its signature of
+    the hash.  Raises TLVError if the image fails."""
+    header = read_header(data)
+    if header.hdr_size < IMAGE_HEADER_SIZE:
+        raise TLVError("The header size 0x{:x} is less than the 0x{:x} "
+                       "bytes of the header".format(header.hdr_size,
+                                                    IMAGE_HEADER_SIZE))
+    _, tlvs = read_tlv_areas(data)
+    name, digest = _check_hash(data, header, tlvs)
+    if key is None:
+        return
+    names = dict((v, k) for k, v in TLV_VALUES.items())
+    found = {}
+    for kind, value in tlvs:
+        found.setdefault(names.get(kind), value)
+    pub = key.get_public_bytes()
+    if 'PUBKEY' in found:
+        given, named = 'PUBKEY', found['PUBKEY'] == pub
+    elif 'KEYHASH' in found:
+        alg = {32: 'sha256', 48: 'sha384'}.get(len(found['KEYHASH']))
+        given = 'KEYHASH'
+        named = alg is not None and \
+                hashlib.new(alg, pub).digest() == found['KEYHASH']
+    else:
+        raise TLVError("There is no KEYHASH or PUBKEY TLV")
+    if not named:
+        raise TLVError("The {} TLV doesn't give the key the image was "
+                       "signed with".format(given))
+    sig = found.get(key.sig_tlv())
+    if sig is None:
+        raise TLVError("There is no {} TLV".format(key.sig_tlv()))
+    if not key.verify_digest(sig, digest, name[len('SHA'):]):
+        raise TLVError("The {} TLV isn't the key's signature of the "
+                       "image".format(key.sig_tlv()))
+
+def read_trailer(data, erased_val=0xff, max_align=BOOT_MAX_ALIGN,
+                 endian='little'):
+    """The copy_done and image_ok flags of the trailer that ends data,
+    an image padded to its slot, each 'set', 'unset' when it is erased,
+    or else its value in hex; or None when data doesn't end with the
+    boot magic, in the byte order endian.  The flags are max_align bytes
+    apart."""
+    if (len(data) < len(boot_magic) + 2 * max_align or
+            data[-len(boot_magic):] != trailer_magic(endian)):
+        return None
+    def flag(value):
+        if value == BOOT_FLAG_SET:
+            return 'set'
+        if value == erased_val:
+            return 'unset'
+        return '0x{:02x}'.format(value)
+    end = len(data) - len(boot_magic)
+    return collections.OrderedDict([
+            ('copy_done', flag(data[end - 2 * max_align])),
+            ('image_ok', flag(data[end - max_align]))])
+
+def read_header(data):
+    """Return the ImageHeader of a signed image, with its version a
+    SemiSemVersion, in the byte order its magic is written in.  Raises
+    TLVError if it isn't a signed image."""
+    if len(data) < IMAGE_HEADER_SIZE:
+        raise TLVError("Image is too short")
+    endian = image_endian(data)
+    if endian is None:
+        raise TLVError("Not a signed image, bad magic 0x{:08x}".format(
+            struct.unpack('<I', data[:4])[0]))
+    (_, load_addr, hdr_size, protect_tlv_size, img_size, flags, major,
+     minor, revision, build, _) = struct.unpack(
+             _format(HEADER_FORMAT, endian), data[:IMAGE_HEADER_SIZE])
+    return ImageHeader(load_addr, hdr_size, protect_tlv_size, img_size, flags,
+                       versmod.SemiSemVersion(major, minor, revision, build),
+                       endian)
+
+def read_tlvs(data):
+    """Return the TLVs of a signed image, as a list of (kind, value)
+    pairs, where kind is the numeric type, the protected ones first.
+    Raises TLVError if there is no TLV area, or it is corrupt."""
+    protected, tlvs = read_tlv_areas(data)
+    return protected + tlvs
+
+def read_tlv_areas(data):
+    """Return the protected TLVs of a signed image, those the hash and
+    signature cover, and then the others, each as read_tlvs does."""
+    header = read_header(data)
+    off = header.hdr_size + header.img_size
+    protected = []
+    if header.protect_tlv_size > 0:
+        protected, end = _read_tlv_area(data, off, TLV_PROT_INFO_MAGIC,
+                                        "protected TLV", header.endian)
+        if end - off != header.protect_tlv_size:
+            raise TLVError("The protected TLV area is 0x{:x} bytes, but "
+                           "the header says 0x{:x}".format(
+                               end - off, header.protect_tlv_size))
+        off = end
+    tlvs, _ = _read_tlv_area(data, off, TLV_INFO_MAGIC, "TLV", header.endian)
+    return protected, tlvs
+
+def _read_tlv_area(data, off, magic, name, endian='little'):
+    """The TLVs of the area at off, with the magic, and where the area
+    ends, in the byte order endian.  name is what the errors call the
+    area."""
+    if len(data) < off + TLV_INFO_SIZE:
+        raise TLVError("Image is truncated, there is no {} area".format(name))
+    tlv_magic, tlv_tot = struct.unpack(_format('<HH', endian),
+                                       data[off:off + TLV_INFO_SIZE])
+    if tlv_magic != magic:
+        for other in ENDIANS:
+            if other != endian and struct.unpack(
+                    _format('<H', other), data[off:off + 2])[0] == magic:
+                raise TLVError(
+                        "The {} area is {}-endian, but the header is "
+                        "{}-endian".format(name, other, endian))
+        raise TLVError("Bad {} magic 0x{:04x}".format(name, tlv_magic))
+    end = off + tlv_tot
+    if len(data) < end:
+        raise TLVError("Image is truncated, the {} area runs past its "
+                       "end".format(name))
+    off += TLV_INFO_SIZE
+    tlvs = []
+    while off < end:
+        if off + 4 > end:
+            raise TLVError("TLV header at 0x{:x} runs past the {} "
+                           "area".format(off, name))
+        kind, _, length = struct.unpack(_format('<BBH', endian),
+                                        data[off:off + 4])
+        off += 4
+        if off + length > end:
+            raise TLVError("TLV 0x{:02x} runs past the {} area".format(
+                kind, name))
+        tlvs.append((kind, bytes(data[off:off + length])))
+        off += length
+    return tlvs, end
+
+def file_format(path):
+    """The format of the image file at path, by its extension: ihex for
+    Intel Hex, srec for S-records, elf for ELF, uf2 for UF2, or else
+    bin."""
+    ext = os.path.splitext(path)[1][1:].lower()
+    if ext == INTEL_HEX_EXT:
+        return 'ihex'
+    if ext in SREC_EXTS:
+        return 'srec'
+    if ext in ELF_EXTS:
+        return 'elf'
+    if ext == UF2_EXT:
+        return 'uf2'
+    return 'bin'
+
+def _gaps(gaps):
+    return ", ".join("0x{:x}-0x{:x}".format(start, end)
+                     for start, end in gaps)
+
+@contextlib.contextmanager
+def open_image(path, mode='rb'):
+    """The image file at path, opened in mode, or stdin for "-", which
+    is left open.  stdin may be a pipe, so it is read once, in order."""
+    if path == '-':
+        yield sys.stdin.buffer if 'b' in mode else sys.stdin
+    else:
+        with open(path, mode) as f:
+            yield f
+
+def open_seekable(path):
+    """The binary image file at path, opened, or for "-" a temporary
+    file stdin is copied to, CHUNK_SIZE bytes at a time, as stdin may be
+    a pipe, which can't be read twice."""
+    if path != '-':
+        return open(path, 'rb')
+    f = tempfile.TemporaryFile()
+    shutil.copyfileobj(sys.stdin.buffer, f, CHUNK_SIZE)
+    f.seek(0)
+    return f
+
+def read_image(path, fmt=None, erased_val=0xff):
+    """Read the bytes of an image, in the format fmt, or else the one
+    its extension gives: those of Intel HEX, S-records and UF2 from the
+    lowest address they give, with any gaps erased_val bytes."""
+    fmt = fmt or file_format(path)
+    if fmt == 'ihex':
+        try:
+            ih = IntelHex(path)
+        except IntelHexError as e:
+            raise ImageError("Invalid Intel HEX file: {}".format(e))
+        ih.padding = erased_val
+        return bytes(ih.tobinarray())
+    if fmt == 'srec':
+        try:
+            with open(path, 'r') as f:
+                regions = srec.read(f)
+        except (srec.SRecError, UnicodeDecodeError) as e:
+            raise ImageError("Invalid S-record file: {}".format(e))
+        return _join_regions(regions, "S-record file", erased_val)[0]
+    with open(path, 'rb') as f:
+        data = f.read()
+    if fmt == 'uf2':
+        try:
+            regions = uf2.read(data)
+        except uf2.UF2Error as e:
+            raise ImageError("Invalid UF2 file: {}".format(e))
+        return _join_regions(regions, "UF2 file", erased_val)[0]
+    return data
+
+def _join_regions(regions, name, erased_val):
+    """The bytes of the (address, data) regions, in address order,
+    from the lowest address, with the gaps between them erased_val
+    bytes, that address, and the (start, end) of each gap.  name is what
+    the errors call the file they are read from."""
+    regions = sorted(regions, key=lambda r: r[0])
+    if not regions:
+        raise ImageError("The {} holds no data".format(name))
+    base = regions[0][0]
+    payload = bytearray()
+    gaps = []
+    for addr, data in regions:
+        end = base + len(payload)
+        if addr < end:
+            raise ImageError("The {} gives the byte at 0x{:x} "
+                             "twice".format(name, addr))
+        if addr > end:
+            gaps.append((end, addr))
+            payload += bytes([erased_val]) * (addr - end)
+        payload += data
+    return bytes(payload), base, gaps
+
+def image_endian(data):
+    """The byte order data, a signed image, is written in, by its magic,
+    or None if it doesn't start with the magic either way."""
+    for endian in ENDIANS:
+        if data[:4] == struct.pack(_format('<I', endian), IMAGE_MAGIC):
+            return endian
+    return None
+
+def is_image(data):
+    return image_endian(data) is not None
+
 class Image():
     @classmethod
-    def load(cls, path, included_header=False, **kwargs):
-        """Load an image from a given file"""
-        ext = os.path.splitext(path)[1][1:].lower()
-        if ext == INTEL_HEX_EXT:
+    def load(cls, path, pad_header=False, fmt=None, force_raw=False,
+             keep_protected=False, stream=False, **kwargs):
+        """Load an image from a given file, or stdin for "-", in the format
+        fmt, ihex, srec, elf or bin, or else the one its extension gives.
+        The header is written over the blank bytes it starts with, unless
+        pad_header is set, when they are added.  An image that is signed
+        already has its header and TLVs stripped, to be signed again,
+        unless force_raw is set, keeping its custom protected TLVs with
+        keep_protected.  With stream, a binary image is a StreamedImage,
+        unless it is one signed already, which is held in memory to be
+        stripped."""
+        fmt = fmt or file_format(path)
+        data = None
+        if stream and fmt == 'bin':
+            f = open_seekable(path)
+            if force_raw or not is_image(f.read(4)):
+                f.seek(0)
+                return StreamedImage.open(f, pad_header, **kwargs)
+            with f:
+                f.seek(0)
+                data = f.read()
+        if fmt == 'ihex':
             cls = HexImage
+        elif fmt == 'srec':
+            cls = SRecImage
+        elif fmt == 'elf':
+            cls = ElfImage
         else:
             cls = BinImage
 
         obj = cls(**kwargs)
-        obj.payload, obj.base_addr = obj.load(path)
+        if data is None:
+            obj.payload, obj.base_addr = obj.load(path)
+        else:
+            obj.payload, obj.base_addr = data, None
+        if not force_raw:
+            obj._strip_signature(pad_header, keep_protected)
 
-        # Add the image header if needed.
-        if not included_header and obj.header_size > 0:
-            obj.payload = (b'\000' * obj.header_size) + obj.payload
+        # Add the image header if needed, before the image, so that it
+        # stays at its address.
+        if pad_header and obj.header_size > 0:
+            obj.payload = obj.erased * obj.header_size + obj.payload
+            if obj.base_addr is not None:
+                if obj.base_addr < obj.header_size:
+                    raise ImageError(
+                            "The image starts at 0x{:x}, leaving no room "
+                            "for the 0x{:x} bytes of the header before "
+                            "it".format(obj.base_addr, obj.header_size))
+                obj.base_addr -= obj.header_size
 
         obj.check()
         return obj
 
+    def _strip_signature(self, pad_header, keep_protected):
+        """If the image is signed already, leave the room for the header
+        and the body, blanking the header and dropping the TLVs and any
+        trailer, and keep its custom protected TLVs, but for those of
+        the types given again, with keep_protected."""
+        try:
+            signed = read_signed(self.payload, self.erased_val)
+        except TLVError as e:
+            raise NotResignable("The image starts with the image magic, "
+                                "but isn't a signed image: {}".format(e))
+        if signed is None:
+            return
+        header, protected, body = signed
+        if pad_header:
+            raise ImageError("The image is signed already, so it has room "
+                             "for the header, without --pad-header")
+        if header.endian != self.endian:
+            raise ImageError(
+                    "The image is signed {}-endian, not {}-endian; give "
+                    "--endian {} to sign it again".format(
+                        header.endian, self.endian, header.endian))
+        if header.hdr_size != self.header_size:
+            raise ImageError(
+                    "The image is signed with a header of 0x{:x} bytes, "
+                    "which its code is linked to follow, not 0x{:x}".format(
+                        header.hdr_size, self.header_size))
+        # The header is blanked with what the rest of the room holds,
+        # zeros or erased flash, as it was before it was signed.
+        room = bytes(self.payload[IMAGE_HEADER_SIZE:header.hdr_size])
+        blank = room[:1] if room and not room.strip(room[:1]) else \
+                self.erased
+        self.payload = blank * IMAGE_HEADER_SIZE + room + body
+        self.resigned = header
+        if keep_protected:
+            given = [kind for kind, _ in self.custom_protected]
+            self.custom_protected = [
+                    (kind, value) for kind, value in protected
+                    if kind in CUSTOM_TLV_TYPES and kind not in given
+                    ] + self.custom_protected
+
     def __init__(self, version=None, header_size=IMAGE_HEADER_SIZE, pad=0,
-                 align=1, slot_size=0, max_sectors=DEFAULT_MAX_SECTORS):
+                 align=1, slot_size=0, max_sectors=DEFAULT_MAX_SECTORS,
+                 dependencies=None, security_counter=None,
+                 custom_protected=None, sha='256', keyhash_alg='sha256',
+                 public_key_format='hash', fill_gaps=False, erased_val=0xff,
+                 max_align=BOOT_MAX_ALIGN, boot_record=None, rom_fixed=None,
+                 load_addr=None, flags=None, overwrite_only=False,
+                 size_check=True, deterministic=False, endian='little'):
         self.version = version or versmod.decode_version("0")
+        # The byte order, in ENDIANS, of the header and the TLVs, which
+        # is the bootloader's.
+        self.endian = endian
+        # The header of the image when it was loaded signed already, to
+        # be signed again, or None.
+        self.resigned = None
+        # The bootloader's MAX_FLASH_ALIGN, one of MAX_ALIGNS, the room
+        # each flag of the trailer has.
+        self.max_align = max_align
+        # The value of erased flash, which fills the room for the header,
+        # the padding and the trailer, and gaps in the image.
+        self.erased_val = erased_val
+        # Whether the gaps between the regions of an Intel HEX, S-record
+        # or ELF image are filled with erased bytes, rather than refused.
+        self.fill_gaps = fill_gaps
+        # The offsets of the start and end of the padding pad_to adds,
+        # between the image and its trailer.
+        self.padding = None
+        # The hash of the image, one of IMAGE_HASHES, and the hashlib
+        # algorithm of the hash of the key.
+        self.sha = sha
+        self.keyhash_alg = keyhash_alg
+        # Whether the image names its key by the hash of it, in a
+        # KEYHASH TLV, or holds the full key, in a PUBKEY TLV.
+        self.public_key_format = public_key_format
+        # The security counter for rollback protection, or None.
+        self.security_counter = security_counter
+        # The (type, value) of each custom TLV to protect.
+        self.custom_protected = custom_protected or []
+        # The address in flash the image was linked to run from, which
+        # the header gives with the ROM_FIXED flag, or None.
+        self.rom_fixed = rom_fixed
+        # The address in RAM the bootloader copies the image to, to run
+        # it there, which the header gives with the RAM_LOAD flag, or
+        # None.
+        self.load_addr = load_addr
+        # Whether signing the same image with the same key and options
+        # gives the same bytes: the signature is deterministic, and the
+        # TLVs given in any order are written in the order of their types.
+        self.deterministic = deterministic
+        # Whether the image is refused if it, its TLVs included, and the
+        # trailer don't fit slot_size.
+        self.size_check = size_check
+        # Whether the trailer is for a bootloader that only overwrites
+        # the primary slot, and so keeps no swap status in it.
+        self.overwrite_only = overwrite_only
+        # The names, in IMAGE_F, of other flags to set in the header.
+        self.flags = flags or []
+        # The software type of the boot record to protect, or None.
+        self.boot_record = boot_record
+        # The (image index, SemiSemVersion) of each image this needs.
+        self.dependencies = dependencies or []
         self.header_size = header_size or IMAGE_HEADER_SIZE
         self.pad = pad
         self.align = align
@@ -104,117 +727,422 @@ class Image():
                     self.slot_size,
                     self.max_sectors,
                     self.__class__.__name__,
-                    len(self.payload))
+                    self.length())
+
+    @property
+    def erased(self):
+        """A byte of erased flash."""
+        return bytes([self.erased_val])
+
+    def length(self):
+        """The size of the image, as far as it is built."""
+        return len(self.payload)
+
+    def _room(self):
+        """The bytes at the start of the image, header_size of them, or
+        fewer if the image is shorter, that the header is written over."""
+        return bytes(self.payload[0:self.header_size])
 
     def check(self):
         """Perform some sanity checking of the image."""
         # If there is a header requested, make sure that the image
-        # starts with all zeros.
+        # starts with room for it, of zeros or of erased flash.
         if self.header_size > 0:
-            if any(v != 0 for v in self.payload[0:self.header_size]):
-                raise Exception("Padding requested, but image does not start with zeros")
-        if self.slot_size > 0:
-            tsize = self._trailer_size(self.align, self.max_sectors)
-            padding = self.slot_size - (len(self.payload) + tsize)
-            if padding < 0:
-                msg = "Image size (0x{:x}) + trailer (0x{:x}) exceeds requested size 0x{:x}".format(
-                        len(self.payload), tsize, self.slot_size)
-                raise Exception(msg)
+            room = self._room()
+            if (len(room) < self.header_size or
+                    room.strip(b'\0') and room.strip(self.erased)):
+                raise HeaderNotBlank(
+                        "The image doesn't start with 0x{:x} bytes of zeros"
+                        "{} for the header".format(
+                            self.header_size,
+                            "" if self.erased_val == 0 else
+                            ", or of 0x{:02x},".format(self.erased_val)))
+        if self.slot_size > 0 and self.size_check:
+            self.check_fits(self.slot_size)
 
-    def sign(self, key):
-        self.add_header(key)
+    def check_fits(self, size):
+        """Refuse the image, as far as it is built, if it doesn't leave
+        room for the trailer in a slot of size bytes, where the
+        bootloader would overwrite its end with the swap status."""
+        tsize = self._trailer_size(self.align, self.max_sectors)
+        over = self.length() + tsize - size
+        if over > 0:
+            raise ImageError(
+                    "Image + trailer exceeds slot by {} byte{}: the image "
+                    "is 0x{:x} bytes, the trailer 0x{:x}, and the slot "
+                    "0x{:x}".format(over, "" if over == 1 else "s",
+                                    self.length(), tsize, size))
 
-        tlv = TLV()
+    def sign(self, key):
+        # The protected TLVs follow the image, and are hashed and signed
+        # with it, so the header has to give their size.
+        protected = self._protected_tlvs(key)
+        self.add_header(key, len(protected))
+        self.payload += protected
 
         # Note that ecdsa wants to do the hashing itself, which means
         # we get to hash it twice.
-        sha = hashlib.sha256()
+        sha = hashlib.new('sha' + self.sha)
         sha.update(self.payload)
         digest = sha.digest()
+        sig = None
+        if key is not None:
+            sig = key.sign(bytes(self.payload), self.sha,
+                           deterministic=self.deterministic)
+        self.payload += self._tlvs(key, digest, sig)
+
+        # The TLVs may take the room the trailer needs.
+        if self.slot_size > 0 and self.size_check:
+            self.check_fits(self.slot_size)
+
+    def _protected_tlvs(self, key):
+        """The protected TLV area of the image signed by key."""
+        prot_tlv = TLV(TLV_PROT_INFO_MAGIC, self.endian)
+        if self.security_counter is not None:
+            prot_tlv.add('SEC_CNT', struct.pack(_format('<I', self.endian),
+                                                self.security_counter))
+        dependencies = self.dependencies
+        custom_protected = self.custom_protected
+        if self.deterministic:
+            dependencies = sorted(dependencies)
+            custom_protected = sorted(custom_protected)
+        for image_id, version in dependencies:
+            prot_tlv.add('DEPENDENCY',
+                         encode_dependency(image_id, version, self.endian))
+        for kind, value in custom_protected:
+            prot_tlv.add(kind, value)
+        if self.boot_record is not None:
+            prot_tlv.add('BOOT_RECORD', self.create_boot_record(key))
+        size = TLV_INFO_SIZE + len(prot_tlv.buf)
+        if size > 0xffff:
+            raise ImageError(
+                    "The protected TLVs are 0x{:x} bytes, more than the "
+                    "0xffff the header holds".format(size))
+        return prot_tlv.get()
 
-        tlv.add('SHA256', digest)
+    def _tlvs(self, key, digest, sig):
+        """The TLV area of the image whose hash is digest, and its
+        signature by key sig, with neither for an image left unsigned."""
+        tlv = TLV(endian=self.endian)
+        tlv.add(IMAGE_HASHES[self.sha], digest)
 
         if key is not None:
             pub = key.get_public_bytes()
-            sha = hashlib.sha256()
-            sha.update(pub)
-            pubbytes = sha.digest()
-            tlv.add('KEYHASH', pubbytes)
-
-            sig = key.sign(bytes(self.payload))
+            if self.public_key_format == 'full':
+                tlv.add('PUBKEY', pub)
+            else:
+                sha = hashlib.new(self.keyhash_alg)
+                sha.update(pub)
+                pubbytes = sha.digest()
+                tlv.add('KEYHASH', pubbytes)
             tlv.add(key.sig_tlv(), sig)
+        return tlv.get()
 
-        self.payload += tlv.get()
+    def create_boot_record(self, key):
+        """The boot record of the image, signed by key.  The record is
+        hashed with the image, so the measurement in it is left zeroed,
+        though sized for the hash, making the size of the protected TLVs
+        final before the hash is taken; the bootloader measures the
+        image and fills it in."""
+        if key is None:
+            raise ImageError("The boot record needs a key, for the signer "
+                             "ID")
+        sha = hashlib.new(self.keyhash_alg)
+        sha.update(key.get_public_bytes())
+        version = "{}.{}.{}".format(self.version.major, self.version.minor,
+                                    self.version.revision)
+        try:
+            return boot_record.create(
+                    self.boot_record, version, sha.digest(),
+                    IMAGE_HASHES[self.sha],
+                    hashlib.new('sha' + self.sha).digest_size)
+        except boot_record.BootRecordError as e:
+            raise ImageError(str(e))
 
-    def add_header(self, key):
+    def add_header(self, key, protect_tlv_size=0):
         """Install the image header.
 
         The key is needed to know the type of signature, and
-        approximate the size of the signature."""
+        approximate the size of the signature.  protect_tlv_size is the
+        size of the protected TLV area that will follow the image."""
+        header = self._header(protect_tlv_size,
+                              len(self.payload) - self.header_size)
+        self.payload = bytearray(self.payload)
+        self.payload[:len(header)] = header
 
+    def _header(self, protect_tlv_size, img_size):
+        """The header of an image of img_size bytes, after the header,
+        followed by protect_tlv_size bytes of protected TLVs."""
         flags = 0
+        for name in self.flags:
+            flags |= IMAGE_F[name]
+        load_addr = 0
+        if self.rom_fixed is not None:
+            flags |= IMAGE_F['ROM_FIXED']
+            load_addr = self.rom_fixed
+        if self.load_addr is not None:
+            flags |= IMAGE_F['RAM_LOAD']
+            load_addr = self.load_addr
 
-        fmt = ('<' +
-            # type ImageHdr struct {
-            'I' +   # Magic uint32
-            'I' +   # LoadAddr uint32
-            'H' +   # HdrSz uint16
-            'H' +   # Pad1  uint16
-            'I' +   # ImgSz uint32
-            'I' +   # Flags uint32
-            'BBHI' + # Vers  ImageVersion
-            'I'     # Pad2  uint32
-            ) # }
-        assert struct.calcsize(fmt) == IMAGE_HEADER_SIZE
-        header = struct.pack(fmt,
+        header = struct.pack(_format(HEADER_FORMAT, self.endian),
                 IMAGE_MAGIC,
-                0, # LoadAddr
+                load_addr, # LoadAddr
                 self.header_size,
-                0, # Pad1
-                len(self.payload) - self.header_size, # ImageSz
+                protect_tlv_size,
+                img_size, # ImageSz
                 flags, # Flags
                 self.version.major,
                 self.version.minor or 0,
                 self.version.revision or 0,
                 self.version.build or 0,
                 0) # Pad2
-        self.payload = bytearray(self.payload)
-        self.payload[:len(header)] = header
+        return header
 
     def _trailer_size(self, write_size, max_sectors):
         # NOTE: should already be checked by the argument parser
-        if write_size not in set([1, 2, 4, 8]):
+        if write_size not in WRITE_SIZES:
             raise Exception("Invalid alignment: {}".format(write_size))
+        if self.overwrite_only:
+            # Just the flags and the magic, without the swap status.
+            return self.max_align * 2 + len(boot_magic)
         m = DEFAULT_MAX_SECTORS if max_sectors is None else max_sectors
-        return m * 3 * write_size + 8 * 2 + 16
+        return m * 3 * write_size + self.max_align * 2 + len(boot_magic)
+
+    def pad_to(self, size, confirm=False):
+        """Pad the image to the given size, with the given flash alignment,
+        so the boot magic is the last 16 bytes of the slot, where the
+        bootloader looks for it to take the image as an upgrade.  With
+        confirm, the image_ok flag, max_align bytes before the magic, is
+        set too, so the image is taken as good rather than to be
+        tested.  The signed
+        image, its TLVs included, has to leave room for the trailer."""
+        self.check_fits(size)
+        trailer = self._trailer(confirm)
+        padding = size - (len(self.payload) + len(trailer))
+        self.padding = (len(self.payload), len(self.payload) + padding)
+        self.payload += self.erased * padding
+        self.payload += trailer
 
-    def pad_to(self, size):
-        """Pad the image to the given size, with the given flash alignment."""
+    def _trailer(self, confirm):
+        """The trailer pad_to ends the slot with."""
         tsize = self._trailer_size(self.align, self.max_sectors)
-        padding = size - (len(self.payload) + tsize)
-        pbytes  = b'\xff' * padding
-        pbytes += b'\xff' * (tsize - len(boot_magic))
-        pbytes += boot_magic
-        self.payload += pbytes
+        trailer = bytearray(self.erased * tsize)
+        trailer[-len(boot_magic):] = trailer_magic(self.endian)
+        if confirm:
+            trailer[-len(boot_magic) - self.max_align] = BOOT_FLAG_SET
+        return trailer
 
 
+    def save(self, path, fmt='bin', addr=None, srec_header=None,
+             uf2_family_id=None, uf2_skip_padding=False):
+        """Write the image to path, or to stdout for "-", as a binary, or
+        for fmt ihex, srec or uf2 as Intel HEX, S-records or UF2, starting
+        at addr, or else at the address the image was loaded from.  The
+        S-records start with an S0 record of the bytes srec_header, when
+        given.  The UF2 blocks carry uf2_family_id, when given, and leave
+        out the padding pad_to adds with uf2_skip_padding."""
+        if fmt not in ADDRESSED_FORMATS:
+            if path == '-':
+                sys.stdout.buffer.write(self.payload)
+                sys.stdout.buffer.flush()
+                return
+            with open(path, 'wb') as f:
+                f.write(self.payload)
+            return
+        if addr is None:
+            addr = self.base_addr
+        if addr is None:
+            raise ImageError("A binary image has no address to write it "
+                             "at in {}".format(ADDRESSED_FORMATS[fmt]))
+        if addr < 0 or addr + len(self.payload) > 1 << 32:
+            raise ImageError("The image, 0x{:x} bytes at 0x{:x}, doesn't "
+                             "fit the 32 bit addresses of {}".format(
+                                 len(self.payload), addr,
+                                 ADDRESSED_FORMATS[fmt]))
+        if fmt == 'uf2':
+            skip = self.padding if uf2_skip_padding else None
+            if path == '-':
+                uf2.write(sys.stdout.buffer, addr, self.payload,
+                          uf2_family_id, skip)
+                sys.stdout.buffer.flush()
+            else:
+                with open(path, 'wb') as f:
+                    uf2.write(f, addr, self.payload, uf2_family_id, skip)
+            return
+        if fmt == 'srec':
+            if path == '-':
+                srec.write(sys.stdout, addr, self.payload, srec_header)
+            else:
+                with open(path, 'w') as f:
+                    srec.write(f, addr, self.payload, srec_header)
+            return
+        h = IntelHex()
+        h.frombytes(bytes = self.payload, offset = addr)
+        h.tofile(sys.stdout if path == '-' else path, 'hex')
+
+    def _join(self, regions, name):
+        """The bytes of the (address, data) regions, in address order,
+        from the lowest address, and that address.  The gaps between
+        them are erased bytes, when fill_gaps is set."""
+        payload, base, gaps = _join_regions(regions, name, self.erased_val)
+        if gaps and not self.fill_gaps:
+            raise ImageGaps("The {} has gaps, at {}".format(name,
+                                                             _gaps(gaps)))
+        return payload, base
+
 class HexImage(Image):
 
     def load(self, path):
-        ih = IntelHex(path)
-        return ih.tobinarray(), ih.minaddr()
+        try:
+            with open_image(path, 'r') as f:
+                ih = IntelHex(f)
+        except IntelHexError as e:
+            raise ImageError("Invalid Intel HEX file: {}".format(e))
+        segments = ih.segments()
+        if not segments:
+            raise ImageError("The Intel HEX file holds no data")
+        if len(segments) > 1 and not self.fill_gaps:
+            raise ImageGaps("The Intel HEX file has gaps, at {}".format(
+                    _gaps((end, start) for (_, end), (start, _)
+                          in zip(segments, segments[1:]))))
+        ih.padding = self.erased_val
+        return bytes(ih.tobinarray()), ih.minaddr()
 
-    def save(self, path):
-        h = IntelHex()
-        h.frombytes(bytes = self.payload, offset = self.base_addr)
-        h.tofile(path, 'hex')
+class SRecImage(Image):
+
+    def load(self, path):
+        try:
+            with open_image(path, 'r') as f:
+                regions = sorted(srec.read(f), key=lambda r: r[0])
+        except (srec.SRecError, UnicodeDecodeError) as e:
+            raise ImageError("Invalid S-record file: {}".format(e))
+        return self._join(regions, "S-record file")
+
+class ElfImage(Image):
+
+    def load(self, path):
+        with open_image(path) as f:
+            data = f.read()
+        try:
+            regions = sorted(elf.read(data), key=lambda r: r[0])
+        except elf.ElfError as e:
+            raise ImageError("Invalid ELF file: {}, give --input-format "
+                             "for another format".format(e))
+        return self._join(regions, "ELF file")
 
 class BinImage(Image):
 
     def load(self, path):
-        with open(path, 'rb') as f:
+        with open_image(path) as f:
             return f.read(), None
 
-    def save(self, path):
+class StreamedImage(Image):
+    """A binary image signed as it is copied from its file to the signed
+    one, read CHUNK_SIZE bytes at a time, rather than held in memory.
+    Only the room for the header, the TLVs and the trailer are held."""
+
+    @classmethod
+    def open(cls, f, pad_header=False, **kwargs):
+        """The image in the binary file f, open, which has to be seekable,
+        as it is read once to hash it and again to write it.  The header
+        is written over the blank bytes it starts with, unless pad_header
+        is set, when they are added."""
+        obj = cls(**kwargs)
+        obj.file = f
+        obj.base_addr = None
+        size = f.seek(0, os.SEEK_END)
+        if pad_header:
+            obj.head = bytearray(obj.erased * obj.header_size)
+            obj.body_start = 0
+        else:
+            f.seek(0)
+            obj.head = bytearray(f.read(obj.header_size))
+            obj.body_start = len(obj.head)
+        obj.body_size = size - obj.body_start
+        obj.check()
+        return obj
+
+    def __init__(self, **kwargs):
+        super().__init__(**kwargs)
+        # The file the image is read from, the room for the header at
+        # its start, and the offset and size of the rest of it, the body.
+        self.file = None
+        self.head = bytearray()
+        self.body_start = 0
+        self.body_size = 0
+        # The protected TLVs and the TLVs sign adds, and the size of the
+        # padding and the trailer pad_to adds.
+        self.tail = b''
+        self.pad_size = 0
+        self.trailer = b''
+
+    def length(self):
+        return (len(self.head) + self.body_size + len(self.tail) +
+                self.pad_size + len(self.trailer))
+
+    def _room(self):
+        return bytes(self.head)
+
+    def _body(self):
+        """The body of the image, read from its file in chunks."""
+        self.file.seek(self.body_start)
+        left = self.body_size
+        while left > 0:
+            chunk = self.file.read(min(CHUNK_SIZE, left))
+            if not chunk:
+                raise ImageError("The image was cut short while it was "
+                                 "signed")
+            left -= len(chunk)
+            yield chunk
+
+    def sign(self, key):
+        protected = self._protected_tlvs(key)
+        header = self._header(len(protected), self.body_size)
+        self.head[:len(header)] = header
+        sha = hashlib.new('sha' + self.sha)
+        sha.update(self.head)
+        for chunk in self._body():
+            sha.update(chunk)
+        sha.update(protected)
+        digest = sha.digest()
+        sig = None
+        if key is not None:
+            sig = key.sign_digest(digest, self.sha,
+                                  deterministic=self.deterministic)
+        self.tail = protected + self._tlvs(key, digest, sig)
+        if self.slot_size > 0 and self.size_check:
+            self.check_fits(self.slot_size)
+
+    def pad_to(self, size, confirm=False):
+        self.check_fits(size)
+        trailer = self._trailer(confirm)
+        start = self.length()
+        self.pad_size = size - (start + len(trailer))
+        self.padding = (start, start + self.pad_size)
+        self.trailer = trailer
+
+    def save(self, path, fmt='bin', addr=None, srec_header=None,
+             uf2_family_id=None, uf2_skip_padding=False):
+        """Write the image to path, or to stdout for "-", as a binary,
+        copying its body from the file it is read from."""
+        if fmt != 'bin':
+            raise ImageError("A streamed image is only written as a "
+                             "binary")
+        if path == '-':
+            self._write(sys.stdout.buffer)
+            sys.stdout.buffer.flush()
+            return
         with open(path, 'wb') as f:
-            f.write(self.payload)
+            self._write(f)
+
+    def _write(self, f):
+        f.write(self.head)
+        for chunk in self._body():
+            f.write(chunk)
+        f.write(self.tail)
+        fill = self.erased * min(CHUNK_SIZE, self.pad_size)
+        left = self.pad_size
+        while left > 0:
+            f.write(fill[:left])
+            left -= len(fill)
+        f.write(self.trailer)
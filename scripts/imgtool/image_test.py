@@ -0,0 +1,219 @@
+"""
+Tests for images, and the checks the bootloader makes of them
+"""
+
+import hashlib
+import os.path
+import struct
+import sys
+import tracemalloc
+import unittest
+
+from cryptography.exceptions import InvalidSignature
+from cryptography.hazmat.primitives import hashes, serialization
+from cryptography.hazmat.primitives.asymmetric import ec, rsa
+from cryptography.hazmat.primitives.asymmetric.utils import Prehashed
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import image, keys
+from imgtool.testutil import TESTDATA, TempDirTest
+
+def bootloader_hash(signed, alg='sha256'):
+    """The hash of the image as the bootloader computes it, over the
+    header, the image and the protected TLVs the header gives the size
+    of, and where the unprotected TLVs start, after them."""
+    hdr_size, protect_tlv_size, img_size = struct.unpack('<HHI',
+                                                         signed[8:16])
+    end = hdr_size + img_size + protect_tlv_size
+    return hashlib.new(alg, signed[:end]).digest(), end
+
+def bootutil_cmp_rsasig(pub, digest, sig):
+    """Whether sig is an RSA-PSS signature of digest, checked step by
+    step as image_rsa.c does, with SHA256 for the hash and MGF1, and a
+    salt of exactly 32 bytes."""
+    nums = pub.public_numbers()
+    em_len = (nums.n.bit_length() + 7) // 8
+    if len(sig) != em_len:
+        return False
+    em = pow(int.from_bytes(sig, 'big'), nums.e, nums.n).to_bytes(em_len,
+                                                                   'big')
+    if em[-1] != 0xbc:
+        return False
+    masked_db, h = em[:em_len - 32 - 1], em[em_len - 32 - 1:-1]
+    mask = b''
+    counter = 0
+    while len(mask) < len(masked_db):
+        mask += hashlib.sha256(h + struct.pack('>I', counter)).digest()
+        counter += 1
+    db = bytearray(a ^ b for a, b in zip(masked_db, mask))
+    db[0] &= 0x7f
+    zeros = len(db) - 32 - 1
+    if any(db[:zeros]) or db[zeros] != 1:
+        return False
+    salt = bytes(db[zeros + 1:])
+    return hashlib.sha256(bytes(8) + digest + salt).digest() == h
+
+def bootloader_accepts(signed, pub):
+    """Whether the bootloader, with pub as its only key, would boot the
+    signed image, checking its TLVs as image_validate.c does: the
+    SHA256, SHA384 or SHA512 TLV has to be the hash of the image, and a
+    signature made with the key the KEYHASH TLV before it names has to
+    verify."""
+    image_hashes = {image.TLV_VALUES['SHA256']: hashes.SHA256(),
+                    image.TLV_VALUES['SHA384']: hashes.SHA384(),
+                    image.TLV_VALUES['SHA512']: hashes.SHA512()}
+    # The bootloader holds RSA keys as the PKCS#1 RSAPublicKey, and the
+    # others as the SubjectPublicKeyInfo.
+    if isinstance(pub, rsa.RSAPublicKey):
+        key_format = serialization.PublicFormat.PKCS1
+    else:
+        key_format = serialization.PublicFormat.SubjectPublicKeyInfo
+    key_bytes = pub.public_bytes(serialization.Encoding.DER, key_format)
+    hash_valid = valid_signature = False
+    key_found = False
+    digest = None
+    for kind, value in image.read_tlv_areas(signed)[1]:
+        if kind in image_hashes:
+            hash_alg = image_hashes[kind]
+            digest, end = bootloader_hash(signed, hash_alg.name)
+            if value != digest:
+                return False
+            hash_valid = True
+        elif kind == image.TLV_VALUES['KEYHASH']:
+            # The key is hashed with SHA256, or SHA384 if sign was given
+            # --keyhash-alg sha384.
+            key_found = value == hashlib.new('sha{}'.format(len(value) * 8),
+                                             key_bytes).digest()
+        elif kind == image.TLV_VALUES['ECDSASIG']:
+            # The DER signature is padded with zeros to a fixed length.
+            if key_found and hash_valid and len(value) > 2:
+                try:
+                    pub.verify(value[:value[1] + 2], digest,
+                               ec.ECDSA(Prehashed(hash_alg)))
+                    valid_signature = True
+                except InvalidSignature:
+                    pass
+            key_found = False
+        elif kind == image.TLV_VALUES['ED25519']:
+            if key_found and len(value) == 64:
+                try:
+                    pub.verify(value, digest)
+                    valid_signature = True
+                except InvalidSignature:
+                    pass
+            key_found = False
+        elif kind in (image.TLV_VALUES['RSA2048'],
+                      image.TLV_VALUES['RSA3072']):
+            if key_found and bootutil_cmp_rsasig(pub, digest, value):
+                valid_signature = True
+            key_found = False
+    return hash_valid and valid_signature
+
+def load_key(name):
+    return keys.load(os.path.join(TESTDATA, name))
+
+class SignedImage(TempDirTest):
+    """Images signed with the library, as sign does."""
+
+    def sign(self, key, stream=False, size=0x8000, slot_size=0x20000,
+             **kwargs):
+        """The type of the image loaded, and the image signed by key
+        and padded to the slot, its body size bytes after a header of
+        0x100."""
+        infile = self.tname('image.bin')
+        with open(infile, 'wb') as f:
+            f.write(bytes(0x100) + bytes(range(256)) * (size // 256))
+        img = image.Image.load(infile, stream=stream, header_size=0x100,
+                               align=4, slot_size=slot_size, **kwargs)
+        img.sign(key)
+        img.pad_to(slot_size)
+        outfile = self.tname('signed.bin')
+        img.save(outfile)
+        with open(outfile, 'rb') as f:
+            return type(img), f.read()
+
+class Streamed(SignedImage):
+    """A binary image loaded with stream is read, hashed and written in
+    chunks rather than held in memory."""
+
+    def test_same(self):
+        """Streamed, the image is signed as it is when held, and the
+        bootloader takes it."""
+        key = load_key('ed25519-pkcs8.pem')
+        for kwargs in [{}, {'security_counter': 3, 'sha': '512'},
+                       {'boot_record': 'SPE', 'erased_val': 0}]:
+            kind, held = self.sign(key, False, **kwargs)
+            self.assertIs(kind, image.BinImage)
+            kind, streamed = self.sign(key, True, **kwargs)
+            self.assertIs(kind, image.StreamedImage)
+            self.assertEqual(streamed, held, kwargs)
+        for name in ['p256-pkcs8.pem', 'rsa2048-pkcs8.pem']:
+            key = load_key(name)
+            _, streamed = self.sign(key, True)
+            self.assertTrue(bootloader_accepts(
+                    streamed, key.key.public_key()), name)
+
+    def test_memory(self):
+        """Signing a 64 MiB image, padded to a 128 MiB slot, takes no
+        more memory than a few of the chunks it is read in."""
+        infile = self.tname('image.bin')
+        with open(infile, 'wb') as f:
+            f.truncate(64 << 20)
+        key = load_key('ed25519-pkcs8.pem')
+        tracemalloc.start()
+        try:
+            img = image.Image.load(infile, stream=True, header_size=0x200,
+                                   align=4, slot_size=128 << 20)
+            img.sign(key)
+            img.pad_to(128 << 20)
+            img.save(self.tname('signed.bin'))
+            _, peak = tracemalloc.get_traced_memory()
+        finally:
+            tracemalloc.stop()
+        self.assertLess(peak, 8 * image.CHUNK_SIZE)
+        self.assertEqual(os.path.getsize(self.tname('signed.bin')),
+                         128 << 20)
+        with open(self.tname('signed.bin'), 'rb') as f:
+            header = image.read_header(f.read(image.IMAGE_HEADER_SIZE))
+        self.assertEqual(header.img_size, (64 << 20) - 0x200)
+
+    def test_signed_held(self):
+        """An image signed already is held in memory, to strip its old
+        signature, but signed as it is with force_raw."""
+        key = load_key('ed25519-pkcs8.pem')
+        _, signed = self.sign(key, True)
+        os.rename(self.tname('signed.bin'), self.tname('old.bin'))
+        img = image.Image.load(self.tname('old.bin'), stream=True,
+                               header_size=0x100, slot_size=0x20000)
+        self.assertIs(type(img), image.BinImage)
+        self.assertIsNotNone(img.resigned)
+        with self.assertRaises(image.HeaderNotBlank):
+            image.Image.load(self.tname('old.bin'), stream=True,
+                             force_raw=True, header_size=0x100)
+
+class Verify(SignedImage):
+    """verify_image, checking an image as the bootloader would."""
+
+    def test_verify(self):
+        key = load_key('p256-pkcs8.pem')
+        other = load_key('p384-pkcs8.pem')
+        _, signed = self.sign(key)
+        image.verify_image(signed)
+        image.verify_image(signed, key)
+        image.verify_image(signed, keys.public_key(key))
+        with self.assertRaises(image.TLVError):
+            image.verify_image(signed, other)
+        header = image.read_header(signed)
+        with self.assertRaises(image.TLVError):
+            image.verify_image(signed[:header.hdr_size + header.img_size])
+
+class FlagNames(unittest.TestCase):
+    def test_flag_names(self):
+        self.assertEqual(image.flag_names(0), [])
+        self.assertEqual(image.flag_names(0x120), ['RAM_LOAD', 'ROM_FIXED'])
+        self.assertEqual(image.flag_names(0x80000011),
+                         ['PIC', 'NON_BOOTABLE', '0x80000000'])
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,123 @@
+"""
+AES key management, for the key-wrap image encryption
+"""
+
+import base64
+import os
+
+from .general import KeyClass, KeyUsageError, format_metadata
+from .keyfile import write_private
+from .secret import Secret
+from . import seeded
+
+# The PEM type of AES key files.
+AES_PEM_TYPE = 'AES KEY'
+
+# The supported key sizes, in bytes.
+AES_KEY_SIZES = [16, 32]
+
+class AESUsageError(KeyUsageError):
+    pass
+
+def pem_encode(data):
+    """PEM encode the raw key, with lines of 64 characters."""
+    text = base64.b64encode(data).decode('ascii')
+    lines = [text[i:i + 64] for i in range(0, len(text), 64)]
+    return ("-----BEGIN {0}-----\n{1}\n-----END {0}-----\n".format(
+        AES_PEM_TYPE, '\n'.join(lines))).encode('ascii')
+
+def pem_decode(raw):
+    """Return the raw key from a PEM encoded file, or None if this isn't
+    an AES key."""
+    begin = "-----BEGIN {}-----".format(AES_PEM_TYPE).encode('ascii')
+    end = "-----END {}-----".format(AES_PEM_TYPE).encode('ascii')
+    start = raw.find(begin)
+    if start < 0:
+        return None
+    stop = raw.find(end, start)
+    if stop < 0:
+        raise AESUsageError("Truncated AES key file")
+    return base64.b64decode(b''.join(raw[start + len(begin):stop].split()))
+
+class AES(KeyClass):
+    """
+    A raw AES key.  This is secret, and shared with the device, so
+    there is no public part to give out.
+    """
+
+    def __init__(self, key):
+        """key should be the raw key bytes"""
+        if len(key) not in AES_KEY_SIZES:
+            raise AESUsageError("Unsupported AES key size: {} bits".format(
+                len(key) * 8))
+        self.key = Secret(key)
+
+    @staticmethod
+    def generate(key_size=256, seed=None):
+        """Generate a new key of the given number of bits."""
+        size = key_size // 8
+        if size not in AES_KEY_SIZES:
+            raise AESUsageError("Unsupported AES key size: {} bits".format(
+                key_size))
+        if seed is not None:
+            return AES(seeded.raw_private_bytes(seed, "aes-{}".format(key_size),
+                                                size))
+        return AES(os.urandom(size))
+
+    def shortname(self):
+        return "aes"
+
+    def zeroize(self):
+        """Wipe the key, which is held in our own memory."""
+        self.key.zeroize()
+
+    def key_size(self):
+        return len(self.key) * 8
+
+    def _unsupported(self, name):
+        raise AESUsageError("AES keys are symmetric, and have no public key")
+
+    def get_public_bytes(self):
+        self._unsupported('get_public_bytes')
+
+    def get_private_bytes(self):
+        """The raw key, as used by the bootloader."""
+        return self.key
+
+    def _jwk_members(self):
+        self._unsupported('getpub')
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        """Write the key to the given file.  The der encoding writes
+        the raw key bytes."""
+        if passwd is not None:
+            raise AESUsageError("AES keys can't be protected by a password")
+        if encoding == 'der':
+            data = self.key
+        else:
+            data = pem_encode(self.key)
+            if metadata:
+                data = format_metadata(metadata) + data
+        write_private(path, data, overwrite=overwrite)
+
+    def public_pem(self):
+        self._unsupported('public_pem')
+
+    def _raw_public_bytes(self):
+        self._unsupported('get_raw_public_bytes')
+
+    def export_public(self, path, overwrite=True):
+        self._unsupported('export_public')
+
+    def sig_tlv(self):
+        raise AESUsageError("AES keys can't be used for signing")
+
+    def sig_len(self):
+        self.sig_tlv()
+
+    def sign(self, payload, sha='256', deterministic=False):
+        self.sig_tlv()
+
+    def sign_digest(self, digest, sha='256', deterministic=False):
+        self.sig_tlv()
@@ -0,0 +1,73 @@
+"""
+Tests for AES keys
+"""
+
+import os.path
+import sys
+import tempfile
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import load, AES, AESUsageError
+
+class AESKeyGeneration(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_sizes(self):
+        for bits in [128, 256]:
+            k = AES.generate(bits)
+            self.assertEqual(k.key_size(), bits)
+            self.assertEqual(len(k.get_private_bytes()), bits // 8)
+        self.assertRaises(AESUsageError, AES.generate, 192)
+
+    def test_encodings(self):
+        for bits in [128, 256]:
+            k = AES.generate(bits)
+
+            pem = self.tname('aes-{}.pem'.format(bits))
+            k.export_private(pem)
+            with open(pem, 'rb') as f:
+                self.assertTrue(f.read().startswith(b'-----BEGIN AES KEY-----\n'))
+            self.assertEqual(load(pem).get_private_bytes(), k.key)
+
+            raw = self.tname('aes-{}.bin'.format(bits))
+            k.export_private(raw, encoding='der')
+            with open(raw, 'rb') as f:
+                self.assertEqual(f.read(), k.key)
+            self.assertEqual(load(raw).get_private_bytes(), k.key)
+
+    def test_metadata(self):
+        k = AES.generate()
+        pem = self.tname('aes.pem')
+        k.export_private(pem, metadata=[('KeyType', 'aes-256')])
+        with open(pem, 'rb') as f:
+            self.assertTrue(f.read().startswith(b'KeyType: aes-256\n'))
+        self.assertEqual(load(pem).get_private_bytes(), k.key)
+
+    def test_seeded(self):
+        a = AES.generate(128, seed=b'seed')
+        b = AES.generate(128, seed=b'seed')
+        self.assertEqual(a.key, b.key)
+        self.assertNotEqual(a.key, AES.generate(256, seed=b'seed').key[:16])
+
+    def test_no_public(self):
+        k = AES.generate()
+        self.assertRaises(AESUsageError, k.get_public_bytes)
+        self.assertRaises(AESUsageError, k.emit_c)
+        self.assertRaises(AESUsageError, k.emit_jwk)
+        self.assertRaises(AESUsageError, k.export_public, self.tname('pub.pem'))
+        self.assertRaises(AESUsageError, k.export_private,
+                self.tname('key.pem'), passwd=b'secret')
+        self.assertRaises(AESUsageError, k.sign, b'payload')
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,179 @@
+"""
+Signing with keys held by ssh-agent, so the private key is never seen
+by imgtool.  Keys are given as "agent:" followed by the comment of the
+key in the agent, or its OpenSSH fingerprint.
+"""
+
+import hashlib
+import os
+import socket
+import struct
+
+from cryptography.exceptions import InvalidSignature
+from cryptography.hazmat.primitives.asymmetric import ec
+from cryptography.hazmat.primitives.asymmetric.utils import encode_dss_signature
+
+from .ecdsa import ECDSAPublic
+from .general import KeyUsageError
+from . import ssh
+
+AGENT_PREFIX = 'agent:'
+
+# Agent protocol messages, from draft-miller-ssh-agent.
+SSH_AGENT_FAILURE = 5
+SSH2_AGENTC_REQUEST_IDENTITIES = 11
+SSH2_AGENT_IDENTITIES_ANSWER = 12
+SSH2_AGENTC_SIGN_REQUEST = 13
+SSH2_AGENT_SIGN_RESPONSE = 14
+
+# Replies are far smaller than this, anything larger is garbage.
+MAX_REPLY = 256 * 1024
+
+class AgentError(KeyUsageError):
+    pass
+
+def is_agent_ref(ref):
+    return ref.startswith(AGENT_PREFIX) and not os.path.exists(ref)
+
+class Agent(object):
+    """A connection to ssh-agent, at the socket given by SSH_AUTH_SOCK,
+    unless another path is given."""
+
+    def __init__(self, path=None):
+        if path is None:
+            path = os.environ.get('SSH_AUTH_SOCK')
+        if not path:
+            raise AgentError("ssh-agent is not running, SSH_AUTH_SOCK is not set")
+        self.path = path
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        try:
+            self.sock.connect(path)
+        except OSError as e:
+            self.sock.close()
+            raise AgentError("Can't connect to ssh-agent at {}: {}".format(
+                path, e.strerror or e))
+
+    def close(self):
+        self.sock.close()
+
+    def _recv(self, n):
+        data = b''
+        while len(data) < n:
+            chunk = self.sock.recv(n - len(data))
+            if not chunk:
+                raise AgentError("ssh-agent closed the connection")
+            data += chunk
+        return data
+
+    def request(self, kind, body=b''):
+        """Send a message, returning the type and body of the reply."""
+        msg = bytes([kind]) + body
+        try:
+            self.sock.sendall(struct.pack('>I', len(msg)) + msg)
+            size = struct.unpack('>I', self._recv(4))[0]
+            if not 0 < size <= MAX_REPLY:
+                raise AgentError("Invalid reply from ssh-agent")
+            reply = self._recv(size)
+        except OSError as e:
+            raise AgentError("Error talking to ssh-agent: {}".format(e))
+        return reply[0], reply[1:]
+
+    def identities(self):
+        """The keys the agent holds, as (blob, comment) pairs."""
+        kind, body = self.request(SSH2_AGENTC_REQUEST_IDENTITIES)
+        if kind != SSH2_AGENT_IDENTITIES_ANSWER:
+            raise AgentError("ssh-agent refused to list its keys")
+        r = ssh.Reader(body)
+        return [(r.string(), r.text()) for _ in range(r.uint32())]
+
+    def sign(self, blob, data):
+        """Have the agent sign the data with the key, returning the
+        signature type and blob."""
+        kind, body = self.request(SSH2_AGENTC_SIGN_REQUEST,
+                ssh.pack_string(blob) + ssh.pack_string(data) +
+                ssh.pack_uint32(0))
+        if kind == SSH_AGENT_FAILURE:
+            raise AgentError("ssh-agent refused to sign")
+        if kind != SSH2_AGENT_SIGN_RESPONSE:
+            raise AgentError("Invalid reply from ssh-agent")
+        r = ssh.Reader(ssh.Reader(body).string())
+        return r.text(), r.string()
+
+def find_identity(identities, name):
+    """The blob of the key with the given comment or fingerprint."""
+    matches = [blob for blob, comment in identities
+               if name in (comment, ssh.fingerprint(blob))]
+    if not matches:
+        raise AgentError("No key {} in ssh-agent".format(name))
+    if len(matches) > 1:
+        raise AgentError("Several keys in ssh-agent match {}, use its "
+                         "fingerprint".format(name))
+    return matches[0]
+
+class AgentKey(object):
+    """A key held by ssh-agent.  It behaves as the public key, except
+    that it can sign, by asking the agent."""
+
+    def __init__(self, agent, blob, public):
+        self.agent = agent
+        self.blob = blob
+        self.public = public
+
+    def __getattr__(self, name):
+        return getattr(self.public, name)
+
+    def zeroize(self):
+        """There is nothing secret here to wipe."""
+        self.agent.close()
+
+    def sig_hashes(self):
+        # ssh-agent hashes what it signs with ECDSA keys itself, with
+        # the hash of the curve.
+        if isinstance(self.public, ECDSAPublic):
+            return self.public.sig_hashes()[:1]
+        return self.public.sig_hashes()
+
+    def sign(self, payload, sha='256', deterministic=False):
+        if isinstance(self.public, ECDSAPublic):
+            if deterministic:
+                raise AgentError("ssh-agent makes ECDSA signatures with a "
+                                 "random nonce, so they can't be "
+                                 "deterministic")
+            if sha not in self.sig_hashes():
+                raise AgentError("ssh-agent can't sign the SHA{} hash with "
+                                 "this key".format(sha))
+            kind, sig = self.agent.sign(self.blob, payload)
+            if kind != ssh.key_type(self.blob):
+                raise AgentError("ssh-agent gave a {} signature".format(kind))
+            r = ssh.Reader(sig)
+            der = encode_dss_signature(r.mpint(), r.mpint())
+            try:
+                self.public.key.verify(der, payload,
+                                       ec.ECDSA(self.public.hash_alg()))
+            except InvalidSignature:
+                raise AgentError("ssh-agent gave an invalid signature")
+            # Pad to a fixed length, as the ECDSA keys do.
+            return der + b'\000' * (self.sig_len() - len(der))
+        # Ed25519 signs the hash of the image.
+        digest = hashlib.new('sha' + sha, payload).digest()
+        kind, sig = self.agent.sign(self.blob, digest)
+        if kind != 'ssh-ed25519':
+            raise AgentError("ssh-agent gave a {} signature".format(kind))
+        try:
+            self.public.key.verify(sig, digest)
+        except InvalidSignature:
+            raise AgentError("ssh-agent gave an invalid signature")
+        return sig
+
+def load(ref, wrap, path=None):
+    """The key named by an "agent:" reference.  wrap turns the public
+    key into the key class for its type."""
+    name = ref[len(AGENT_PREFIX):]
+    agent = Agent(path)
+    try:
+        blob = find_identity(agent.identities(), name)
+        public = wrap(ssh.public_key_from_blob(blob))
+    except KeyUsageError:
+        agent.close()
+        raise
+    return AgentKey(agent, blob, public)
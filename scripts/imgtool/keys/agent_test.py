@@ -0,0 +1,214 @@
+"""
+Tests for signing with ssh-agent, against a mock agent
+"""
+
+import hashlib
+import os
+import socket
+import struct
+import sys
+import tempfile
+import threading
+import unittest
+
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import ec, ed25519, rsa
+from cryptography.hazmat.primitives.asymmetric.utils import decode_dss_signature
+from cryptography.hazmat.primitives.hashes import SHA256, SHA384
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import agent, load_agent, ssh, AgentError, AgentKey
+
+def key_blob(pk):
+    """The SSH public key blob of a cryptography private key."""
+    pub = pk.public_key()
+    if isinstance(pk, ec.EllipticCurvePrivateKey):
+        name = {'secp256r1': 'nistp256', 'secp384r1': 'nistp384'}[pk.curve.name]
+        point = pub.public_bytes(serialization.Encoding.X962,
+                                 serialization.PublicFormat.UncompressedPoint)
+        return (ssh.pack_string('ecdsa-sha2-' + name) + ssh.pack_string(name) +
+                ssh.pack_string(point))
+    if isinstance(pk, ed25519.Ed25519PrivateKey):
+        raw = pub.public_bytes(serialization.Encoding.Raw,
+                               serialization.PublicFormat.Raw)
+        return ssh.pack_string('ssh-ed25519') + ssh.pack_string(raw)
+    nums = pub.public_numbers()
+    return (ssh.pack_string('ssh-rsa') + ssh.pack_mpint(nums.e) +
+            ssh.pack_mpint(nums.n))
+
+class MockAgent(object):
+    """Enough of ssh-agent to list keys and sign with them, serving on
+    a socket in a temporary directory.  With refuse set, every signing
+    request fails, and with corrupt set, signatures are wrong."""
+
+    def __init__(self, keys):
+        self.keys = keys
+        self.refuse = False
+        self.corrupt = False
+        self.dir = tempfile.TemporaryDirectory()
+        self.path = os.path.join(self.dir.name, 'agent.sock')
+        self.server = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        self.server.bind(self.path)
+        self.server.listen(5)
+        self.thread = threading.Thread(target=self._serve, daemon=True)
+        self.thread.start()
+
+    def close(self):
+        self.server.close()
+        self.dir.cleanup()
+
+    def _serve(self):
+        while True:
+            try:
+                conn, _ = self.server.accept()
+            except OSError:
+                return
+            threading.Thread(target=self._handle, args=(conn,),
+                             daemon=True).start()
+
+    def _recv(self, conn, n):
+        data = b''
+        while len(data) < n:
+            chunk = conn.recv(n - len(data))
+            if not chunk:
+                return None
+            data += chunk
+        return data
+
+    def _handle(self, conn):
+        with conn:
+            while True:
+                head = self._recv(conn, 4)
+                if head is None:
+                    return
+                msg = self._recv(conn, struct.unpack('>I', head)[0])
+                reply = self._reply(msg[0], ssh.Reader(msg[1:]))
+                conn.sendall(struct.pack('>I', len(reply)) + reply)
+
+    def _reply(self, kind, r):
+        if kind == agent.SSH2_AGENTC_REQUEST_IDENTITIES:
+            body = ssh.pack_uint32(len(self.keys))
+            for pk, comment in self.keys:
+                body += ssh.pack_string(key_blob(pk)) + ssh.pack_string(comment)
+            return bytes([agent.SSH2_AGENT_IDENTITIES_ANSWER]) + body
+        if kind == agent.SSH2_AGENTC_SIGN_REQUEST and not self.refuse:
+            blob, data = r.string(), r.string()
+            for pk, _ in self.keys:
+                if key_blob(pk) == blob:
+                    sig = self._sign(pk, data)
+                    return (bytes([agent.SSH2_AGENT_SIGN_RESPONSE]) +
+                            ssh.pack_string(sig))
+        return bytes([agent.SSH_AGENT_FAILURE])
+
+    def _sign(self, pk, data):
+        if self.corrupt:
+            data = b'not ' + data
+        kind = ssh.key_type(key_blob(pk))
+        if isinstance(pk, ec.EllipticCurvePrivateKey):
+            hash_alg = SHA256() if pk.curve.name == 'secp256r1' else SHA384()
+            r, s = decode_dss_signature(pk.sign(data, ec.ECDSA(hash_alg)))
+            sig = ssh.pack_mpint(r) + ssh.pack_mpint(s)
+        else:
+            sig = pk.sign(data)
+        return ssh.pack_string(kind) + ssh.pack_string(sig)
+
+class AgentSigning(unittest.TestCase):
+
+    def setUp(self):
+        self.p256 = ec.generate_private_key(ec.SECP256R1())
+        self.ed25519 = ed25519.Ed25519PrivateKey.generate()
+        self.rsa = rsa.generate_private_key(public_exponent=65537, key_size=2048)
+        self.mock = MockAgent([(self.p256, 'release-p256'),
+                               (self.ed25519, 'release-ed25519'),
+                               (self.rsa, 'old-rsa')])
+
+    def tearDown(self):
+        self.mock.close()
+
+    def load(self, name):
+        return load_agent('agent:' + name, path=self.mock.path)
+
+    def test_identities(self):
+        a = agent.Agent(self.mock.path)
+        self.assertEqual([c for _, c in a.identities()],
+                         ['release-p256', 'release-ed25519', 'old-rsa'])
+        a.close()
+
+    def test_sign_ecdsa(self):
+        k = self.load('release-p256')
+        self.assertIsInstance(k, AgentKey)
+        self.assertEqual(k.sig_tlv(), 'ECDSASIG')
+        # The keyhash is of the agent's key.
+        self.assertEqual(k.get_public_bytes(), self.p256.public_key().public_bytes(
+                serialization.Encoding.DER,
+                serialization.PublicFormat.SubjectPublicKeyInfo))
+        payload = b'This is the image'
+        sig = k.sign(payload)
+        self.assertEqual(len(sig), k.sig_len())
+        # Drop the padding after the DER signature.
+        self.p256.public_key().verify(sig[:2 + sig[1]], payload,
+                                      ec.ECDSA(SHA256()))
+        k.zeroize()
+
+    def test_sign_ed25519(self):
+        k = self.load('release-ed25519')
+        self.assertEqual(k.sig_tlv(), 'ED25519')
+        payload = b'This is the image'
+        sig = k.sign(payload)
+        self.ed25519.public_key().verify(sig, hashlib.sha256(payload).digest())
+        k.zeroize()
+
+    def test_fingerprint(self):
+        blob = key_blob(self.ed25519)
+        k = self.load(ssh.fingerprint(blob))
+        self.assertEqual(k.blob, blob)
+        k.zeroize()
+
+    def test_not_found(self):
+        with self.assertRaises(AgentError) as cm:
+            self.load('missing')
+        self.assertIn('No key missing in ssh-agent', str(cm.exception))
+
+    def test_rsa_refused(self):
+        with self.assertRaises(Exception) as cm:
+            self.load('old-rsa')
+        self.assertIn('only ECDSA and Ed25519', str(cm.exception))
+
+    def test_agent_refuses(self):
+        self.mock.refuse = True
+        k = self.load('release-p256')
+        with self.assertRaises(AgentError) as cm:
+            k.sign(b'payload')
+        self.assertIn('refused to sign', str(cm.exception))
+        k.zeroize()
+
+    def test_bad_signature(self):
+        self.mock.corrupt = True
+        for name in ['release-p256', 'release-ed25519']:
+            k = self.load(name)
+            with self.assertRaises(AgentError) as cm:
+                k.sign(b'payload')
+            self.assertIn('invalid signature', str(cm.exception))
+            k.zeroize()
+
+class NoAgent(unittest.TestCase):
+
+    def test_not_set(self):
+        saved = os.environ.pop('SSH_AUTH_SOCK', None)
+        try:
+            with self.assertRaises(AgentError) as cm:
+                load_agent('agent:key')
+            self.assertIn('SSH_AUTH_SOCK is not set', str(cm.exception))
+        finally:
+            if saved is not None:
+                os.environ['SSH_AUTH_SOCK'] = saved
+
+    def test_not_running(self):
+        with tempfile.TemporaryDirectory() as d:
+            with self.assertRaises(AgentError) as cm:
+                load_agent('agent:key', path=os.path.join(d, 'gone.sock'))
+            self.assertIn("Can't connect to ssh-agent", str(cm.exception))
+
+if __name__ == '__main__':
+    unittest.main()
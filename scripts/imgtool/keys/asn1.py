@@ -0,0 +1,78 @@
+"""
+A minimal DER reader, for the parts of key files the crypto library
+won't parse for us, and writer, for those it won't write.
+"""
+
+INTEGER = 0x02
+BIT_STRING = 0x03
+OCTET_STRING = 0x04
+NULL = 0x05
+OID = 0x06
+SEQUENCE = 0x30
+
+def context(n, constructed=True):
+    """The tag of a [n] context specific field."""
+    return 0x80 | (0x20 if constructed else 0) | n
+
+class DERError(ValueError):
+    pass
+
+def read(data, off=0):
+    """Read the element at off, returning its tag, its contents, and the
+    offset after it."""
+    if off + 2 > len(data):
+        raise DERError("Truncated DER")
+    tag = data[off]
+    length = data[off + 1]
+    off += 2
+    if length & 0x80:
+        count = length & 0x7f
+        if count == 0 or count > 4 or off + count > len(data):
+            raise DERError("Invalid DER length")
+        length = int.from_bytes(data[off:off + count], 'big')
+        off += count
+    if off + length > len(data):
+        raise DERError("Truncated DER")
+    return tag, data[off:off + length], off + length
+
+def read_all(data):
+    """Read the elements making up the contents of a SEQUENCE."""
+    items = []
+    off = 0
+    while off < len(data):
+        tag, value, off = read(data, off)
+        items.append((tag, value))
+    return items
+
+def expect(data, tag):
+    """Read a single element of the given tag, covering all of data."""
+    got, value, end = read(data)
+    if got != tag or end != len(data):
+        raise DERError("Expected DER tag 0x{:02x}".format(tag))
+    return value
+
+def to_int(value):
+    return int.from_bytes(value, 'big')
+
+def decode_oid(value):
+    """The dotted form of an OBJECT IDENTIFIER."""
+    if not value:
+        raise DERError("Empty OID")
+    parts = [min(value[0] // 40, 2)]
+    parts.append(value[0] - parts[0] * 40)
+    n = 0
+    for b in value[1:]:
+        n = (n << 7) | (b & 0x7f)
+        if not b & 0x80:
+            parts.append(n)
+            n = 0
+    return '.'.join(str(p) for p in parts)
+
+def encode(tag, value):
+    """An element of the given tag, holding value."""
+    if len(value) < 0x80:
+        length = bytes([len(value)])
+    else:
+        size = (len(value).bit_length() + 7) // 8
+        length = bytes([0x80 | size]) + len(value).to_bytes(size, 'big')
+    return bytes([tag]) + length + bytes(value)
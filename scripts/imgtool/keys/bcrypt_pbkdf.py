@@ -0,0 +1,133 @@
+"""
+bcrypt_pbkdf, the key derivation OpenSSH uses for encrypted private
+keys, as in OpenBSD's bcrypt_pbkdf.c.
+
+The bcrypt package does this far faster, and is used when it is
+installed.  Otherwise this pure Python version is used, which takes a
+few seconds for each round ssh-keygen asks for.
+"""
+
+import hashlib
+import struct
+
+try:
+    import bcrypt as _bcrypt
+except ImportError:
+    _bcrypt = None
+
+MASK = 0xffffffff
+
+def _pi_words(count):
+    """The first words of the fraction of pi, in hex, which is what
+    Blowfish starts its P-array and S-boxes from."""
+    bits = 32 * count + 64
+    one = 1 << bits
+    def arctan_inv(x):
+        # arctan(1/x) = 1/x - 1/3x^3 + 1/5x^5 - ...
+        total = term = one // x
+        n, sign = 1, 1
+        while term:
+            term //= x * x
+            n += 2
+            sign = -sign
+            total += sign * (term // n)
+        return total
+    # Machin's formula.
+    pi = 16 * arctan_inv(5) - 4 * arctan_inv(239)
+    frac = (pi >> 64) & ((1 << (32 * count)) - 1)
+    return [(frac >> (32 * (count - 1 - i))) & MASK for i in range(count)]
+
+_INIT = _pi_words(18 + 4 * 256)
+INIT_P = _INIT[:18]
+INIT_S = _INIT[18:]
+
+class _Blowfish(object):
+    """The Blowfish state, with the four S-boxes in one list."""
+
+    def __init__(self):
+        self.p = list(INIT_P)
+        self.s = list(INIT_S)
+
+    def encrypt(self, l, r):
+        p, s = self.p, self.s
+        for i in range(0, 16, 2):
+            l ^= p[i]
+            r ^= ((((s[l >> 24] + s[256 | (l >> 16) & 0xff]) & MASK) ^
+                   s[512 | (l >> 8) & 0xff]) + s[768 | l & 0xff]) & MASK
+            r ^= p[i + 1]
+            l ^= ((((s[r >> 24] + s[256 | (r >> 16) & 0xff]) & MASK) ^
+                   s[512 | (r >> 8) & 0xff]) + s[768 | r & 0xff]) & MASK
+        return r ^ p[17], l ^ p[16]
+
+    def expand(self, key, data=None):
+        """The Blowfish key schedule, mixing the salt in too, for the
+        expensive schedule of bcrypt."""
+        keywords = _words(key, 18)
+        for i in range(18):
+            self.p[i] ^= keywords[i]
+        datawords = _words(data, 18 + 1024) if data else None
+        l = r = 0
+        j = 0
+        for table, size in [(self.p, 18), (self.s, 1024)]:
+            for i in range(0, size, 2):
+                if datawords:
+                    l ^= datawords[j]
+                    r ^= datawords[j + 1]
+                    j += 2
+                l, r = self.encrypt(l, r)
+                table[i] = l
+                table[i + 1] = r
+
+def _words(data, count):
+    """Big-endian words taken from the data, cycling around it."""
+    stream = data * (4 * count // len(data) + 1)
+    return list(struct.unpack('>{}I'.format(count), stream[:4 * count]))
+
+# The text bcrypt encrypts, as OpenSSH chose it.
+MAGIC = b'OxychromaticBlowfishSwatDynamite'
+
+def _hash(sha2pass, sha2salt):
+    bf = _Blowfish()
+    bf.expand(sha2pass, sha2salt)
+    for _ in range(64):
+        bf.expand(sha2salt)
+        bf.expand(sha2pass)
+    cdata = list(struct.unpack('>8I', MAGIC))
+    for _ in range(64):
+        for i in range(0, 8, 2):
+            cdata[i], cdata[i + 1] = bf.encrypt(cdata[i], cdata[i + 1])
+    return struct.pack('<8I', *cdata)
+
+def kdf(passwd, salt, size, rounds):
+    """Derive size bytes from the passphrase and salt."""
+    if rounds < 1 or not salt or size < 1:
+        raise ValueError("Invalid bcrypt_pbkdf parameters")
+    if _bcrypt is not None:
+        return _bcrypt.kdf(bytes(passwd), bytes(salt), size, rounds,
+                           ignore_few_rounds=True)
+    # The output is spread across the blocks, so that all of them are
+    # needed for any part of it.
+    stride = (size + 31) // 32
+    amount = (size + stride - 1) // stride
+    sha2pass = hashlib.sha512(passwd).digest()
+    key = bytearray(size)
+    count = 1
+    remaining = size
+    while remaining > 0:
+        sha2salt = hashlib.sha512(bytes(salt) + struct.pack('>I', count)).digest()
+        tmp = _hash(sha2pass, sha2salt)
+        out = bytearray(tmp)
+        for _ in range(rounds - 1):
+            tmp = _hash(sha2pass, hashlib.sha512(tmp).digest())
+            for i in range(32):
+                out[i] ^= tmp[i]
+        written = 0
+        for i in range(min(amount, remaining)):
+            dest = i * stride + (count - 1)
+            if dest >= size:
+                break
+            key[dest] = out[i]
+            written += 1
+        remaining -= written
+        count += 1
+    return bytes(key)
@@ -0,0 +1,88 @@
+"""
+X.509 certificates as the source of a public key, for a PKI that hands
+out the firmware verification key as a certificate.  Only the key is
+used: nothing checks who signed the certificate.
+"""
+
+import datetime
+
+from cryptography import x509
+from cryptography.exceptions import UnsupportedAlgorithm
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.asymmetric import ec, ed25519, rsa, x25519
+
+from .ecdsa import ECDSA_CURVES
+from .general import KeyUsageError
+from . import asn1, pem
+
+class CertificateError(KeyUsageError):
+    pass
+
+def load(raw):
+    """The certificate in raw, a PEM file with a "CERTIFICATE" block and
+    no keys, or DER, otherwise None."""
+    if b'-----BEGIN' in raw:
+        if b'-----BEGIN CERTIFICATE-----' not in raw or pem.key_blocks(raw):
+            return None
+        try:
+            return x509.load_pem_x509_certificate(bytes(raw), default_backend())
+        except ValueError as e:
+            raise CertificateError("Invalid certificate: {}".format(e))
+    # Look at the structure first, so that a DER private key isn't
+    # copied to bytes that can't be wiped.
+    try:
+        items = asn1.read_all(asn1.expect(raw, asn1.SEQUENCE))
+    except asn1.DERError:
+        return None
+    if [tag for tag, _ in items] != [asn1.SEQUENCE, asn1.SEQUENCE,
+                                     asn1.BIT_STRING]:
+        return None
+    try:
+        return x509.load_der_x509_certificate(bytes(raw), default_backend())
+    except ValueError as e:
+        raise CertificateError("Invalid certificate: {}".format(e))
+
+def public_key(certificate):
+    """The cryptography public key of the certificate, once checked to be
+    of a type MCUboot verifies images with, or encrypts them to."""
+    try:
+        pk = certificate.public_key()
+    except (UnsupportedAlgorithm, ValueError):
+        pk = None
+    if isinstance(pk, (rsa.RSAPublicKey, ed25519.Ed25519PublicKey,
+                       x25519.X25519PublicKey)):
+        return pk
+    if isinstance(pk, ec.EllipticCurvePublicKey):
+        if pk.curve.name in ECDSA_CURVES:
+            return pk
+        name = "an EC key on {}".format(pk.curve.name)
+    elif pk is None:
+        oid = getattr(certificate, 'public_key_algorithm_oid', None)
+        name = "a key of algorithm {}".format(
+                oid.dotted_string if oid is not None else "unknown")
+    else:
+        name = "a {} key".format(type(pk).__name__.replace('PublicKey', ''))
+    raise CertificateError(
+            "The certificate holds {}, which MCUboot doesn't support".format(
+                name))
+
+def _validity(certificate):
+    """The validity period, as aware datetimes."""
+    if hasattr(certificate, 'not_valid_before_utc'):
+        return certificate.not_valid_before_utc, certificate.not_valid_after_utc
+    return (certificate.not_valid_before.replace(tzinfo=datetime.timezone.utc),
+            certificate.not_valid_after.replace(tzinfo=datetime.timezone.utc))
+
+def validity_problem(certificate, now=None):
+    """A warning to give if the certificate has expired or isn't valid
+    yet, otherwise None."""
+    if now is None:
+        now = datetime.datetime.now(datetime.timezone.utc)
+    before, after = _validity(certificate)
+    if now < before:
+        return "The certificate is not valid until {}".format(
+                before.strftime('%Y-%m-%d %H:%M:%S UTC'))
+    if now > after:
+        return "The certificate expired on {}".format(
+                after.strftime('%Y-%m-%d %H:%M:%S UTC'))
+    return None
@@ -0,0 +1,102 @@
+"""
+Tests for reading the public key of an X.509 certificate
+"""
+
+import datetime
+import os
+import sys
+import unittest
+
+from cryptography import x509
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives import hashes, serialization
+from cryptography.hazmat.primitives.asymmetric import ec, ed448, rsa
+from cryptography.x509.oid import NameOID
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import (cert, info, load_bytes, CertificateError,
+                          ECDSA256P1Public, RSAPublic)
+
+DAY = datetime.timedelta(days=1)
+
+def make_cert(pk, not_before=-DAY, not_after=DAY):
+    """A self-signed certificate for the public half of pk, valid for
+    the given times from now."""
+    now = datetime.datetime.now(datetime.timezone.utc)
+    name = x509.Name([x509.NameAttribute(NameOID.COMMON_NAME, 'imgtool test')])
+    # Ed448 signs without a separate hash.
+    algorithm = None
+    if not isinstance(pk, ed448.Ed448PrivateKey):
+        algorithm = hashes.SHA256()
+    return (x509.CertificateBuilder()
+            .subject_name(name)
+            .issuer_name(name)
+            .public_key(pk.public_key())
+            .serial_number(1)
+            .not_valid_before(now + not_before)
+            .not_valid_after(now + not_after)
+            .sign(pk, algorithm, default_backend()))
+
+def encode(certificate, encoding):
+    return certificate.public_bytes(encoding)
+
+class Certificates(unittest.TestCase):
+
+    def setUp(self):
+        self.ec = ec.generate_private_key(ec.SECP256R1(), default_backend())
+        self.rsa = rsa.generate_private_key(65537, 2048, default_backend())
+
+    def test_public_key(self):
+        for pk, cls in [(self.ec, ECDSA256P1Public), (self.rsa, RSAPublic)]:
+            c = make_cert(pk)
+            want = load_bytes(pk.public_key().public_bytes(
+                    serialization.Encoding.PEM,
+                    serialization.PublicFormat.SubjectPublicKeyInfo)
+                    ).get_public_bytes()
+            for encoding in [serialization.Encoding.PEM,
+                             serialization.Encoding.DER]:
+                k = load_bytes(encode(c, encoding))
+                self.assertIsInstance(k, cls)
+                self.assertEqual(k.get_public_bytes(), want)
+                self.assertEqual(k.certificate, c)
+
+    def test_key_before_certificate(self):
+        """A key file with its certificate gives the key."""
+        raw = self.ec.private_bytes(
+                serialization.Encoding.PEM,
+                serialization.PrivateFormat.PKCS8,
+                serialization.NoEncryption())
+        raw += encode(make_cert(self.ec), serialization.Encoding.PEM)
+        k = load_bytes(raw)
+        self.assertIsNone(k.certificate)
+        self.assertIsNotNone(k.key.private_numbers())
+
+    def test_unsupported(self):
+        for pk in [ec.generate_private_key(ec.SECP256K1(), default_backend()),
+                   ed448.Ed448PrivateKey.generate()]:
+            raw = encode(make_cert(pk), serialization.Encoding.PEM)
+            with self.assertRaises(CertificateError) as cm:
+                load_bytes(raw)
+            self.assertIn("MCUboot doesn't support", str(cm.exception))
+
+    def test_validity(self):
+        self.assertIsNone(cert.validity_problem(make_cert(self.ec)))
+        expired = make_cert(self.ec, -2 * DAY, -DAY)
+        self.assertIn('expired', cert.validity_problem(expired))
+        future = make_cert(self.ec, DAY, 2 * DAY)
+        self.assertIn('not valid until', cert.validity_problem(future))
+        # The key is still read, for the caller to warn about.
+        k = load_bytes(encode(expired, serialization.Encoding.DER))
+        self.assertIsInstance(k, ECDSA256P1Public)
+
+    def test_keyinfo(self):
+        c = make_cert(self.rsa)
+        for encoding, name in [(serialization.Encoding.PEM, 'PEM'),
+                               (serialization.Encoding.DER, 'DER')]:
+            fmt = info.file_format(encode(c, encoding))
+            self.assertEqual(fmt['format'], 'X.509')
+            self.assertEqual(fmt['encoding'], name)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -2,51 +2,236 @@
 ECDSA key management
 """
 
+from cryptography.exceptions import InvalidSignature, UnsupportedAlgorithm
 from cryptography.hazmat.backends import default_backend
 from cryptography.hazmat.primitives import serialization
 from cryptography.hazmat.primitives.asymmetric import ec
-from cryptography.hazmat.primitives.hashes import SHA256
+from cryptography.hazmat.primitives.asymmetric.utils import Prehashed
+from cryptography.hazmat.primitives.hashes import SHA256, SHA384, SHA512
 
-from .general import KeyClass
+from .general import KeyClass, KeyUsageError, export_private_key
+from .keyfile import write_public
+from . import asn1, jwk, seeded
 
-class ECDSAUsageError(Exception):
+class ECDSAUsageError(KeyUsageError):
     pass
 
-class ECDSA256P1Public(KeyClass):
+# The hash of each sign --sha.
+SIG_HASHES = {'256': SHA256, '384': SHA384, '512': SHA512}
+
+# How getpub can write the point of the public key, as SEC1 describes.
+# MCUboot only takes uncompressed points.
+POINT_FORMATS = ('uncompressed', 'compressed')
+
+# The JWK names of the curves, from RFC 7518.
+JWK_CURVES = {
+        'secp256r1': 'P-256',
+        'secp384r1': 'P-384',
+        'secp521r1': 'P-521',
+}
+
+class ECDSAPublic(KeyClass):
+    """Operations common to ECDSA public keys on any curve.  Subclasses
+    give the curve, and the hash used with it."""
+    curve = None
+    hash_alg = SHA256
+
     def __init__(self, key):
         self.key = key
 
     def shortname(self):
         return "ecdsa"
 
+    def sig_hashes(self):
+        return [str(self.hash_alg.digest_size * 8)]
+
     def _unsupported(self, name):
         raise ECDSAUsageError("Operation {} requires private key".format(name))
 
     def _get_public(self):
         return self.key
 
-    def get_public_bytes(self):
+    def get_public_bytes(self, point_format='uncompressed'):
         # The key is embedded into MBUboot in "SubjectPublicKeyInfo" format
-        return self._get_public().public_bytes(
+        spki = self._get_public().public_bytes(
                 encoding=serialization.Encoding.DER,
                 format=serialization.PublicFormat.SubjectPublicKeyInfo)
+        if self._point_compressed(point_format):
+            # The crypto library only writes uncompressed points here,
+            # so swap in the compressed one.
+            algorithm = asn1.read_all(asn1.expect(spki, asn1.SEQUENCE))[0][1]
+            spki = asn1.encode(asn1.SEQUENCE,
+                               asn1.encode(asn1.SEQUENCE, algorithm) +
+                               asn1.encode(asn1.BIT_STRING,
+                                           b'\x00' + self.compressed_point()))
+        return spki
+
+    def verify_digest(self, sig, digest, sha=None):
+        """Whether sig, as sign_digest gives it, padded, is a signature
+        of digest, the hash of the image with the curve's own hash, or
+        the one sha gives, by this key."""
+        hash_alg = SIG_HASHES[sha] if sha else self.hash_alg
+        try:
+            # The padding after the DER signature is left out.
+            _, _, end = asn1.read(sig)
+            self._get_public().verify(bytes(sig[:end]), digest,
+                                      ec.ECDSA(Prehashed(hash_alg())))
+        except (asn1.DERError, InvalidSignature):
+            return False
+        return True
 
-    def export_private(self, path, passwd=None):
+    def _point_compressed(self, point_format):
+        if point_format not in POINT_FORMATS:
+            raise ECDSAUsageError("Unknown point format: {}".format(
+                point_format))
+        return point_format == 'compressed'
+
+    def compressed_point(self):
+        """The SEC1 compressed point: 0x02 if Y is even, or 0x03 if it is
+        odd, then X padded to the size of the curve."""
+        size = (self.curve.key_size + 7) // 8
+        nums = self._get_public().public_numbers()
+        return bytes([0x02 | (nums.y & 1)]) + nums.x.to_bytes(size, 'big')
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
         self._unsupported('export_private')
 
-    def export_public(self, path):
+    def get_raw_public_bytes(self, point_prefix=False,
+                             point_format='uncompressed'):
+        """The uncompressed point, X then Y, each padded to the size of
+        the curve, as Tinycrypt takes it.  With point_prefix, it starts
+        with the 0x04 that marks an uncompressed point.  A compressed
+        point always starts with its prefix, which holds the parity of
+        Y."""
+        if self._point_compressed(point_format):
+            if point_prefix:
+                raise ECDSAUsageError(
+                        "A compressed point always has its prefix")
+            return self.compressed_point()
+        point = self._get_public().public_bytes(
+                encoding=serialization.Encoding.X962,
+                format=serialization.PublicFormat.UncompressedPoint)
+        return point if point_prefix else point[1:]
+
+    def export_public(self, path, overwrite=True):
         """Write the public key to the given file."""
-        pem = self._get_public().public_bytes(
-                encoding=serialization.Encoding.PEM,
-                format=serialization.PublicFormat.SubjectPublicKeyInfo)
-        with open(path, 'wb') as f:
-            f.write(pem)
+        write_public(path, self.public_pem(), overwrite=overwrite)
+
+    def _jwk_members(self):
+        crv = JWK_CURVES.get(self.curve.name)
+        if crv is None:
+            raise ECDSAUsageError("The {} curve has no JWK encoding".format(
+                self.curve.name))
+        # The coordinates are always the full size of the field.
+        size = (self.curve.key_size + 7) // 8
+        nums = self._get_public().public_numbers()
+        return {'kty': 'EC',
+                'crv': crv,
+                'x': jwk.b64url(jwk.uint_bytes(nums.x, size)),
+                'y': jwk.b64url(jwk.uint_bytes(nums.y, size))}
+
+class ECDSAPrivate(object):
+    """Private key operations, mixed in ahead of one of the public
+    classes, which provides the curve."""
+
+    def __init__(self, key):
+        """key should be an instance of EllipticCurvePrivateKey"""
+        self.key = key
+
+    @classmethod
+    def generate(cls, seed=None):
+        """Generate a new key.  If a seed is given, the key is derived
+        from it, which is only suitable for testing."""
+        if seed is not None:
+            return cls(seeded.ec_private_key(seed, cls.curve()))
+        pk = ec.generate_private_key(
+                cls.curve(),
+                backend=default_backend())
+        return cls(pk)
+
+    def _get_public(self):
+        return self.key.public_key()
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        """Write the private key to the given file, protecting it with the optional password."""
+        export_private_key(self.key, path, passwd=passwd, format=format,
+                           overwrite=overwrite, encoding=encoding,
+                           metadata=metadata)
+
+    def raw_sign(self, payload, sha=None, deterministic=False,
+                 prehashed=False):
+        """Return the actual signature, of the hash of the payload with
+        the curve's own hash, or the one sha gives, or of the payload
+        itself, that hash already, with prehashed.  With deterministic,
+        the nonce is derived from the key and the hash, as RFC 6979
+        gives it, rather than random, so the same payload always has the
+        same signature."""
+        hash_alg = SIG_HASHES[sha] if sha else self.hash_alg
+        hash_alg = Prehashed(hash_alg()) if prehashed else hash_alg()
+        if not deterministic:
+            algorithm = ec.ECDSA(hash_alg)
+        else:
+            try:
+                algorithm = ec.ECDSA(hash_alg, deterministic_signing=True)
+            except (TypeError, UnsupportedAlgorithm):
+                # Older cryptography has no deterministic_signing, and
+                # it is unsupported below OpenSSL 3.2.
+                raise ECDSAUsageError(
+                        "Deterministic ECDSA signatures need cryptography "
+                        "44 or later, built with OpenSSL 3.2 or later")
+        return self.key.sign(data=payload, signature_algorithm=algorithm)
+
+    def sign(self, payload, sha=None, deterministic=False):
+        # To make fixed length, pad with one or two zeros.
+        sig = self.raw_sign(payload, sha, deterministic)
+        sig += b'\000' * (self.sig_len() - len(sig))
+        return sig
+
+    def sign_digest(self, digest, sha=None, deterministic=False):
+        """The signature sign gives of an image whose hash, with the
+        hash sha gives, is digest, for an image too big to hold."""
+        sig = self.raw_sign(digest, sha, deterministic, prehashed=True)
+        sig += b'\000' * (self.sig_len() - len(sig))
+        return sig
+
+class ECDSA224P1Public(ECDSAPublic):
+    curve = ec.SECP224R1
+
+    def sig_type(self):
+        return "ECDSA224_SHA256"
+
+    def sig_tlv(self):
+        return "ECDSA224"
+
+    def sig_len(self):
+        # Allow for the largest DER encoding, as with P-256.
+        return 64
+
+    def deprecated(self):
+        return ("P-224 keys are deprecated, the bootloader no longer "
+                "supports them, and won't boot images signed with them")
+
+class ECDSA224P1(ECDSAPrivate, ECDSA224P1Public):
+    """
+    Wrapper around an ECDSA P-224 private key.
+    """
+    pass
+
+class ECDSA256P1Public(ECDSAPublic):
+    curve = ec.SECP256R1
 
     def sig_type(self):
         return "ECDSA256_SHA256"
 
     def sig_tlv(self):
-        return "ECDSA256"
+        return "ECDSASIG"
+
+    def sig_hashes(self):
+        # SHA512 is truncated to the 256 bits of the curve's order, as
+        # ECDSA does with a longer hash.
+        return ['256', '512']
 
     def sig_len(self):
         # The DER encoding depends on the high bit, and can be
@@ -57,46 +242,80 @@ class ECDSA256P1Public(KeyClass):
         # signature.
         return 72
 
-class ECDSA256P1(ECDSA256P1Public):
+class ECDSA256P1(ECDSAPrivate, ECDSA256P1Public):
     """
-    Wrapper around an ECDSA private key.
+    Wrapper around an ECDSA P-256 private key.
     """
+    pass
 
-    def __init__(self, key):
-        """key should be an instance of EllipticCurvePrivateKey"""
-        self.key = key
+class ECDSA384P1Public(ECDSAPublic):
+    curve = ec.SECP384R1
+    hash_alg = SHA384
 
-    @staticmethod
-    def generate():
-        pk = ec.generate_private_key(
-                ec.SECP256R1(),
-                backend=default_backend())
-        return ECDSA256P1(pk)
+    def sig_type(self):
+        return "ECDSA384_SHA384"
 
-    def _get_public(self):
-        return self.key.public_key()
+    def sig_tlv(self):
+        # The same TLV as P-256, the bootloader knowing the curve from
+        # its key, and the hash, SHA384, from the hash TLV.
+        return "ECDSASIG"
 
-    def export_private(self, path, passwd=None):
-        """Write the private key to the given file, protecting it with the optional password."""
-        if passwd is None:
-            enc = serialization.NoEncryption()
-        else:
-            enc = serialization.BestAvailableEncryption(passwd)
-        pem = self.key.private_bytes(
-                encoding=serialization.Encoding.PEM,
-                format=serialization.PrivateFormat.PKCS8,
-                encryption_algorithm=enc)
-        with open(path, 'wb') as f:
-            f.write(pem)
-
-    def raw_sign(self, payload):
-        """Return the actual signature"""
-        return self.key.sign(
-                data=payload,
-                signature_algorithm=ec.ECDSA(SHA256()))
-
-    def sign(self, payload):
-        # To make fixed length, pad with one or two zeros.
-        sig = self.raw_sign(payload)
-        sig += b'\000' * (self.sig_len() - len(sig))
-        return sig
+    def sig_len(self):
+        # As with P-256, allow for the largest DER encoding.
+        return 104
+
+class ECDSA384P1(ECDSAPrivate, ECDSA384P1Public):
+    """
+    Wrapper around an ECDSA P-384 private key.
+    """
+    pass
+
+class ECDSA521P1Public(ECDSAPublic):
+    curve = ec.SECP521R1
+    hash_alg = SHA512
+
+    def sig_type(self):
+        return "ECDSA521_SHA512"
+
+    def sig_tlv(self):
+        raise ECDSAUsageError("Signing with P-521 keys is not supported")
+
+    def sig_len(self):
+        # The order is 521 bits, so each integer is at most 66 bytes,
+        # and the sequence needs a two byte length.
+        return 139
+
+class ECDSA521P1(ECDSAPrivate, ECDSA521P1Public):
+    """
+    Wrapper around an ECDSA P-521 private key.
+    """
+    pass
+
+class ECDSABP256R1Public(ECDSAPublic):
+    curve = ec.BrainpoolP256R1
+
+    def sig_type(self):
+        return "ECDSABP256_SHA256"
+
+    def sig_tlv(self):
+        # The signature is the same size as for P-256, but it needs its
+        # own TLV so that the bootloader knows which curve to use.
+        return "ECDSABP256"
+
+    def sig_len(self):
+        return 72
+
+class ECDSABP256R1(ECDSAPrivate, ECDSABP256R1Public):
+    """
+    Wrapper around an ECDSA brainpoolP256r1 private key.
+    """
+    pass
+
+# The supported curves, indexed by the name cryptography gives them.
+ECDSA_CURVES = {
+        'secp224r1': (ECDSA224P1, ECDSA224P1Public),
+        'secp256r1': (ECDSA256P1, ECDSA256P1Public),
+        'secp384r1': (ECDSA384P1, ECDSA384P1Public),
+        'secp521r1': (ECDSA521P1, ECDSA521P1Public),
+        'brainpoolP256r1': (ECDSABP256R1, ECDSABP256R1Public),
+}
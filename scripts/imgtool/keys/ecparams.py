@@ -0,0 +1,147 @@
+"""
+EC keys with explicit curve parameters, rather than the OID of a named
+curve, which the crypto library won't load.  The parameters are
+matched against the curves we know, and the key loaded as a key on that
+curve.
+"""
+
+import base64
+import re
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.asymmetric import ec
+
+from . import asn1
+from .ecdsa import ECDSAUsageError
+
+OID_EC_PUBLIC_KEY = '1.2.840.10045.2.1'
+OID_PRIME_FIELD = '1.2.840.10045.1.1'
+
+# The parameters of each curve: p, a, b, the base point, and the order.
+CURVES = [
+    (ec.SECP256R1, (
+        0xffffffff00000001000000000000000000000000ffffffffffffffffffffffff,
+        0xffffffff00000001000000000000000000000000fffffffffffffffffffffffc,
+        0x5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604b,
+        0x6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296,
+        0x4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5,
+        0xffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551)),
+    (ec.SECP384R1, (
+        int('fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe'
+            'ffffffff0000000000000000ffffffff', 16),
+        int('fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe'
+            'ffffffff0000000000000000fffffffc', 16),
+        int('b3312fa7e23ee7e4988e056be3f82d19181d9c6efe8141120314088f5013875a'
+            'c656398d8a2ed19d2a85c8edd3ec2aef', 16),
+        int('aa87ca22be8b05378eb1c71ef320ad746e1d3b628ba79b9859f741e082542a38'
+            '5502f25dbf55296c3a545e3872760ab7', 16),
+        int('3617de4a96262c6f5d9e98bf9292dc29f8f41dbd289a147ce9da3113b5f0b8c0'
+            '0a60b1ce1d7e819d7a431d7c90ea0e5f', 16),
+        int('ffffffffffffffffffffffffffffffffffffffffffffffffc7634d81f4372ddf'
+            '581a0db248b0a77aecec196accc52973', 16))),
+]
+
+PEM_BLOCK = re.compile(
+        rb'-----BEGIN (EC PRIVATE KEY|PRIVATE KEY|PUBLIC KEY)-----(.*?)-----END \1-----',
+        re.DOTALL)
+
+def _point(data):
+    """Decode an uncompressed point."""
+    if not data or data[0] != 4 or len(data) % 2 != 1:
+        raise ECDSAUsageError("Only uncompressed EC points are supported")
+    size = len(data) // 2
+    return asn1.to_int(data[1:1 + size]), asn1.to_int(data[1 + size:])
+
+def match_curve(params):
+    """Return the curve described by the contents of an ECParameters
+    SEQUENCE."""
+    items = asn1.read_all(params)
+    if len(items) < 5 or items[0] != (asn1.INTEGER, b'\x01'):
+        raise asn1.DERError("Invalid EC parameters")
+    field = asn1.read_all(items[1][1])
+    if len(field) != 2 or asn1.decode_oid(field[0][1]) != OID_PRIME_FIELD:
+        raise ECDSAUsageError("Only EC curves over prime fields are supported")
+    p = asn1.to_int(field[1][1])
+    curve = asn1.read_all(items[2][1])
+    a = asn1.to_int(curve[0][1])
+    b = asn1.to_int(curve[1][1])
+    gx, gy = _point(items[3][1])
+    n = asn1.to_int(items[4][1])
+    for cls, known in CURVES:
+        if (p, a, b, gx, gy, n) == known:
+            return cls()
+    raise ECDSAUsageError(
+            "The explicit EC parameters don't match any supported curve")
+
+def _explicit_curve(alg):
+    """The curve of an AlgorithmIdentifier with explicit EC parameters,
+    or None if it is something else."""
+    items = asn1.read_all(alg)
+    if len(items) != 2 or items[0][0] != asn1.OID:
+        return None
+    if asn1.decode_oid(items[0][1]) != OID_EC_PUBLIC_KEY:
+        return None
+    if items[1][0] != asn1.SEQUENCE:
+        return None
+    return match_curve(items[1][1])
+
+def _ec_private(der, curve=None):
+    """Load a SEC1 ECPrivateKey.  The curve is given for keys inside
+    PKCS#8, where the parameters are outside."""
+    items = asn1.read_all(asn1.expect(der, asn1.SEQUENCE))
+    if len(items) < 2 or items[0] != (asn1.INTEGER, b'\x01'):
+        return None
+    d = asn1.to_int(items[1][1])
+    public = None
+    for tag, value in items[2:]:
+        if tag == asn1.context(0):
+            if value[:1] != bytes([asn1.SEQUENCE]):
+                return None
+            curve = match_curve(asn1.expect(value, asn1.SEQUENCE))
+        elif tag == asn1.context(1):
+            public = asn1.expect(value, asn1.BIT_STRING)[1:]
+    if curve is None:
+        return None
+    pk = ec.derive_private_key(d, curve, default_backend())
+    if public is not None:
+        numbers = pk.public_key().public_numbers()
+        if _point(public) != (numbers.x, numbers.y):
+            raise ECDSAUsageError("EC private key doesn't match its public key")
+    return pk
+
+def load(raw):
+    """Try loading an EC key with explicit parameters, from PEM or DER.
+    Returns a cryptography key, or None if this isn't such a key."""
+    m = PEM_BLOCK.search(raw)
+    if m is not None:
+        der = base64.b64decode(b''.join(m.group(2).split()))
+    elif b'-----BEGIN' in raw:
+        return None
+    else:
+        der = raw
+    try:
+        items = asn1.read_all(asn1.expect(der, asn1.SEQUENCE))
+        if not items:
+            return None
+        if items[0][0] == asn1.INTEGER:
+            if items[0][1] == b'\x01':
+                return _ec_private(der)
+            # PKCS#8 PrivateKeyInfo.
+            if len(items) < 3 or items[1][0] != asn1.SEQUENCE:
+                return None
+            curve = _explicit_curve(items[1][1])
+            if curve is None:
+                return None
+            return _ec_private(items[2][1], curve)
+        if items[0][0] == asn1.SEQUENCE and len(items) == 2:
+            # SubjectPublicKeyInfo.
+            curve = _explicit_curve(items[0][1])
+            if curve is None:
+                return None
+            x, y = _point(items[1][1][1:])
+            return ec.EllipticCurvePublicNumbers(x, y, curve).public_key(
+                    default_backend())
+    except asn1.DERError:
+        return None
+    return None
+
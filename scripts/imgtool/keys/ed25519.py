@@ -0,0 +1,114 @@
+"""
+ED25519 key management
+"""
+
+import hashlib
+
+from cryptography.exceptions import InvalidSignature
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import ed25519
+
+from .general import KeyClass, KeyUsageError, export_private_key
+from .keyfile import write_public
+from . import jwk, seeded
+
+class Ed25519UsageError(KeyUsageError):
+    pass
+
+class Ed25519Public(KeyClass):
+    def __init__(self, key):
+        self.key = key
+
+    def shortname(self):
+        return "ed25519"
+
+    def _unsupported(self, name):
+        raise Ed25519UsageError("Operation {} requires private key".format(name))
+
+    def _get_public(self):
+        return self.key
+
+    def get_public_bytes(self):
+        """The SubjectPublicKeyInfo around the 32 byte key, which is what
+        the bootloader parses, and hashes for the KEYHASH TLV."""
+        return self._get_public().public_bytes(
+                encoding=serialization.Encoding.DER,
+                format=serialization.PublicFormat.SubjectPublicKeyInfo)
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        self._unsupported('export_private')
+
+    def _raw_public_bytes(self):
+        # The 32 byte encoding of the point, from RFC 8032.
+        return self._get_public().public_bytes(
+                encoding=serialization.Encoding.Raw,
+                format=serialization.PublicFormat.Raw)
+
+    def export_public(self, path, overwrite=True):
+        """Write the public key to the given file."""
+        write_public(path, self.public_pem(), overwrite=overwrite)
+
+    def _jwk_members(self):
+        return {'kty': 'OKP', 'crv': 'Ed25519',
+                'x': jwk.b64url(self._raw_public_bytes())}
+
+    def sig_type(self):
+        return "ED25519"
+
+    def sig_tlv(self):
+        return "ED25519"
+
+    def sig_hashes(self):
+        return ['256', '512']
+
+    def sig_len(self):
+        return 64
+
+    def verify_digest(self, sig, digest, sha='256'):
+        """Whether sig is this key's signature of digest, the hash of
+        the image, which is what it signs."""
+        try:
+            self._get_public().verify(bytes(sig), digest)
+        except InvalidSignature:
+            return False
+        return True
+
+class Ed25519(Ed25519Public):
+    """
+    Wrapper around an ED25519 private key.
+    """
+
+    def __init__(self, key):
+        """key should be an instance of Ed25519PrivateKey"""
+        self.key = key
+
+    @staticmethod
+    def generate(seed=None):
+        """Generate a new key.  If a seed is given, the key is derived
+        from it, which is only suitable for testing."""
+        if seed is not None:
+            raw = seeded.raw_private_bytes(seed, "ed25519", 32)
+            return Ed25519(ed25519.Ed25519PrivateKey.from_private_bytes(raw))
+        return Ed25519(ed25519.Ed25519PrivateKey.generate())
+
+    def _get_public(self):
+        return self.key.public_key()
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        """Write the private key to the given file, protecting it with the optional password."""
+        if format != 'pkcs8':
+            raise Ed25519UsageError("ED25519 keys can only be written as PKCS#8")
+        export_private_key(self.key, path, passwd=passwd, format=format,
+                           overwrite=overwrite, encoding=encoding,
+                           metadata=metadata)
+
+    def sign(self, payload, sha='256', deterministic=False):
+        # As with the other signatures, what is signed is the hash of
+        # the image, so the bootloader only needs the hash.  Ed25519
+        # signatures are deterministic anyway.
+        return self.sign_digest(hashlib.new('sha' + sha, payload).digest())
+
+    def sign_digest(self, digest, sha='256', deterministic=False):
+        return self.key.sign(digest)
@@ -0,0 +1,88 @@
+"""
+Tests for ED25519 keys
+"""
+
+import hashlib
+import io
+import os.path
+import sys
+import tempfile
+import unittest
+
+from cryptography.exceptions import InvalidSignature
+from cryptography.hazmat.primitives import serialization
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import load, public_key, Ed25519, Ed25519UsageError
+
+class Ed25519KeyGeneration(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_keygen(self):
+        name1 = self.tname("keygen.pem")
+        Ed25519.generate().export_private(name1, b'secret')
+        self.assertIsNone(load(name1))
+        k = load(name1, b'secret')
+        self.assertIsInstance(k, Ed25519)
+
+        pubname = self.tname('keygen-pub.pem')
+        k.export_public(pubname)
+        pk = load(pubname)
+        self.assertEqual(pk.get_public_bytes(), k.get_public_bytes())
+        self.assertRaises(Ed25519UsageError,
+                pk.export_private, self.tname('keygen-priv2.pem'))
+        self.assertRaises(Ed25519UsageError, k.export_private,
+                self.tname("keygen2.pem"), format='traditional')
+
+    def test_emit(self):
+        k = Ed25519.generate()
+        ccode = io.StringIO()
+        k.emit_c(ccode)
+        self.assertIn("ed25519_pub_key_len = 44;", ccode.getvalue())
+
+    def test_public_bytes(self):
+        """The raw key is the private key's public half, and the DER is
+        that in the SubjectPublicKeyInfo."""
+        k = Ed25519.generate()
+        raw = k.key.public_key().public_bytes(
+                encoding=serialization.Encoding.Raw,
+                format=serialization.PublicFormat.Raw)
+        self.assertEqual(k.get_raw_public_bytes(), raw)
+        spki = bytes.fromhex('302a300506032b6570032100') + raw
+        self.assertEqual(k.get_public_bytes(), spki)
+        self.assertEqual(k.keyhash(), hashlib.sha256(spki).digest())
+
+    def test_sig(self):
+        """The signature is of the hash of the payload."""
+        k = Ed25519.generate()
+        buf = b'This is the message'
+        sig = k.sign(buf)
+        self.assertEqual(len(sig), k.sig_len())
+        k.key.public_key().verify(sig, hashlib.sha256(buf).digest())
+        self.assertRaises(InvalidSignature, k.key.public_key().verify, sig,
+                hashlib.sha256(b'This is thE message').digest())
+
+    def test_verify_digest(self):
+        """The signature checks against the public key, which is still
+        there once the private one is zeroized."""
+        k = Ed25519.generate()
+        digest = hashlib.sha256(b'This is the message').digest()
+        sig = k.sign_digest(digest)
+        public = public_key(k)
+        k.zeroize()
+        self.assertTrue(public.verify_digest(sig, digest))
+        self.assertFalse(public.verify_digest(sig, bytes(32)))
+        self.assertFalse(public.verify_digest(sig[:-1] + bytes([sig[-1] ^ 1]),
+                                              digest))
+
+if __name__ == '__main__':
+    unittest.main()
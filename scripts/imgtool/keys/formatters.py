@@ -0,0 +1,372 @@
+"""
+Formatting binary data, such as a public key, as source code to build
+into the bootloader, for each language getpub writes.  Each language
+has a template, filled in with the name of the array, its length, and
+the rows of bytes.  How C arrays are declared and laid out is a CStyle,
+for coding standards and linker scripts that need other than the
+default.
+"""
+
+import base64
+import collections
+import keyword
+import re
+import string
+
+AUTOGEN_MESSAGE = "/* Autogenerated by imgtool.py, do not edit. */"
+
+IDENTIFIER = re.compile(r'[A-Za-z_][A-Za-z0-9_]*\Z')
+
+SECTION = re.compile(r'[A-Za-z0-9_.$-]+\Z')
+
+CStyle = collections.namedtuple('CStyle', [
+        'static',          # Declare the arrays static
+        'const',           # Declare the arrays const
+        'section',         # The linker section of the arrays, or None
+        'per_row',         # The bytes on each line
+        'trailing_comma',  # End the last byte with a comma too
+        'word_size',       # The bytes in each element of the arrays
+        'word_endian',     # The byte order of larger elements, or None
+])
+CStyle.__new__.__defaults__ = (1, None)
+
+# The byte orders of the elements of arrays of words.
+WORD_ENDIANS = ('big', 'little')
+
+DEFAULT_C_STYLE = CStyle(static=False, const=True, section=None, per_row=8,
+                         trailing_comma=True)
+
+# The C11 keywords, which can't name an array.  Rust names are upper
+# case, which none of its keywords are, and Python's are refused with
+# the keyword module.
+C_KEYWORDS = frozenset("""
+        auto break case char const continue default do double else enum
+        extern float for goto if inline int long register restrict return
+        short signed sizeof static struct switch typedef union unsigned
+        void volatile while _Alignas _Alignof _Atomic _Bool _Complex
+        _Generic _Imaginary _Noreturn _Static_assert _Thread_local
+        """.split())
+
+C_ARRAY_TEMPLATE = """\
+{qualifiers}{element} {name}[]{attributes} = {{
+{rows}
+}};
+{qualifiers}unsigned int {name}_len{attributes} = {size};
+"""
+
+C_TEMPLATE = "{autogen}\n{includes}" + C_ARRAY_TEMPLATE
+
+# What an array of words needs for its type.
+C_WORD_INCLUDES = "#include <stdint.h>\n\n"
+
+# A header declaring an array, and the source defining it, for projects
+# that would otherwise write the declarations by hand.
+C_HEADER_TEMPLATE = """\
+{autogen}
+#ifndef {guard}
+#define {guard}
+
+#include <stdint.h>
+
+extern {qualifiers}{element} {name}[{size}];
+extern {qualifiers}unsigned int {name}_len;
+
+#endif /* {guard} */
+"""
+
+C_SOURCE_TEMPLATE = """\
+{autogen}
+#include "{header}"
+
+""" + C_ARRAY_TEMPLATE
+
+# The keys of a bootloader built with several, as the bootutil_keys
+# table that bootutil/sign_key.h declares.
+C_TABLE_TEMPLATE = """\
+{autogen}
+#include <bootutil/sign_key.h>
+
+{arrays}
+const struct bootutil_key bootutil_keys[] = {{
+{entries}
+}};
+const int bootutil_key_cnt = {count};
+"""
+
+# The keys.c of a Zephyr build, the table as C_TABLE_TEMPLATE has it,
+# refusing to build unless the bootloader checks the type of signature
+# the keys make.
+C_ZEPHYR_TEMPLATE = """\
+{autogen}
+#include <bootutil/sign_key.h>
+#include <mcuboot_config/mcuboot_config.h>
+
+#if !defined({option})
+#error "These keys are for a bootloader built with {option}"
+#endif
+
+{arrays}
+const struct bootutil_key bootutil_keys[] = {{
+{entries}
+}};
+const int bootutil_key_cnt = {count};
+"""
+
+C_TABLE_ENTRY = """\
+    {{
+        .key = {name},
+        .len = &{name}_len{comma}
+    }}"""
+
+# The array, and a function parsing it into an mbedtls_pk_context, for
+# bootloaders that verify with mbedTLS.
+C_MBEDTLS_TEMPLATE = """\
+{autogen}
+#include <mbedtls/pk.h>
+
+""" + C_ARRAY_TEMPLATE + """
+int {function}(mbedtls_pk_context *ctx)
+{{
+    return mbedtls_pk_parse_public_key(ctx, {name}, {name}_len);
+}}
+"""
+
+# The bare point of a P-256 key, and its hash, for bootloaders that
+# verify with tinycrypt.
+C_TINYCRYPT_TEMPLATE = """\
+{autogen}
+/* The point, X then Y, each 32 bytes, as tinycrypt takes it. */
+{point}
+/* The SHA-256 of the key, as signed images name it. */
+{hash}"""
+
+RUST_TEMPLATE = """\
+{autogen}
+pub static {name}: [u8; {size}] = [
+{rows}
+];
+pub const {name}_LEN: usize = {size};
+"""
+
+PYTHON_TEMPLATE = """\
+# Autogenerated by imgtool.py, do not edit.
+{name} = bytes([
+{rows}
+])
+{name}_len = {size}
+"""
+
+def _words(data, word_size=1, word_endian=None):
+    """The data as numbers of word_size bytes each, in the word_endian
+    byte order, big endian if it isn't given.  The last word is padded
+    with zeros."""
+    data = bytes(data) + bytes(-len(data) % word_size)
+    return [int.from_bytes(data[start:start + word_size],
+                           word_endian or 'big')
+            for start in range(0, len(data), word_size)]
+
+def _rows(data, indent="    ", per_row=8, trailing_comma=True, word_size=1,
+          word_endian=None):
+    """The bytes, as comma terminated hex literals, per_row to a line.
+    With a word_size, they are words, as many to a line as fit in
+    per_row bytes, but at least one.  Without trailing_comma, the last
+    has no comma."""
+    words = _words(data, word_size, word_endian)
+    per_line = max(1, per_row // word_size)
+    literal = "0x{{:0{}x}},".format(2 * word_size)
+    lines = []
+    for start in range(0, len(words), per_line):
+        lines.append(indent + " ".join(literal.format(w)
+                                       for w in words[start:start + per_line]))
+    if lines and not trailing_comma:
+        lines[-1] = lines[-1][:-1]
+    return "\n".join(lines)
+
+def c_qualifiers(style):
+    """What comes before the type of the arrays of the style."""
+    return ("static " if style.static else "") + ("const " if style.const
+                                                  else "")
+
+def c_element(style):
+    """The type of the elements of the arrays of the style."""
+    if style.word_size == 1:
+        return "unsigned char"
+    return "uint{}_t".format(8 * style.word_size)
+
+def c_size(data, style):
+    """The length of the array of the data, in elements."""
+    return -(-len(data) // style.word_size)
+
+def c_attributes(style):
+    """What comes after the name of the arrays of the style."""
+    if style.section is None:
+        return ""
+    return ' __attribute__((section("{}")))'.format(style.section)
+
+def render(template, data, name, style=DEFAULT_C_STYLE, **fields):
+    return template.format(autogen=AUTOGEN_MESSAGE, name=name,
+                           rows=_rows(data, per_row=style.per_row,
+                                      trailing_comma=style.trailing_comma,
+                                      word_size=style.word_size,
+                                      word_endian=style.word_endian),
+                           size=c_size(data, style),
+                           qualifiers=c_qualifiers(style),
+                           attributes=c_attributes(style),
+                           element=c_element(style),
+                           includes=(C_WORD_INCLUDES
+                                     if style.word_size > 1 else ""),
+                           **fields)
+
+def format_c(data, name, style=DEFAULT_C_STYLE):
+    """A const array called name, and name_len holding its length,
+    declared and laid out as the CStyle has them.  With a word_size,
+    the array is of uint32_t or such, and its length is in words."""
+    return render(C_TEMPLATE, data, name, style)
+
+def format_c_mbedtls(data, name, function, style=DEFAULT_C_STYLE):
+    """The array as format_c gives it, and the function, which parses it
+    with mbedtls_pk_parse_public_key, returning what that does."""
+    return render(C_MBEDTLS_TEMPLATE, data, name, style, function=function)
+
+def format_c_tinycrypt(point, digest, name, style=DEFAULT_C_STYLE):
+    """The point as an array called name, and the hash of the key as one
+    called name_hash, each with its length as format_c has it."""
+    return C_TINYCRYPT_TEMPLATE.format(
+            autogen=AUTOGEN_MESSAGE,
+            point=render(C_ARRAY_TEMPLATE, point, name, style),
+            hash=render(C_ARRAY_TEMPLATE, digest, name + "_hash", style))
+
+def format_rust(data, name):
+    """A static array called NAME, and NAME_LEN holding its length.
+    Rust names statics in upper case."""
+    return render(RUST_TEMPLATE, data, name.upper())
+
+def include_guard(header):
+    """The include guard of the header, named after its file name."""
+    guard = re.sub(r'[^A-Za-z0-9]', '_', header).upper()
+    if guard[:1].isdigit():
+        guard = 'KEY_' + guard
+    return guard
+
+def format_c_pair(data, name, header, style=DEFAULT_C_STYLE):
+    """A header declaring the array, and the source defining it, which
+    includes the header by its name.  The array is extern, so the style
+    can't be static."""
+    if style.static:
+        raise ValueError("An array declared in a header can't be static")
+    return (C_HEADER_TEMPLATE.format(autogen=AUTOGEN_MESSAGE, name=name,
+                                     size=c_size(data, style),
+                                     qualifiers=c_qualifiers(style),
+                                     element=c_element(style),
+                                     guard=include_guard(header)),
+            render(C_SOURCE_TEMPLATE, data, name, style, header=header))
+
+def format_c_table(arrays, style=DEFAULT_C_STYLE):
+    """Each of the arrays, a list of (data, name), as format_c gives it,
+    then the bootutil_keys table pointing at them, in the same order.
+    The style is that of the arrays, the table being what bootutil
+    declares."""
+    return C_TABLE_TEMPLATE.format(**_table_fields(arrays, style))
+
+def format_c_zephyr(arrays, option, style=DEFAULT_C_STYLE):
+    """The arrays and their table as format_c_table has them, for the
+    keys.c of a Zephyr build, which only builds with the MCUBOOT_SIGN_
+    option of the keys."""
+    return C_ZEPHYR_TEMPLATE.format(option=option,
+                                    **_table_fields(arrays, style))
+
+def _table_fields(arrays, style):
+    comma = "," if style.trailing_comma else ""
+    return dict(
+            autogen=AUTOGEN_MESSAGE,
+            arrays="\n".join(render(C_ARRAY_TEMPLATE, data, name, style)
+                              for data, name in arrays),
+            entries=(",\n".join(C_TABLE_ENTRY.format(name=name, comma=comma)
+                                 for _, name in arrays) + comma),
+            count=len(arrays))
+
+def format_python(data, name):
+    """A bytes object called name, and name_len holding its length, for
+    test harnesses that check what the bootloader will accept."""
+    return render(PYTHON_TEMPLATE, data, name)
+
+FORMATTERS = collections.OrderedDict([
+        ('c', format_c),
+        ('rust', format_rust),
+        ('python', format_python),
+])
+
+class TemplateError(ValueError):
+    """A user supplied template that can't be rendered, with the line
+    the problem is on."""
+    pass
+
+# What a template can turn the bytes of a field into, given as the
+# format spec of the field, such as {der:cbytes}.
+TEMPLATE_HELPERS = collections.OrderedDict([
+        ('cbytes', _rows),
+        ('hex', lambda data: bytes(data).hex()),
+        ('base64', lambda data: base64.b64encode(data).decode('ascii')),
+        ('len', lambda data: str(len(data))),
+])
+
+class _TemplateFormatter(string.Formatter):
+    """str.format, except that a field is only ever a plain name, and
+    bytes are always written with one of the TEMPLATE_HELPERS."""
+
+    def get_field(self, field_name, args, kwargs):
+        if field_name not in kwargs:
+            raise KeyError(field_name)
+        return kwargs[field_name], field_name
+
+    def format_field(self, value, spec):
+        if isinstance(value, (bytes, bytearray)):
+            if spec not in TEMPLATE_HELPERS:
+                raise ValueError("Bytes need one of the formats {}".format(
+                    ", ".join(TEMPLATE_HELPERS)))
+            return TEMPLATE_HELPERS[spec](value)
+        if spec in TEMPLATE_HELPERS:
+            raise ValueError("The {} format is only for bytes".format(spec))
+        return super().format_field(value, spec)
+
+def render_template(text, fields):
+    """The template filled in with the fields, a dict, as str.format
+    would, one line at a time so that a problem can be reported with its
+    line.  Literal braces are doubled."""
+    formatter = _TemplateFormatter()
+    lines = []
+    for number, line in enumerate(text.splitlines(True), 1):
+        try:
+            lines.append(formatter.vformat(line, (), fields))
+        except KeyError as e:
+            raise TemplateError("line {}: No field {}".format(number, e))
+        except (ValueError, IndexError) as e:
+            raise TemplateError("line {}: {}".format(number, e))
+    return "".join(lines)
+
+def check_section(name):
+    """Refuse a linker section name that can't go in the attribute as it
+    is."""
+    if not SECTION.match(name):
+        raise ValueError("Invalid section name: {!r}".format(name))
+
+def check_identifier(name):
+    """Refuse a name that can't be used as an identifier in every
+    language."""
+    if not IDENTIFIER.match(name):
+        raise ValueError("Invalid identifier: {!r}".format(name))
+    if name in C_KEYWORDS:
+        raise ValueError("{!r} is a C keyword".format(name))
+    if keyword.iskeyword(name):
+        raise ValueError("{!r} is a Python keyword".format(name))
+
+def identifier_from(text):
+    """An identifier made from text, such as the name of a key file,
+    with each character an identifier can't have replaced by an
+    underscore, and key_ before one that would start with a digit or be
+    a keyword."""
+    name = re.sub(r'[^A-Za-z0-9_]', '_', text)
+    if (not name or name[0].isdigit() or name in C_KEYWORDS or
+            keyword.iskeyword(name)):
+        name = 'key_' + name
+    return name
@@ -0,0 +1,315 @@
+"""
+Tests for formatting keys as source code
+"""
+
+import io
+import os
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import load, formatters
+
+TESTDATA = os.path.join(os.path.dirname(__file__), 'testdata')
+
+# The output of getpub for p256-pkcs8.pem.
+GOLDEN_C = (
+        '/* Autogenerated by imgtool.py, do not edit. */\n'
+        'const unsigned char ecdsa_pub_key[] = {\n'
+        '    0x30, 0x59, 0x30, 0x13, 0x06, 0x07, 0x2a, 0x86,\n'
+        '    0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a,\n'
+        '    0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07, 0x03,\n'
+        '    0x42, 0x00, 0x04, 0x82, 0x9e, 0xb7, 0x7a, 0xb2,\n'
+        '    0x56, 0x1e, 0x25, 0x69, 0x48, 0x04, 0x1e, 0x53,\n'
+        '    0x82, 0xa8, 0x26, 0xde, 0x8d, 0xe3, 0x40, 0x7e,\n'
+        '    0x1f, 0xde, 0xcf, 0x58, 0x44, 0x4a, 0x92, 0xd6,\n'
+        '    0x00, 0xf8, 0x89, 0x13, 0x7a, 0x86, 0x99, 0xcf,\n'
+        '    0x59, 0xb4, 0x15, 0xcd, 0xbb, 0x27, 0xd9, 0x90,\n'
+        '    0x87, 0x09, 0x21, 0x77, 0xcd, 0x0b, 0x1e, 0xfa,\n'
+        '    0x19, 0xb7, 0x67, 0x31, 0x23, 0xfb, 0xdb, 0x17,\n'
+        '    0x2b, 0xea, 0x25,\n'
+        '};\n'
+        'const unsigned int ecdsa_pub_key_len = 91;\n')
+
+GOLDEN_RUST = (
+        '/* Autogenerated by imgtool.py, do not edit. */\n'
+        'pub static ECDSA_PUB_KEY: [u8; 91] = [\n'
+        '    0x30, 0x59, 0x30, 0x13, 0x06, 0x07, 0x2a, 0x86,\n'
+        '    0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a,\n'
+        '    0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07, 0x03,\n'
+        '    0x42, 0x00, 0x04, 0x82, 0x9e, 0xb7, 0x7a, 0xb2,\n'
+        '    0x56, 0x1e, 0x25, 0x69, 0x48, 0x04, 0x1e, 0x53,\n'
+        '    0x82, 0xa8, 0x26, 0xde, 0x8d, 0xe3, 0x40, 0x7e,\n'
+        '    0x1f, 0xde, 0xcf, 0x58, 0x44, 0x4a, 0x92, 0xd6,\n'
+        '    0x00, 0xf8, 0x89, 0x13, 0x7a, 0x86, 0x99, 0xcf,\n'
+        '    0x59, 0xb4, 0x15, 0xcd, 0xbb, 0x27, 0xd9, 0x90,\n'
+        '    0x87, 0x09, 0x21, 0x77, 0xcd, 0x0b, 0x1e, 0xfa,\n'
+        '    0x19, 0xb7, 0x67, 0x31, 0x23, 0xfb, 0xdb, 0x17,\n'
+        '    0x2b, 0xea, 0x25,\n'
+        '];\n'
+        'pub const ECDSA_PUB_KEY_LEN: usize = 91;\n')
+
+GOLDEN_PYTHON = (
+        '# Autogenerated by imgtool.py, do not edit.\n'
+        'ecdsa_pub_key = bytes([\n'
+        '    0x30, 0x59, 0x30, 0x13, 0x06, 0x07, 0x2a, 0x86,\n'
+        '    0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a,\n'
+        '    0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07, 0x03,\n'
+        '    0x42, 0x00, 0x04, 0x82, 0x9e, 0xb7, 0x7a, 0xb2,\n'
+        '    0x56, 0x1e, 0x25, 0x69, 0x48, 0x04, 0x1e, 0x53,\n'
+        '    0x82, 0xa8, 0x26, 0xde, 0x8d, 0xe3, 0x40, 0x7e,\n'
+        '    0x1f, 0xde, 0xcf, 0x58, 0x44, 0x4a, 0x92, 0xd6,\n'
+        '    0x00, 0xf8, 0x89, 0x13, 0x7a, 0x86, 0x99, 0xcf,\n'
+        '    0x59, 0xb4, 0x15, 0xcd, 0xbb, 0x27, 0xd9, 0x90,\n'
+        '    0x87, 0x09, 0x21, 0x77, 0xcd, 0x0b, 0x1e, 0xfa,\n'
+        '    0x19, 0xb7, 0x67, 0x31, 0x23, 0xfb, 0xdb, 0x17,\n'
+        '    0x2b, 0xea, 0x25,\n'
+        '])\n'
+        'ecdsa_pub_key_len = 91\n')
+
+class Formatters(unittest.TestCase):
+
+    def test_golden(self):
+        k = load(os.path.join(TESTDATA, 'p256-pkcs8.pem'))
+        for emit, golden in [(k.emit_c, GOLDEN_C), (k.emit_rust, GOLDEN_RUST),
+                             (k.emit_python, GOLDEN_PYTHON)]:
+            out = io.StringIO()
+            emit(out)
+            self.assertEqual(out.getvalue(), golden)
+
+    def test_name(self):
+        k = load(os.path.join(TESTDATA, 'p256-pkcs8.pem'))
+        out = io.StringIO()
+        k.emit_c(out, name='boot')
+        self.assertEqual(out.getvalue(),
+                GOLDEN_C.replace('ecdsa_pub_key', 'boot_pub_key'))
+        out = io.StringIO()
+        k.emit_rust(out, name='boot')
+        self.assertEqual(out.getvalue(),
+                GOLDEN_RUST.replace('ECDSA_PUB_KEY', 'BOOT_PUB_KEY'))
+
+    def test_templates(self):
+        """The templates filled in with fixed data."""
+        data = bytes(range(0xf0, 0xfa))
+        self.assertEqual(formatters.format_c(data, 'root_key'),
+                '/* Autogenerated by imgtool.py, do not edit. */\n'
+                'const unsigned char root_key[] = {\n'
+                '    0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7,\n'
+                '    0xf8, 0xf9,\n'
+                '};\n'
+                'const unsigned int root_key_len = 10;\n')
+        self.assertEqual(formatters.format_rust(data, 'root_key'),
+                '/* Autogenerated by imgtool.py, do not edit. */\n'
+                'pub static ROOT_KEY: [u8; 10] = [\n'
+                '    0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7,\n'
+                '    0xf8, 0xf9,\n'
+                '];\n'
+                'pub const ROOT_KEY_LEN: usize = 10;\n')
+
+    def test_table(self):
+        """Several arrays and the bootutil_keys table, in order."""
+        self.assertEqual(formatters.format_c_table([(b'\x01\x02', 'root_key'),
+                                                    (b'\x03', 'dev_key')]),
+                '/* Autogenerated by imgtool.py, do not edit. */\n'
+                '#include <bootutil/sign_key.h>\n'
+                '\n'
+                'const unsigned char root_key[] = {\n'
+                '    0x01, 0x02,\n'
+                '};\n'
+                'const unsigned int root_key_len = 2;\n'
+                '\n'
+                'const unsigned char dev_key[] = {\n'
+                '    0x03,\n'
+                '};\n'
+                'const unsigned int dev_key_len = 1;\n'
+                '\n'
+                'const struct bootutil_key bootutil_keys[] = {\n'
+                '    {\n'
+                '        .key = root_key,\n'
+                '        .len = &root_key_len,\n'
+                '    },\n'
+                '    {\n'
+                '        .key = dev_key,\n'
+                '        .len = &dev_key_len,\n'
+                '    },\n'
+                '};\n'
+                'const int bootutil_key_cnt = 2;\n')
+
+    def test_pair(self):
+        """The header declares what the source defines."""
+        header, source = formatters.format_c_pair(bytes(range(3)), 'root_key',
+                                                  'root-key.h')
+        self.assertEqual(header,
+                '/* Autogenerated by imgtool.py, do not edit. */\n'
+                '#ifndef ROOT_KEY_H\n'
+                '#define ROOT_KEY_H\n'
+                '\n'
+                '#include <stdint.h>\n'
+                '\n'
+                'extern const unsigned char root_key[3];\n'
+                'extern const unsigned int root_key_len;\n'
+                '\n'
+                '#endif /* ROOT_KEY_H */\n')
+        self.assertEqual(source,
+                '/* Autogenerated by imgtool.py, do not edit. */\n'
+                '#include "root-key.h"\n'
+                '\n'
+                'const unsigned char root_key[] = {\n'
+                '    0x00, 0x01, 0x02,\n'
+                '};\n'
+                'const unsigned int root_key_len = 3;\n')
+        self.assertEqual(formatters.include_guard('2nd.key.h'), 'KEY_2ND_KEY_H')
+
+    def test_symbol(self):
+        k = load(os.path.join(TESTDATA, 'p256-pkcs8.pem'))
+        out = io.StringIO()
+        k.emit_c(out, symbol='root_key')
+        self.assertEqual(out.getvalue(),
+                GOLDEN_C.replace('ecdsa_pub_key', 'root_key'))
+
+    def test_rows(self):
+        """Full rows of eight bytes, then what is left."""
+        for fmt in formatters.FORMATTERS.values():
+            lines = fmt(bytes(range(17)), 'k').splitlines()
+            self.assertEqual(lines[2], '    ' + ', '.join(
+                    '0x{:02x}'.format(b) for b in range(8)) + ',')
+            self.assertEqual(lines[4], '    0x10,')
+
+    def test_rsa(self):
+        k = load(os.path.join(TESTDATA, 'rsa2048-pkcs1.pem'))
+        size = len(k.get_public_bytes())
+        out = io.StringIO()
+        k.emit_rust(out)
+        lines = out.getvalue().splitlines()
+        self.assertEqual(lines[1],
+                'pub static RSA_PUB_KEY: [u8; {}] = ['.format(size))
+        self.assertEqual(lines[-1],
+                'pub const RSA_PUB_KEY_LEN: usize = {};'.format(size))
+
+    def test_style(self):
+        style = formatters.CStyle(static=True, const=False,
+                                  section='.rodata.keys', per_row=2,
+                                  trailing_comma=False)
+        self.assertEqual(formatters.format_c(bytes(range(3)), 'k', style),
+                formatters.AUTOGEN_MESSAGE + '\n'
+                'static unsigned char k[] '
+                '__attribute__((section(".rodata.keys"))) = {\n'
+                '    0x00, 0x01,\n'
+                '    0x02\n'
+                '};\n'
+                'static unsigned int k_len '
+                '__attribute__((section(".rodata.keys"))) = 3;\n')
+        self.assertEqual(formatters.format_c(bytes(range(3)), 'k'),
+                         formatters.format_c(bytes(range(3)), 'k',
+                                             formatters.DEFAULT_C_STYLE))
+        with self.assertRaises(ValueError):
+            formatters.format_c_pair(b'\x01', 'k', 'k.h', style)
+        for bad in ['', 'a b', 'a"b', 'a\\b', '.keys\n']:
+            with self.assertRaises(ValueError):
+                formatters.check_section(bad)
+
+    def test_words(self):
+        style = formatters.DEFAULT_C_STYLE._replace(word_size=4,
+                                                    word_endian='little')
+        self.assertEqual(formatters.format_c(bytes(range(1, 7)), 'k', style),
+                formatters.AUTOGEN_MESSAGE + '\n'
+                '#include <stdint.h>\n'
+                '\n'
+                'const uint32_t k[] = {\n'
+                '    0x04030201, 0x00000605,\n'
+                '};\n'
+                'const unsigned int k_len = 2;\n')
+        style = style._replace(word_endian='big', per_row=2)
+        self.assertEqual(formatters.render(formatters.C_ARRAY_TEMPLATE,
+                                           bytes(range(1, 9)), 'k', style),
+                'const uint32_t k[] = {\n'
+                '    0x01020304,\n'
+                '    0x05060708,\n'
+                '};\n'
+                'const unsigned int k_len = 2;\n')
+        header, _ = formatters.format_c_pair(bytes(9), 'k', 'k.h', style)
+        self.assertIn('extern const uint32_t k[3];', header)
+
+    def test_mbedtls(self):
+        text = formatters.format_c_mbedtls(b'\x01', 'root_key', 'init_root_key')
+        self.assertTrue(text.startswith(formatters.AUTOGEN_MESSAGE +
+                                        '\n#include <mbedtls/pk.h>\n\n'))
+        self.assertIn(formatters.render(formatters.C_ARRAY_TEMPLATE,
+                                        b'\x01', 'root_key'), text)
+        self.assertTrue(text.endswith(
+                '\nint init_root_key(mbedtls_pk_context *ctx)\n'
+                '{\n'
+                '    return mbedtls_pk_parse_public_key(ctx, root_key, '
+                'root_key_len);\n'
+                '}\n'))
+
+    def test_tinycrypt(self):
+        text = formatters.format_c_tinycrypt(b'\x01\x02', b'\x03', 'k')
+        self.assertTrue(text.startswith(formatters.AUTOGEN_MESSAGE + '\n'))
+        self.assertIn(formatters.render(formatters.C_ARRAY_TEMPLATE,
+                                        b'\x01\x02', 'k'), text)
+        self.assertTrue(text.endswith(formatters.render(
+                formatters.C_ARRAY_TEMPLATE, b'\x03', 'k_hash')))
+
+    def test_zephyr(self):
+        """The table of format_c_table, built only with the option."""
+        arrays = [(b'\x01', 'a'), (b'\x02', 'b')]
+        table = formatters.format_c_table(arrays)
+        text = formatters.format_c_zephyr(arrays, 'MCUBOOT_SIGN_EC256')
+        self.assertIn('#include <mcuboot_config/mcuboot_config.h>\n\n'
+                      '#if !defined(MCUBOOT_SIGN_EC256)\n', text)
+        body = table[table.index('const unsigned char a[]'):]
+        self.assertTrue(text.endswith(body))
+
+    def test_table_style(self):
+        """Without the trailing comma, the table has none either."""
+        style = formatters.DEFAULT_C_STYLE._replace(trailing_comma=False)
+        text = formatters.format_c_table([(b'\x01', 'a'), (b'\x02', 'b')],
+                                         style)
+        self.assertNotRegex(text, r',\s*[}\]]')
+        self.assertIn('    }\n};\n', text)
+
+    def test_template(self):
+        fields = {'name': 'root_key', 'bits': 256, 'der': b'\x01\xab'}
+        self.assertEqual(formatters.render_template(
+                "{name}[{der:len}] = {{ {der:cbytes} }};\n"
+                "{bits:5d} {der:hex} {der:base64}\n", fields),
+                "root_key[2] = {     0x01, 0xab, };\n"
+                "  256 01ab Aas=\n")
+
+    def test_template_errors(self):
+        """Each problem is reported with its line."""
+        fields = {'bits': 256, 'der': b'\x01'}
+        for text, message in [
+                ("{bits}\n{curve}\n", "line 2: No field 'curve'"),
+                ("{der}\n", "line 1: Bytes need one of the formats"),
+                ("\n\n{bits:hex}\n", "line 3: The hex format is only for"),
+                ("{der.__class__}\n", "line 1: No field"),
+                ("{bits}\n}\n", "line 2: Single '}'"),
+                ("{0}\n", "line 1: No field '0'")]:
+            with self.assertRaises(formatters.TemplateError) as cm:
+                formatters.render_template(text, fields)
+            self.assertTrue(str(cm.exception).startswith(message),
+                            str(cm.exception))
+
+    def test_identifier(self):
+        for good in ['boot', 'Boot_Key2', '_k']:
+            formatters.check_identifier(good)
+        for bad in ['', '2key', 'boot-key', 'boot key', 'k\n', 'int',
+                    'static', 'lambda', 'None']:
+            with self.assertRaises(ValueError):
+                formatters.check_identifier(bad)
+
+    def test_identifier_from(self):
+        for text, want in [('root', 'root'),
+                           ('keys_variant-a', 'keys_variant_a'),
+                           ('prod.v2', 'prod_v2'), ('2024', 'key_2024'),
+                           ('int', 'key_int'), ('None', 'key_None'),
+                           ('', 'key_')]:
+            name = formatters.identifier_from(text)
+            self.assertEqual(name, want)
+            formatters.check_identifier(name)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -1,35 +1,196 @@
 """General key class."""
 
+import hashlib
+import json
 import sys
 
-AUTOGEN_MESSAGE = "/* Autogenerated by imgtool.py, do not edit. */"
+from cryptography.hazmat.primitives import serialization
+
+from .formatters import DEFAULT_C_STYLE, FORMATTERS, format_c
+from .keyfile import write_private
+from . import jwk
+
+
+class KeyUsageError(Exception):
+    """Base class of the errors raised when a key is used for something
+    it doesn't support."""
+    pass
+
+# Formats private keys can be written in.  "traditional" is the
+# algorithm specific format: SEC1 for EC keys, and PKCS#1 for RSA keys.
+PRIVATE_FORMATS = {
+        'pkcs8': serialization.PrivateFormat.PKCS8,
+        'traditional': serialization.PrivateFormat.TraditionalOpenSSL,
+}
+
+# Encodings key files can be written in.
+ENCODINGS = {
+        'pem': serialization.Encoding.PEM,
+        'der': serialization.Encoding.DER,
+}
+
+def format_metadata(metadata):
+    """Format the metadata, a sequence of (name, value) pairs, as lines
+    of text to go before a PEM block.
+
+    This is the "explanatory text" RFC 7468 allows outside of the
+    encapsulation boundaries.  Headers inside the block would be
+    rejected by OpenSSL, for anything but encrypted keys."""
+    text = ''
+    for name, value in metadata:
+        value = str(value)
+        if '\n' in value or '\r' in value or '-----' in value:
+            raise KeyUsageError("Invalid {} for key metadata: {!r}".format(
+                name, value))
+        text += "{}: {}\n".format(name, value)
+    return text.encode('utf-8')
+
+def read_metadata(raw):
+    """Return the metadata written by format_metadata, as a list of
+    (name, value) pairs."""
+    metadata = []
+    for line in raw.split(b'-----BEGIN', 1)[0].splitlines():
+        name, sep, value = line.decode('utf-8', 'replace').partition(':')
+        if sep:
+            metadata.append((name.strip(), value.strip()))
+    return metadata
+
+def export_private_key(key, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+    """Write the cryptography private key to the given file, protecting
+    it with the optional password.  Metadata is only written to PEM
+    files."""
+    if passwd is None:
+        enc = serialization.NoEncryption()
+    else:
+        if encoding == 'der' and format != 'pkcs8':
+            raise KeyUsageError("Encrypted DER keys must be in PKCS#8 format")
+        # This needs bytes, so with a Secret, here is a copy that can't
+        # be wiped.
+        enc = serialization.BestAvailableEncryption(bytes(passwd))
+    data = key.private_bytes(
+            encoding=ENCODINGS[encoding],
+            format=PRIVATE_FORMATS[format],
+            encryption_algorithm=enc)
+    if metadata and encoding == 'pem':
+        data = format_metadata(metadata) + data
+    write_private(path, data, overwrite=overwrite)
 
 class KeyClass(object):
-    def _public_emit(self, header, trailer, indent, file=sys.stdout, len_format=None):
-        print(AUTOGEN_MESSAGE, file=file)
-        print(header, end='', file=file)
-        encoded = self.get_public_bytes()
-        for count, b in enumerate(encoded):
-            if count % 8 == 0:
-                print("\n" + indent, end='', file=file)
-            else:
-                print(" ", end='', file=file)
-            print("0x{:02x},".format(b), end='', file=file)
-        print("\n" + trailer, file=file)
-        if len_format is not None:
-            print(len_format.format(len(encoded)), file=file)
-
-    def emit_c(self, file=sys.stdout):
-        self._public_emit(
-                header="const unsigned char {}_pub_key[] = {{".format(self.shortname()),
-                trailer="};",
-                indent="    ",
-                len_format="const unsigned int {}_pub_key_len = {{}};".format(self.shortname()),
-                file=file)
-
-    def emit_rust(self, file=sys.stdout):
-        self._public_emit(
-                header="static {}_PUB_KEY: &'static [u8] = &[".format(self.shortname().upper()),
-                trailer="];",
-                indent="    ",
-                file=file)
+    # The X.509 certificate the public key was read from, if it was.
+    certificate = None
+
+    def deprecated(self):
+        """A warning to give if this type of key is deprecated, otherwise
+        None."""
+        return None
+
+    def sig_hashes(self):
+        """The hashes of the image, as sign --sha gives them, that this
+        type of key can sign, the first the one it signs by default."""
+        return ['256']
+
+    def zeroize(self):
+        """Drop the key once it is no longer needed.  The crypto library
+        keeps the key in its own memory, which OpenSSL clears when the
+        key is freed, and dropping our reference lets that happen, as
+        long as nothing else holds one.  The key can't be used after
+        this."""
+        self.key = None
+
+    def _public_emit(self, lang, name=None, file=sys.stdout, encoded=None,
+                     symbol=None):
+        """Write the public key as source code in the language, with its
+        identifiers named after name, or else the type of key, unless
+        symbol gives the name of the array.  encoded is the key, if not
+        the usual ASN.1 encoding of it."""
+        if encoded is None:
+            encoded = self.get_public_bytes()
+        print(FORMATTERS[lang](encoded, self.c_identifier(name, symbol)),
+              end='', file=file)
+
+    def c_identifier(self, name=None, symbol=None):
+        """The name of the array of the C output, symbol, or else named
+        after name, or the type of key."""
+        return symbol or "{}_pub_key".format(name or self.shortname())
+
+    def fingerprint(self):
+        """The SHA-256 hash of the public key, as the bootloader
+        computes it for the KEYHASH TLV."""
+        return self.keyhash()
+
+    def keyhash(self, algorithm='sha256', encoded=None):
+        """The hash of the public key, over the same bytes as the C
+        output holds, with the hashlib algorithm, sha256 or sha384.
+        encoded is the key, if not the usual encoding of it."""
+        if encoded is None:
+            encoded = self.get_public_bytes()
+        return hashlib.new(algorithm, encoded).digest()
+
+    def public_pem(self):
+        """The public key as a "PUBLIC KEY" PEM block, the X.509
+        SubjectPublicKeyInfo that openssl and most other tools read."""
+        return self._get_public().public_bytes(
+                encoding=serialization.Encoding.PEM,
+                format=serialization.PublicFormat.SubjectPublicKeyInfo)
+
+    def _raw_public_bytes(self):
+        raise KeyUsageError("{} keys have no raw encoding".format(
+            self.shortname()))
+
+    def get_raw_public_bytes(self, point_prefix=False):
+        """The public key as the bare numbers, without the ASN.1 around
+        them, for bootloaders that take it that way."""
+        if point_prefix:
+            raise KeyUsageError("Only EC keys have a point prefix")
+        return self._raw_public_bytes()
+
+    def emit_raw(self, file=sys.stdout, point_prefix=False, encoded=None):
+        """Write the raw public key, as emit_der writes the DER."""
+        if encoded is None:
+            encoded = self.get_raw_public_bytes(point_prefix)
+        getattr(file, 'buffer', file).write(encoded)
+
+    def emit_raw_c(self, file=sys.stdout, name=None, point_prefix=False,
+                   symbol=None, encoded=None, style=DEFAULT_C_STYLE):
+        if encoded is None:
+            encoded = self.get_raw_public_bytes(point_prefix)
+        self.emit_c(file, name, symbol, encoded, style)
+
+    def emit_der(self, file=sys.stdout, encoded=None):
+        """Write the public key as the DER the C and Rust output hold,
+        to a binary file, or the binary side of a text one."""
+        if encoded is None:
+            encoded = self.get_public_bytes()
+        getattr(file, 'buffer', file).write(encoded)
+
+    def emit_pem(self, file=sys.stdout):
+        print(self.public_pem().decode('ascii'), end='', file=file)
+
+    def emit_c(self, file=sys.stdout, name=None, symbol=None, encoded=None,
+               style=DEFAULT_C_STYLE):
+        """Write the public key as a C array, declared and laid out as the
+        formatters.CStyle has it."""
+        if encoded is None:
+            encoded = self.get_public_bytes()
+        print(format_c(encoded, self.c_identifier(name, symbol), style),
+              end='', file=file)
+
+    def emit_rust(self, file=sys.stdout, name=None, symbol=None,
+                  encoded=None):
+        self._public_emit('rust', name, file, encoded, symbol)
+
+    def emit_python(self, file=sys.stdout, name=None, symbol=None,
+                    encoded=None):
+        self._public_emit('python', name, file, encoded, symbol)
+
+    def _jwk_members(self):
+        raise KeyUsageError("{} keys have no JWK encoding".format(
+            self.shortname()))
+
+    def to_jwk(self):
+        """Return the public key as a JWK."""
+        return jwk.make_jwk(self._jwk_members())
+
+    def emit_jwk(self, file=sys.stdout):
+        print(json.dumps(self.to_jwk(), indent=2), file=file)
@@ -0,0 +1,213 @@
+"""
+Describing key files: the format they are in, and the key they hold.
+"""
+
+import base64
+import collections
+import hashlib
+import re
+
+from . import asn1, is_private, openssh
+from .aes import AES, AES_KEY_SIZES
+from .ecdsa import ECDSAPublic
+from .ed25519 import Ed25519Public
+from .general import read_metadata
+from .rsa import RSAPublic
+from .x25519 import X25519Public
+
+# The format of the key in each type of PEM block.  Other blocks, such
+# as "EC PARAMETERS", don't hold the key.
+PEM_FORMATS = {
+        'EC PRIVATE KEY': 'SEC1',
+        'RSA PRIVATE KEY': 'PKCS#1',
+        'RSA PUBLIC KEY': 'PKCS#1',
+        'PRIVATE KEY': 'PKCS#8',
+        'ENCRYPTED PRIVATE KEY': 'PKCS#8',
+        'PUBLIC KEY': 'SubjectPublicKeyInfo',
+        'AES KEY': 'raw',
+        'OPENSSH PRIVATE KEY': 'OpenSSH',
+        'CERTIFICATE': 'X.509',
+}
+
+PEM_BLOCK = re.compile(
+        rb'-----BEGIN ([A-Z0-9 ]+)-----\r?\n(.*?)-----END \1-----',
+        re.DOTALL)
+
+def _pem_headers(body):
+    """The RFC 1421 headers at the start of a PEM block, such as the
+    DEK-Info of a legacy encrypted key."""
+    headers = []
+    lines = body.splitlines()
+    if not lines or b':' not in lines[0]:
+        return headers
+    for line in lines:
+        if not line.strip():
+            break
+        name, _, value = line.decode('utf-8', 'replace').partition(':')
+        headers.append((name.strip(), value.strip()))
+    return headers
+
+def _der_format(der):
+    """The format of a DER key, and whether it is encrypted."""
+    try:
+        items = asn1.read_all(asn1.expect(der, asn1.SEQUENCE))
+    except asn1.DERError:
+        return None, False
+    tags = [tag for tag, _ in items]
+    if tags[:2] == [asn1.SEQUENCE, asn1.BIT_STRING]:
+        return 'SubjectPublicKeyInfo', False
+    if tags[:3] == [asn1.SEQUENCE, asn1.SEQUENCE, asn1.BIT_STRING]:
+        return 'X.509', False
+    if tags[:2] == [asn1.SEQUENCE, asn1.OCTET_STRING]:
+        # EncryptedPrivateKeyInfo.
+        return 'PKCS#8', True
+    if tags[:3] == [asn1.INTEGER, asn1.SEQUENCE, asn1.OCTET_STRING]:
+        return 'PKCS#8', False
+    if tags[:2] == [asn1.INTEGER, asn1.OCTET_STRING]:
+        return 'SEC1', False
+    if tags[:2] == [asn1.INTEGER, asn1.INTEGER]:
+        return 'PKCS#1', False
+    return None, False
+
+def file_format(raw):
+    """Describe how the key file is written, without loading the key.
+
+    Returns an OrderedDict with the format (SEC1, PKCS#1, PKCS#8,
+    SubjectPublicKeyInfo, OpenSSH, raw, or X.509 for a certificate), the
+    encoding (PEM or DER),
+    whether the key is encrypted, the cipher of legacy encrypted PEM
+    and OpenSSH keys, and the headers: the metadata keygen writes ahead
+    of the block, then those in the block itself."""
+    info = collections.OrderedDict()
+    if b'-----BEGIN' in raw:
+        blocks = [m for m in PEM_BLOCK.finditer(raw)
+                  if m.group(1).decode('ascii') in PEM_FORMATS]
+        if not blocks:
+            info['format'] = None
+            info['encoding'] = 'PEM'
+            info['encrypted'] = False
+            info['headers'] = read_metadata(raw)
+            return info
+        label = blocks[0].group(1).decode('ascii')
+        block_headers = _pem_headers(blocks[0].group(2))
+        fields = dict(block_headers)
+        info['format'] = PEM_FORMATS[label]
+        info['encoding'] = 'PEM'
+        info['encrypted'] = (label == 'ENCRYPTED PRIVATE KEY' or
+                             fields.get('Proc-Type') == '4,ENCRYPTED')
+        if 'DEK-Info' in fields:
+            info['cipher'] = fields['DEK-Info'].split(',')[0].strip()
+        if label == 'OPENSSH PRIVATE KEY':
+            try:
+                cipher = openssh.cipher(raw)
+            except openssh.OpenSSHFormatError:
+                cipher = None
+            info['encrypted'] = cipher is not None
+            if cipher is not None:
+                info['cipher'] = cipher
+        info['headers'] = read_metadata(raw) + block_headers
+        return info
+    if len(raw) in AES_KEY_SIZES:
+        fmt, encrypted = 'raw', False
+    else:
+        fmt, encrypted = _der_format(raw)
+    info['format'] = fmt
+    info['encoding'] = 'DER'
+    info['encrypted'] = encrypted
+    info['headers'] = []
+    return info
+
+def describe(key):
+    """Describe the key itself, as an OrderedDict of its algorithm, its
+    curve or size, whether it is private, and the SHA-256 hash the
+    bootloader knows it by."""
+    info = collections.OrderedDict()
+    if isinstance(key, RSAPublic):
+        info['algorithm'] = 'RSA'
+        info['bits'] = key.key_size()
+    elif isinstance(key, ECDSAPublic):
+        info['algorithm'] = 'ECDSA'
+        info['curve'] = key.curve.name
+    elif isinstance(key, Ed25519Public):
+        info['algorithm'] = 'Ed25519'
+    elif isinstance(key, X25519Public):
+        info['algorithm'] = 'X25519'
+    elif isinstance(key, AES):
+        info['algorithm'] = 'AES'
+        info['bits'] = key.key_size()
+    info['private'] = is_private(key)
+    if not isinstance(key, AES):
+        info['keyhash'] = key.fingerprint().hex()
+    return info
+
+# The members of the object getpub --format json writes, in order.
+# Build pipelines read these, so they are only ever added to, never
+# renamed or removed.
+PublicKeyJSON = collections.namedtuple('PublicKeyJSON', [
+        'algorithm',  # "RSA", "ECDSA", "Ed25519" or "X25519"
+        'curve',      # The name of the curve of an EC key, else null
+        'bits',       # The size of the key, or of the curve
+        'der',        # The DER the C output holds, in base64
+        'keyhash',    # The SHA-256 of the DER, in hex
+        'source',     # The key file, as it was given
+])
+
+def public_json(key, source, der=None):
+    """The PublicKeyJSON of the public key, read from source.  der is the
+    key, if not the usual encoding of it."""
+    if der is None:
+        der = key.get_public_bytes()
+    summary = describe(key)
+    if isinstance(key, ECDSAPublic):
+        bits = key.curve.key_size
+    elif isinstance(key, (Ed25519Public, X25519Public)):
+        bits = 256
+    else:
+        bits = summary['bits']
+    return PublicKeyJSON(
+            algorithm=summary['algorithm'],
+            curve=summary.get('curve'),
+            bits=bits,
+            der=base64.b64encode(der).decode('ascii'),
+            keyhash=hashlib.sha256(der).hexdigest(),
+            source=source)
+
+# The fields of a getpub --template, each a str, an int, or bytes, which
+# the template writes with one of the formatters.TEMPLATE_HELPERS.
+TEMPLATE_FIELDS = collections.OrderedDict([
+        ('name', "The identifier, from --name or --symbol"),
+        ('algorithm', "RSA, ECDSA, Ed25519 or X25519"),
+        ('curve', "The curve of an EC key, else empty"),
+        ('bits', "The size of the key, or of the curve"),
+        ('der', "The DER the C output holds"),
+        ('keyhash', "The SHA-256 of the DER"),
+        ('raw', "The raw key, the point of an EC key without its prefix"),
+        ('x', "The X coordinate of an EC key"),
+        ('y', "The Y coordinate of an EC key"),
+        ('source', "The key file, as it was given"),
+])
+
+def template_fields(key, source, name, der=None, raw=None):
+    """The TEMPLATE_FIELDS of the public key, as a dict of them.  der and
+    raw are the key, if not the usual encodings of it.  x and y are only
+    there for an EC key."""
+    if der is None:
+        der = key.get_public_bytes()
+    if raw is None:
+        raw = key.get_raw_public_bytes()
+    record = public_json(key, source, der)
+    fields = {
+            'name': name,
+            'algorithm': record.algorithm,
+            'curve': record.curve or '',
+            'bits': record.bits,
+            'der': der,
+            'keyhash': hashlib.sha256(der).digest(),
+            'raw': raw,
+            'source': source,
+    }
+    if isinstance(key, ECDSAPublic):
+        point = key.get_raw_public_bytes()
+        fields['x'] = point[:len(point) // 2]
+        fields['y'] = point[len(point) // 2:]
+    return fields
@@ -0,0 +1,32 @@
+"""
+JSON Web Key encoding of public keys, as in RFC 7517.
+"""
+
+import base64
+import collections
+import hashlib
+import json
+
+def b64url(data):
+    """base64url encoding, without padding, as JWKs use."""
+    return base64.urlsafe_b64encode(data).rstrip(b'=').decode('ascii')
+
+def uint_bytes(value, size=None):
+    """Big endian encoding of an integer.  Without a size, the shortest
+    encoding is used."""
+    if size is None:
+        size = max(1, (value.bit_length() + 7) // 8)
+    return value.to_bytes(size, 'big')
+
+def thumbprint(members):
+    """The RFC 7638 thumbprint of a key, given its required members.
+    These are hashed sorted, with no white space."""
+    canonical = json.dumps(members, sort_keys=True, separators=(',', ':'))
+    return b64url(hashlib.sha256(canonical.encode('utf-8')).digest())
+
+def make_jwk(members):
+    """Build the JWK from the required members of the key, adding the
+    thumbprint as the key id."""
+    jwk = collections.OrderedDict(members)
+    jwk['kid'] = thumbprint(members)
+    return jwk
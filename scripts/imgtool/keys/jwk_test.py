@@ -0,0 +1,102 @@
+"""
+Tests for the JWK encoding of public keys
+"""
+
+import io
+import json
+import os.path
+import sys
+import unittest
+
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import x25519
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import (ECDSA256P1, ECDSA384P1, ECDSA521P1, ECDSABP256R1,
+                          Ed25519, RSA, X25519, KeyUsageError)
+from imgtool.keys import jwk
+
+try:
+    from jwt.algorithms import ECAlgorithm, OKPAlgorithm, RSAAlgorithm
+except ImportError:
+    ECAlgorithm = OKPAlgorithm = RSAAlgorithm = None
+
+# The example key from RFC 7638, section 3.1.
+RFC7638_N = ('0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1'
+             'RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5'
+             'n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8K'
+             'JZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQF'
+             'h6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJz'
+             'KnqDKgw')
+RFC7638_KID = 'NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs'
+
+def spki(pub):
+    return pub.public_bytes(
+            encoding=serialization.Encoding.DER,
+            format=serialization.PublicFormat.SubjectPublicKeyInfo)
+
+class JWK(unittest.TestCase):
+
+    def test_thumbprint(self):
+        self.assertEqual(jwk.thumbprint({'e': 'AQAB', 'kty': 'RSA',
+                                         'n': RFC7638_N}),
+                         RFC7638_KID)
+
+    def test_no_padding(self):
+        self.assertEqual(jwk.b64url(b'\xff\xfe'), '__4')
+        self.assertEqual(jwk.b64url(jwk.uint_bytes(65537)), 'AQAB')
+
+    def check(self, k, alg, **members):
+        """Parse the JWK of a key with PyJWT, and check it is the same
+        public key."""
+        out = io.StringIO()
+        k.emit_jwk(file=out)
+        data = json.loads(out.getvalue())
+        for name, value in members.items():
+            self.assertEqual(data[name], value)
+        self.assertNotIn('=', out.getvalue())
+        required = {n: v for n, v in data.items() if n != 'kid'}
+        self.assertEqual(data['kid'], jwk.thumbprint(required))
+        if alg is None:
+            return data
+        parsed = alg.from_jwk(out.getvalue())
+        self.assertEqual(spki(parsed), spki(k.key.public_key()))
+        return data
+
+    @unittest.skipIf(RSAAlgorithm is None, "PyJWT is not installed")
+    def test_rsa(self):
+        data = self.check(RSA.generate(), RSAAlgorithm, kty='RSA', e='AQAB')
+        self.assertFalse(data['n'].startswith('AA'))
+
+    @unittest.skipIf(ECAlgorithm is None, "PyJWT is not installed")
+    def test_ec(self):
+        for cls, crv, size in [(ECDSA256P1, 'P-256', 32),
+                               (ECDSA384P1, 'P-384', 48),
+                               (ECDSA521P1, 'P-521', 66)]:
+            # Try enough keys that some coordinates have leading zeros.
+            for _ in range(20):
+                data = self.check(cls.generate(), ECAlgorithm, kty='EC', crv=crv)
+                x = jwk.base64.urlsafe_b64decode(data['x'] + '==')
+                y = jwk.base64.urlsafe_b64decode(data['y'] + '==')
+                self.assertEqual(len(x), size)
+                self.assertEqual(len(y), size)
+
+    @unittest.skipIf(OKPAlgorithm is None, "PyJWT is not installed")
+    def test_ed25519(self):
+        self.check(Ed25519.generate(), OKPAlgorithm, kty='OKP', crv='Ed25519')
+
+    def test_x25519(self):
+        # PyJWT only handles signing curves, so check this by hand.
+        k = X25519.generate()
+        data = self.check(k, None, kty='OKP', crv='X25519')
+        raw = jwk.base64.urlsafe_b64decode(data['x'] + '=')
+        parsed = x25519.X25519PublicKey.from_public_bytes(raw)
+        self.assertEqual(spki(parsed), spki(k.key.public_key()))
+
+    def test_brainpool(self):
+        self.assertRaises(KeyUsageError,
+                ECDSABP256R1.generate().emit_jwk, file=io.StringIO())
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,126 @@
+"""
+Writing of private key files.
+"""
+
+import getpass
+import os
+import stat
+import subprocess
+import sys
+import tempfile
+import time
+
+class KeyFileExists(Exception):
+    """Raised when a key file would overwrite an existing file."""
+    def __init__(self, path):
+        super(KeyFileExists, self).__init__(
+                "Key file {} already exists".format(path))
+        self.path = path
+
+def write_private(path, data, overwrite=False):
+    """Write private key material to the given path.  The file is only
+    readable by its owner.  Unless overwrite is set, the file must not
+    already exist.  A path of "-" writes to stdout."""
+    if path == '-':
+        out = sys.stdout.buffer
+        out.write(data)
+        out.flush()
+        return
+    flags = os.O_WRONLY | os.O_CREAT | getattr(os, 'O_BINARY', 0)
+    flags |= os.O_TRUNC if overwrite else os.O_EXCL
+    try:
+        fd = os.open(path, flags, 0o600)
+    except FileExistsError:
+        raise KeyFileExists(path)
+    with os.fdopen(fd, 'wb') as f:
+        # The mode given to open only applies to new files, make sure
+        # a replaced file also ends up private.
+        os.chmod(path, 0o600)
+        if os.name == 'nt':
+            restrict_windows(path)
+        f.write(data)
+
+def restrict_windows(path):
+    """On Windows, file modes only control the read-only flag.  Replace
+    the inherited ACL with one granting access to the current user
+    only."""
+    subprocess.run(["icacls", path, "/inheritance:r",
+                    "/grant:r", "{}:F".format(getpass.getuser())],
+                   check=True, stdout=subprocess.DEVNULL)
+
+def check_permissions(path):
+    """Check that a private key file isn't accessible to anyone but its
+    owner.  Returns a description of the problem, or None if there is
+    nothing wrong.  Only Unix modes are checked, Windows ACLs are not
+    inspected."""
+    if os.name == 'nt' or path == '-':
+        return None
+    mode = stat.S_IMODE(os.stat(path).st_mode)
+    if mode & 0o077:
+        return "Key file {} is accessible by others (mode 0{:o})".format(
+                path, mode)
+    return None
+
+def write_public(path, data, overwrite=True):
+    """Write public key material to the given path.  Unless overwrite is
+    set, the file must not already exist.  A path of "-" writes to
+    stdout."""
+    if path == '-':
+        out = sys.stdout.buffer
+        out.write(data)
+        out.flush()
+        return
+    try:
+        with open(path, 'wb' if overwrite else 'xb') as f:
+            f.write(data)
+    except FileExistsError:
+        raise KeyFileExists(path)
+
+def write_atomic(path, data, mode=None):
+    """Replace the file at path with data, by writing a temporary file
+    beside it and renaming that into place, so that anything reading
+    the file sees either all of the old contents or all of the new.  A
+    file that is replaced keeps its mode, unless mode is given, such
+    as 0o600 for a secret."""
+    private = mode is not None and not mode & 0o077
+    if mode is None and os.path.exists(path):
+        mode = stat.S_IMODE(os.stat(path).st_mode)
+    elif mode is None:
+        umask = os.umask(0)
+        os.umask(umask)
+        mode = 0o666 & ~umask
+    fd, tmp = tempfile.mkstemp(dir=os.path.dirname(os.path.abspath(path)),
+                               prefix='.{}.'.format(os.path.basename(path)),
+                               suffix='.tmp')
+    try:
+        with os.fdopen(fd, 'wb') as f:
+            f.write(data)
+            f.flush()
+            os.fsync(f.fileno())
+        os.chmod(tmp, mode)
+        if private and os.name == 'nt':
+            restrict_windows(tmp)
+        os.replace(tmp, path)
+    except BaseException:
+        os.unlink(tmp)
+        raise
+
+def backup_name(path, now=None):
+    """Return an unused name to move an existing key file to, based on
+    the current time.  When several backups are made within the same
+    second, a counter is appended."""
+    now = time.localtime() if now is None else now
+    base = "{}.bak-{}".format(path, time.strftime('%Y%m%d-%H%M%S', now))
+    name = base
+    count = 0
+    while os.path.lexists(name):
+        count += 1
+        name = "{}-{}".format(base, count)
+    return name
+
+def backup(path, now=None):
+    """Move an existing key file out of the way, returning its new
+    name."""
+    name = backup_name(path, now)
+    os.rename(path, name)
+    return name
@@ -0,0 +1,153 @@
+"""
+Tests for key file writing
+"""
+
+import os
+import stat
+import sys
+import tempfile
+import time
+import unittest
+from unittest import mock
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import ECDSA256P1, KeyFileExists, load
+from imgtool.keys import keyfile
+from imgtool.keys.keyfile import (backup, backup_name, check_permissions,
+                                  write_atomic, write_private)
+
+@unittest.skipIf(os.name == 'nt', "Unix file modes")
+class KeyFile(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def mode(self, path):
+        return stat.S_IMODE(os.stat(path).st_mode)
+
+    def test_exclusive(self):
+        name = self.tname("key.pem")
+        write_private(name, b'first')
+        self.assertEqual(self.mode(name), 0o600)
+        self.assertRaises(KeyFileExists, write_private, name, b'second')
+        with open(name, 'rb') as f:
+            self.assertEqual(f.read(), b'first')
+
+    def test_overwrite(self):
+        name = self.tname("key.pem")
+        with open(name, 'wb') as f:
+            f.write(b'a much longer original')
+        os.chmod(name, 0o644)
+        write_private(name, b'second', overwrite=True)
+        self.assertEqual(self.mode(name), 0o600)
+        with open(name, 'rb') as f:
+            self.assertEqual(f.read(), b'second')
+
+    def test_atomic(self):
+        name = self.tname("key.h")
+        write_atomic(name, b'first')
+        self.assertEqual(self.mode(name), 0o666 & ~self.umask())
+        os.chmod(name, 0o640)
+        write_atomic(name, b'second')
+        with open(name, 'rb') as f:
+            self.assertEqual(f.read(), b'second')
+        self.assertEqual(self.mode(name), 0o640)
+        self.assertEqual(os.listdir(self.test_dir.name), ['key.h'])
+
+    def test_atomic_mode(self):
+        """A secret ends up private, even replacing a file that wasn't."""
+        name = self.tname("key.c")
+        write_atomic(name, b'first')
+        os.chmod(name, 0o644)
+        write_atomic(name, b'second', mode=0o600)
+        self.assertEqual(self.mode(name), 0o600)
+        write_atomic(self.tname("new.c"), b'first', mode=0o600)
+        self.assertEqual(self.mode(self.tname("new.c")), 0o600)
+
+    def test_atomic_failure(self):
+        """If the new file can't be put in place, the old one is left,
+        and the temporary file removed."""
+        name = self.tname("key.h")
+        write_atomic(name, b'first')
+        with mock.patch('os.replace', side_effect=OSError("no")):
+            self.assertRaises(OSError, write_atomic, name, b'second')
+        with open(name, 'rb') as f:
+            self.assertEqual(f.read(), b'first')
+        self.assertEqual(os.listdir(self.test_dir.name), ['key.h'])
+
+    def umask(self):
+        umask = os.umask(0)
+        os.umask(umask)
+        return umask
+
+    def test_backup_names(self):
+        name = self.tname("key.pem")
+        now = time.strptime("2018-06-08 12:34:56", "%Y-%m-%d %H:%M:%S")
+        expected = name + ".bak-20180608-123456"
+        self.assertEqual(backup_name(name, now), expected)
+
+        # Several backups within the same second must not collide.
+        names = []
+        for i in range(3):
+            write_private(name, 'key {}'.format(i).encode())
+            names.append(backup(name, now))
+            self.assertFalse(os.path.exists(name))
+        self.assertEqual(names, [expected, expected + "-1", expected + "-2"])
+        for i, bak in enumerate(names):
+            with open(bak, 'rb') as f:
+                self.assertEqual(f.read(), 'key {}'.format(i).encode())
+
+    def test_export(self):
+        name = self.tname("key.pem")
+        k = ECDSA256P1.generate()
+        k.export_private(name, overwrite=False)
+        self.assertEqual(self.mode(name), 0o600)
+        self.assertRaises(KeyFileExists,
+                ECDSA256P1.generate().export_private, name, overwrite=False)
+        self.assertEqual(load(name).get_public_bytes(), k.get_public_bytes())
+
+@unittest.skipIf(os.name == 'nt', "Unix file modes")
+class Permissions(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_modes(self):
+        name = self.tname("key.pem")
+        write_private(name, b'key')
+        for mode in [0o600, 0o400, 0o700]:
+            os.chmod(name, mode)
+            self.assertIsNone(check_permissions(name), oct(mode))
+        for mode in [0o640, 0o604, 0o644, 0o660, 0o666, 0o777]:
+            os.chmod(name, mode)
+            problem = check_permissions(name)
+            self.assertIsNotNone(problem, oct(mode))
+            self.assertIn("0{:o}".format(mode), problem)
+
+class Windows(unittest.TestCase):
+
+    def test_acl(self):
+        """Windows key files get an owner only ACL."""
+        with mock.patch.object(keyfile.subprocess, 'run') as run, \
+                mock.patch.object(keyfile.getpass, 'getuser',
+                        return_value='builder'):
+            keyfile.restrict_windows('C:\\keys\\key.pem')
+        args = run.call_args[0][0]
+        self.assertEqual(args, ['icacls', 'C:\\keys\\key.pem',
+            '/inheritance:r', '/grant:r', 'builder:F'])
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,85 @@
+"""
+Decryption of keys in the legacy encrypted PEM format, where the PEM
+block has "Proc-Type: 4,ENCRYPTED" and "DEK-Info" headers, as written
+by "openssl ec -aes256" and the like.
+"""
+
+import base64
+import hashlib
+import re
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.ciphers import Cipher, algorithms, modes
+
+try:
+    from cryptography.hazmat.decrepit.ciphers.algorithms import TripleDES
+except ImportError:
+    TripleDES = algorithms.TripleDES
+
+from .general import KeyUsageError
+from .secret import Secret
+
+# The ciphers OpenSSL uses for these keys, with their key size.  All
+# of them are CBC mode.
+CIPHERS = {
+        'AES-128-CBC': (algorithms.AES, 16),
+        'AES-192-CBC': (algorithms.AES, 24),
+        'AES-256-CBC': (algorithms.AES, 32),
+        'DES-EDE3-CBC': (TripleDES, 24),
+}
+
+PEM_BLOCK = re.compile(
+        rb'-----BEGIN ([A-Z0-9 ]+)-----\r?\n(.*?)-----END \1-----',
+        re.DOTALL)
+
+def is_encrypted(raw):
+    """Returns True if the file has a legacy encrypted PEM block."""
+    return find_block(raw) is not None
+
+def find_block(raw):
+    for m in PEM_BLOCK.finditer(raw):
+        if b'Proc-Type: 4,ENCRYPTED' in m.group(2):
+            return m
+    return None
+
+def bytes_to_key(passwd, salt, size):
+    """OpenSSL's EVP_BytesToKey, with MD5 and one iteration, which is
+    how these keys are derived from the passphrase."""
+    key = b''
+    block = b''
+    while len(key) < size:
+        block = hashlib.md5(block + passwd + salt).digest()
+        key += block
+    return key[:size]
+
+def decrypt(raw, passwd):
+    """Return the DER of the encrypted key, as a Secret.  Returns None
+    if the passphrase is wrong."""
+    m = find_block(raw)
+    headers, _, body = m.group(2).partition(b'\n\n')
+    if not body:
+        headers, _, body = m.group(2).partition(b'\r\n\r\n')
+    info = re.search(rb'DEK-Info: *([A-Z0-9-]+) *, *([0-9A-Fa-f]+)', headers)
+    if info is None:
+        raise KeyUsageError("Encrypted PEM key has no DEK-Info header")
+    name = info.group(1).decode('ascii')
+    if name not in CIPHERS:
+        raise KeyUsageError("Unsupported PEM encryption: {}".format(name))
+    algorithm, size = CIPHERS[name]
+    iv = bytes.fromhex(info.group(2).decode('ascii'))
+    key = bytes_to_key(passwd, iv[:8], size)
+    data = base64.b64decode(b''.join(body.split()))
+    if len(data) == 0 or len(data) % len(iv) != 0:
+        raise KeyUsageError("Encrypted PEM key is truncated")
+    dec = Cipher(algorithm(key), modes.CBC(iv),
+                 backend=default_backend()).decryptor()
+    plain = dec.update(data) + dec.finalize()
+
+    # A wrong passphrase shows up as bad padding, or failing that, as
+    # something that isn't a DER sequence.
+    pad = plain[-1]
+    if not 1 <= pad <= len(iv) or plain[-pad:] != bytes([pad]) * pad:
+        return None
+    if plain[:1] != b'\x30':
+        return None
+    return Secret(plain[:-pad])
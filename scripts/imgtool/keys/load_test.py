@@ -0,0 +1,205 @@
+"""
+Tests for reading key files
+"""
+
+import base64
+import os
+import sys
+import tempfile
+import unittest
+
+from cryptography.hazmat.primitives import serialization
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import ecparams, legacy
+from imgtool.keys import (load, KeyUsageError, RSA, RSAPublic, ECDSA256P1,
+                          ECDSA256P1Public, ECDSA384P1, ECDSA384P1Public,
+                          ECDSA521P1, ECDSAUsageError, Ed25519,
+                          Ed25519Public, X25519, UnsupportedKeyError)
+
+GENERATORS = [RSA.generate, ECDSA256P1.generate, ECDSA384P1.generate,
+              ECDSA521P1.generate, Ed25519.generate, X25519.generate]
+
+class LoadKeys(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_der(self):
+        """Keys written as DER are read back without being told the
+        encoding."""
+        for gen in GENERATORS:
+            k = gen()
+            name = self.tname("key.der")
+            k.export_private(name, encoding='der')
+            with open(name, 'rb') as f:
+                self.assertNotIn(b'-----BEGIN', f.read())
+            k2 = load(name)
+            self.assertIs(type(k2), type(k))
+            self.assertEqual(k2.get_public_bytes(), k.get_public_bytes())
+
+            k.export_private(name, encoding='der', passwd=b'secret')
+            self.assertIsNone(load(name))
+            self.assertEqual(load(name, b'secret').get_public_bytes(),
+                    k.get_public_bytes())
+
+            pubname = self.tname("pub.der")
+            with open(pubname, 'wb') as f:
+                f.write(k.key.public_key().public_bytes(
+                    encoding=serialization.Encoding.DER,
+                    format=serialization.PublicFormat.SubjectPublicKeyInfo))
+            self.assertEqual(load(pubname).get_public_bytes(),
+                    k.get_public_bytes())
+
+    def test_der_traditional(self):
+        for gen in [RSA.generate, ECDSA256P1.generate]:
+            k = gen()
+            name = self.tname("key.der")
+            k.export_private(name, encoding='der', format='traditional')
+            self.assertEqual(load(name).get_public_bytes(), k.get_public_bytes())
+
+            # There is no encrypted form of these.
+            self.assertRaises(KeyUsageError, k.export_private, name,
+                    encoding='der', format='traditional', passwd=b'secret')
+
+TESTDATA = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'testdata')
+
+# Keys written by OpenSSL, see testdata/README.md, with the class they
+# should load as.
+OPENSSL_KEYS = [
+        ('rsa2048-pkcs8.pem', RSA),
+        ('rsa2048-pkcs1.pem', RSA),
+        ('rsa2048-pkcs8.der', RSA),
+        ('p256-pkcs8.pem', ECDSA256P1),
+        ('p256-sec1-params.pem', ECDSA256P1),
+        ('p256-sec1.der', ECDSA256P1),
+        ('p384-pkcs8.pem', ECDSA384P1),
+        ('p384-sec1-params.pem', ECDSA384P1),
+        ('p384-sec1.der', ECDSA384P1),
+        ('ed25519-pkcs8.pem', Ed25519),
+        ('x25519-pkcs8.pem', X25519),
+        ('p256-explicit.pem', ECDSA256P1),
+        ('p256-explicit-pkcs8.pem', ECDSA256P1),
+        ('p256-explicit-pub.pem', ECDSA256P1Public),
+        ('p384-explicit.pem', ECDSA384P1),
+        ('p256-pub.pem', ECDSA256P1Public),
+        ('p384-pub.pem', ECDSA384P1Public),
+        ('rsa2048-pub.pem', RSAPublic),
+        ('ed25519-pub.pem', Ed25519Public),
+]
+
+# Fixtures that were converted from one another, so hold the same key.
+SAME_KEYS = [
+        ['rsa2048-pkcs8.pem', 'rsa2048-pkcs1.pem', 'rsa2048-pkcs8.der',
+         'rsa2048-pub.pem'],
+        ['p256-pkcs8.pem', 'p256-pub.pem'],
+        ['p384-pkcs8.pem', 'p384-pub.pem'],
+        ['ed25519-pkcs8.pem', 'ed25519-pub.pem'],
+        ['p256-sec1-params.pem', 'p256-sec1.der', 'p256-explicit.pem',
+         'p256-explicit-pkcs8.pem', 'p256-explicit-pub.pem'],
+        ['p384-sec1-params.pem', 'p384-sec1.der', 'p384-explicit.pem'],
+]
+
+class OpenSSLKeys(unittest.TestCase):
+
+    def test_load(self):
+        for name, cls in OPENSSL_KEYS:
+            self.assertIsInstance(load(os.path.join(TESTDATA, name)), cls, name)
+
+    def test_unsupported(self):
+        for name, message in [('ed448-pub.pem', 'key algorithm: Ed448'),
+                              ('secp256k1-pub.pem', 'EC curve: secp256k1')]:
+            with self.assertRaises(UnsupportedKeyError) as cm:
+                load(os.path.join(TESTDATA, name))
+            self.assertIn(message, str(cm.exception))
+
+    def test_same_key(self):
+        for names in SAME_KEYS:
+            pubs = [load(os.path.join(TESTDATA, name)).get_public_bytes()
+                    for name in names]
+            self.assertEqual(pubs, [pubs[0]] * len(pubs), names)
+
+class ExplicitParams(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_unsupported_curve(self):
+        self.assertRaises(ECDSAUsageError, load,
+                os.path.join(TESTDATA, 'secp256k1-explicit.pem'))
+
+    def test_der(self):
+        with open(os.path.join(TESTDATA, 'p256-explicit.pem'), 'rb') as f:
+            m = ecparams.PEM_BLOCK.search(f.read())
+        name = self.tname('key.der')
+        with open(name, 'wb') as f:
+            f.write(base64.b64decode(b''.join(m.group(2).split())))
+        self.assertEqual(load(name).get_public_bytes(),
+                load(os.path.join(TESTDATA, 'p256-sec1-params.pem')).get_public_bytes())
+
+    def test_mismatched_public(self):
+        """The public key in the file must be the one for the private
+        key."""
+        with open(os.path.join(TESTDATA, 'p256-explicit.pem'), 'rb') as f:
+            m = ecparams.PEM_BLOCK.search(f.read())
+        der = bytearray(base64.b64decode(b''.join(m.group(2).split())))
+        # The last byte is the end of the public point's y coordinate.
+        der[-1] ^= 1
+        name = self.tname('key.der')
+        with open(name, 'wb') as f:
+            f.write(der)
+        self.assertRaises(ECDSAUsageError, load, name)
+
+    def test_not_explicit(self):
+        with open(os.path.join(TESTDATA, 'p256-sec1.der'), 'rb') as f:
+            self.assertIsNone(ecparams.load(f.read()))
+
+# Keys in the legacy encrypted PEM format, with the unencrypted key
+# each was made from.
+LEGACY_KEYS = [
+        ('p256-sec1-aes128.pem', 'p256-sec1-params.pem'),
+        ('p256-sec1-aes192.pem', 'p256-sec1-params.pem'),
+        ('p256-sec1-aes256.pem', 'p256-sec1-params.pem'),
+        ('p256-sec1-des3.pem', 'p256-sec1-params.pem'),
+        ('rsa2048-pkcs1-aes256.pem', 'rsa2048-pkcs1.pem'),
+]
+
+class LegacyEncryptedKeys(unittest.TestCase):
+
+    def test_decrypt(self):
+        for name, plain in LEGACY_KEYS:
+            path = os.path.join(TESTDATA, name)
+            self.assertTrue(legacy.is_encrypted(open(path, 'rb').read()))
+            self.assertIsNone(load(path), name)
+            k = load(path, b'secret')
+            self.assertEqual(k.get_public_bytes(),
+                    load(os.path.join(TESTDATA, plain)).get_public_bytes(),
+                    name)
+
+    def test_wrong_passphrase(self):
+        for name, _ in LEGACY_KEYS:
+            for passwd in [b'wrong', b'', b'secret2']:
+                self.assertIsNone(load(os.path.join(TESTDATA, name), passwd),
+                                  name)
+
+    def test_bytes_to_key(self):
+        # From "openssl enc -aes-256-cbc -P -md md5 -pass pass:secret
+        # -S 0001020304050607".
+        self.assertEqual(legacy.bytes_to_key(b'secret', bytes(range(8)), 32).hex(),
+                '035fb8145b73cf111570dc936112be9c375a5d3d8b915bc213bdbef9dbfb7851')
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,119 @@
+"""
+Tests for reading OpenSSH private keys
+"""
+
+import os
+import shutil
+import subprocess
+import sys
+import tempfile
+import unittest
+
+from cryptography.hazmat.primitives import serialization
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import bcrypt_pbkdf, info, load, openssh
+from imgtool.keys import ECDSA256P1, ECDSA384P1, Ed25519, KeyUsageError
+
+TESTDATA = os.path.join(os.path.dirname(__file__), 'testdata')
+
+# The fixtures, with the class of the key in each.  The encrypted ones
+# have the passphrase "secret".
+OPENSSH_KEYS = [
+        ('p256-openssh.key', ECDSA256P1),
+        ('p384-openssh.key', ECDSA384P1),
+        ('ed25519-openssh.key', Ed25519),
+        ('p256-openssh-aes256ctr.key', ECDSA256P1),
+        ('ed25519-openssh-aes256gcm.key', Ed25519),
+]
+
+def openssh_public(key):
+    """The public key as ssh-keygen -y writes it, without the comment."""
+    return key._get_public().public_bytes(
+            serialization.Encoding.OpenSSH,
+            serialization.PublicFormat.OpenSSH).decode('ascii')
+
+def read(name):
+    with open(os.path.join(TESTDATA, name), 'rb') as f:
+        return f.read()
+
+class OpenSSHKeys(unittest.TestCase):
+
+    def test_load(self):
+        for name, cls in OPENSSH_KEYS:
+            k = load(os.path.join(TESTDATA, name), b'secret')
+            self.assertIsInstance(k, cls, name)
+            # The .pub files are the output of ssh-keygen -y.
+            expected = read(name[:-len('.key')] + '.pub').decode('ascii')
+            self.assertEqual(openssh_public(k), ' '.join(expected.split()[:2]),
+                             name)
+
+    @unittest.skipIf(shutil.which('ssh-keygen') is None, "No ssh-keygen")
+    def test_ssh_keygen(self):
+        with tempfile.TemporaryDirectory() as d:
+            for name, _ in OPENSSH_KEYS:
+                # ssh-keygen refuses keys others can read, as the
+                # fixtures are.
+                path = os.path.join(d, name)
+                shutil.copyfile(os.path.join(TESTDATA, name), path)
+                os.chmod(path, 0o600)
+                out = subprocess.check_output(
+                        ['ssh-keygen', '-y', '-P', 'secret', '-f', path])
+                k = load(path, b'secret')
+                self.assertEqual(openssh_public(k),
+                                 ' '.join(out.decode('ascii').split()[:2]),
+                                 name)
+
+    def test_passphrase(self):
+        """Encrypted keys need the passphrase, and the wrong one is
+        noticed, as for other key files."""
+        path = os.path.join(TESTDATA, 'p256-openssh-aes256ctr.key')
+        self.assertIsNone(load(path))
+        self.assertIsNone(load(path, b'wrong'))
+        path = os.path.join(TESTDATA, 'ed25519-openssh-aes256gcm.key')
+        self.assertIsNone(load(path, b'wrong'))
+
+    def test_unsupported(self):
+        with self.assertRaises(KeyUsageError) as cm:
+            load(os.path.join(TESTDATA, 'rsa2048-openssh.key'))
+        self.assertIn('only ECDSA and Ed25519', str(cm.exception))
+
+    def test_corrupt(self):
+        raw = read('p256-openssh.key')
+        begin = raw.index(b'\n') + 1
+        for broken in [raw[:begin] + b'AAAA' + raw[begin + 4:],
+                       raw[:begin + 100] + raw[begin + 160:]]:
+            with self.assertRaises(KeyUsageError):
+                openssh.load(broken)
+
+    def test_keyinfo(self):
+        fmt = info.file_format(read('p256-openssh.key'))
+        self.assertEqual(fmt['format'], 'OpenSSH')
+        self.assertFalse(fmt['encrypted'])
+        fmt = info.file_format(read('ed25519-openssh-aes256gcm.key'))
+        self.assertTrue(fmt['encrypted'])
+        self.assertEqual(fmt['cipher'], 'aes256-gcm@openssh.com')
+
+class BcryptPbkdf(unittest.TestCase):
+
+    def test_vector(self):
+        """From the tests of OpenBSD's bcrypt_pbkdf."""
+        self.assertEqual(bcrypt_pbkdf.kdf(b'password', b'salt', 32, 4).hex(),
+                '5bbf0cc293587f1c3635555c27796598d47e579071bf427e9d8fbe842aba34d9')
+
+    def test_pure_python(self):
+        """The fallback gives what the bcrypt package does."""
+        saved = bcrypt_pbkdf._bcrypt
+        bcrypt_pbkdf._bcrypt = None
+        try:
+            out = bcrypt_pbkdf.kdf(b'secret', b'0123456789abcdef', 48, 1)
+        finally:
+            bcrypt_pbkdf._bcrypt = saved
+        self.assertEqual(len(out), 48)
+        if saved is not None:
+            self.assertEqual(out, bcrypt_pbkdf.kdf(b'secret',
+                                                   b'0123456789abcdef', 48, 1))
+
+if __name__ == '__main__':
+    unittest.main()
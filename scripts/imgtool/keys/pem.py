@@ -0,0 +1,89 @@
+"""
+Choosing one key from a PEM file that holds several, such as a signing
+key and an encryption key kept together.  Blocks that don't hold a
+key, such as "EC PARAMETERS", are skipped.
+"""
+
+import re
+
+from .general import KeyUsageError
+from .secret import Secret
+
+PEM_BLOCK = re.compile(
+        rb'-----BEGIN ([A-Z0-9 ]+)-----\r?\n.*?-----END \1-----\r?\n?',
+        re.DOTALL)
+
+BEGIN_LINE = re.compile(rb'-----BEGIN ([A-Z0-9 ]+)-----')
+
+PRIVATE_TYPES = ('PRIVATE KEY', 'ENCRYPTED PRIVATE KEY', 'EC PRIVATE KEY',
+                 'RSA PRIVATE KEY', 'OPENSSH PRIVATE KEY', 'AES KEY')
+PUBLIC_TYPES = ('PUBLIC KEY', 'RSA PUBLIC KEY')
+
+class PEMSelectionError(KeyUsageError):
+    pass
+
+def key_blocks(raw):
+    """The blocks holding keys, as (type, start, end) tuples."""
+    if b'-----BEGIN' not in raw:
+        return []
+    blocks = []
+    for m in PEM_BLOCK.finditer(raw):
+        label = m.group(1).decode('ascii')
+        if label in PRIVATE_TYPES or label in PUBLIC_TYPES:
+            blocks.append((label, m.start(), m.end()))
+    return blocks
+
+def missing_key(raw):
+    """Why the PEM data holds no key to load, or None if it holds one.
+    Blocks that aren't keys are skipped wherever they are, so this is
+    only a problem if there is nothing else."""
+    if key_blocks(raw):
+        return None
+    for m in BEGIN_LINE.finditer(raw):
+        label = m.group(1).decode('ascii')
+        if label in PRIVATE_TYPES or label in PUBLIC_TYPES:
+            return "The {} block is truncated".format(label)
+    labels = [m.group(1).decode('ascii') for m in PEM_BLOCK.finditer(raw)]
+    if labels:
+        return "No PEM key found, only {}".format(", ".join(labels))
+    return "No complete PEM block found"
+
+def _listing(blocks):
+    return ", ".join("{}: {}".format(n, label)
+                     for n, (label, _, _) in enumerate(blocks))
+
+def check(raw):
+    """Refuse a file with more than one private key, when none has been
+    chosen, rather than guess which is meant."""
+    blocks = key_blocks(raw)
+    if len([b for b in blocks if b[0] in PRIVATE_TYPES]) > 1:
+        raise PEMSelectionError(
+                "The file holds several private keys ({}), choose one "
+                "with --key-index or --key-pem-type".format(_listing(blocks)))
+
+def select(raw, index=None, pem_type=None):
+    """The chosen block of the key file, as a Secret that the caller
+    should zeroize.  index counts the key blocks from 0, among those of
+    pem_type, if that is given too."""
+    blocks = key_blocks(raw)
+    if not blocks:
+        raise PEMSelectionError("The file holds no PEM keys to choose from")
+    candidates = blocks
+    if pem_type is not None:
+        candidates = [b for b in blocks if b[0] == pem_type]
+        if not candidates:
+            raise PEMSelectionError(
+                    "The file holds no {} block, only {}".format(
+                        pem_type, _listing(blocks)))
+    if index is None:
+        if len(candidates) > 1:
+            raise PEMSelectionError(
+                    "The file holds {} {} blocks, choose one with "
+                    "--key-index".format(len(candidates), pem_type))
+        index = 0
+    if not 0 <= index < len(candidates):
+        raise PEMSelectionError(
+                "There is no key {}, the file holds {}".format(
+                    index, _listing(candidates)))
+    _, start, end = candidates[index]
+    return Secret(raw[start:end])
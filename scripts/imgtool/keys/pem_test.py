@@ -0,0 +1,80 @@
+"""
+Tests for choosing a key from a PEM file holding several
+"""
+
+import os
+import sys
+import unittest
+
+from cryptography.hazmat.primitives import serialization
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import load, load_bytes, pem, ECDSA256P1, RSA
+from imgtool.keys import PEMSelectionError
+
+TESTDATA = os.path.join(os.path.dirname(__file__), 'testdata')
+
+def read(name):
+    with open(os.path.join(TESTDATA, name), 'rb') as f:
+        return f.read()
+
+class PEMBlocks(unittest.TestCase):
+
+    def test_key_blocks(self):
+        raw = read('multi-rsa-ec.pem')
+        labels = [label for label, _, _ in pem.key_blocks(raw)]
+        self.assertEqual(labels, ['PRIVATE KEY', 'EC PRIVATE KEY'])
+        self.assertEqual(pem.key_blocks(read('p256-raw.bin')), [])
+
+    def test_check(self):
+        for name in ['multi-ec-rsa.pem', 'multi-rsa-ec.pem']:
+            with self.assertRaises(PEMSelectionError) as cm:
+                load(os.path.join(TESTDATA, name))
+            self.assertIn('--key-index', str(cm.exception))
+        # A private key with its public key is not ambiguous.
+        key = load(os.path.join(TESTDATA, 'p256-pkcs8.pem'))
+        raw = read('p256-pkcs8.pem') + key._get_public().public_bytes(
+                serialization.Encoding.PEM,
+                serialization.PublicFormat.SubjectPublicKeyInfo)
+        self.assertIsInstance(load_bytes(raw), ECDSA256P1)
+
+    def test_select(self):
+        path = os.path.join(TESTDATA, 'multi-ec-rsa.pem')
+        self.assertIsInstance(load(path, index=0), ECDSA256P1)
+        self.assertIsInstance(load(path, index=1), RSA)
+        self.assertIsInstance(load(path, pem_type='PRIVATE KEY'), ECDSA256P1)
+        self.assertIsInstance(load(path, pem_type='RSA PRIVATE KEY'), RSA)
+        self.assertEqual(
+                load(path, index=0).get_public_bytes(),
+                load(os.path.join(TESTDATA, 'p256-pkcs8.pem')).get_public_bytes())
+
+    def test_select_within_type(self):
+        raw = read('p256-pkcs8.pem') + read('rsa2048-pkcs8.pem')
+        with self.assertRaises(PEMSelectionError) as cm:
+            load_bytes(raw, pem_type='PRIVATE KEY')
+        self.assertIn('2 PRIVATE KEY blocks', str(cm.exception))
+        self.assertIsInstance(load_bytes(raw, pem_type='PRIVATE KEY', index=1),
+                              RSA)
+
+    def test_missing_key(self):
+        self.assertIsNone(pem.missing_key(read('p256-sec1-params.pem')))
+        raw = read('p256-pkcs8.pem')
+        self.assertIn('truncated', pem.missing_key(raw[:100]))
+        self.assertIn('only EC PARAMETERS',
+                      pem.missing_key(read('p256-sec1-params.pem')
+                                      .split(b'-----BEGIN EC PRIVATE')[0]))
+        self.assertEqual(pem.missing_key(b'-----BEGIN'),
+                         "No complete PEM block found")
+
+    def test_errors(self):
+        raw = read('multi-ec-rsa.pem')
+        with self.assertRaises(PEMSelectionError):
+            load_bytes(raw, index=2)
+        with self.assertRaises(PEMSelectionError):
+            load_bytes(raw, pem_type='EC PRIVATE KEY')
+        with self.assertRaises(PEMSelectionError):
+            load_bytes(read('p256-sec1.der'), index=0)
+
+if __name__ == '__main__':
+    unittest.main()
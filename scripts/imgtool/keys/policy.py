@@ -0,0 +1,33 @@
+"""
+The minimum strength of the keys used to sign images, or to build into
+the bootloader.  Weaker keys can only be used with an explicit override.
+"""
+
+from .ecdsa import ECDSAPublic
+from .general import KeyUsageError
+from .rsa import RSAPublic, RSA_MIN_EXPONENT, RSA_MIN_KEY_SIZE
+
+# EC curves smaller than this are deprecated.
+EC_MIN_KEY_SIZE = 256
+
+class WeakKeyError(KeyUsageError):
+    pass
+
+def check_strength(key):
+    """Raise WeakKeyError, naming the weak property, if the key is below
+    the minimum strength."""
+    if isinstance(key, RSAPublic):
+        if key.key_size() < RSA_MIN_KEY_SIZE:
+            raise WeakKeyError(
+                    "RSA key size is {} bits, below the minimum of {} bits".format(
+                        key.key_size(), RSA_MIN_KEY_SIZE))
+        exponent = key._get_public().public_numbers().e
+        if exponent < RSA_MIN_EXPONENT:
+            raise WeakKeyError(
+                    "RSA public exponent is {}, below the minimum of {}".format(
+                        exponent, RSA_MIN_EXPONENT))
+    elif isinstance(key, ECDSAPublic):
+        if key.curve.key_size < EC_MIN_KEY_SIZE:
+            raise WeakKeyError(
+                    "EC curve {} is {} bits, below the minimum of {} bits".format(
+                        key.curve.name, key.curve.key_size, EC_MIN_KEY_SIZE))
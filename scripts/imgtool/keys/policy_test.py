@@ -0,0 +1,50 @@
+"""
+Tests for the key strength policy
+"""
+
+import os
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import (load, check_strength, WeakKeyError, ECDSA224P1,
+                          ECDSA256P1, ECDSABP256R1, Ed25519, RSAPublic, X25519)
+
+TESTDATA = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'testdata')
+
+def fixture(name):
+    return load(os.path.join(TESTDATA, name))
+
+class Strength(unittest.TestCase):
+
+    def assertWeak(self, key, *words):
+        with self.assertRaises(WeakKeyError) as cm:
+            check_strength(key)
+        for word in words:
+            self.assertIn(word, str(cm.exception))
+
+    def test_rsa_size(self):
+        self.assertWeak(fixture('rsa1024-pkcs8.pem'),
+                        "RSA key size", "1024 bits", "minimum of 2048 bits")
+        # The public half is just as weak.
+        self.assertWeak(RSAPublic(fixture('rsa1024-pkcs8.pem').key.public_key()),
+                        "RSA key size")
+
+    def test_rsa_exponent(self):
+        self.assertWeak(fixture('rsa2048-e3-pkcs8.pem'),
+                        "RSA public exponent", "is 3", "minimum of 65537")
+
+    def test_deprecated_curve(self):
+        self.assertWeak(fixture('p224-pkcs8.pem'),
+                        "secp224r1", "224 bits", "minimum of 256 bits")
+        self.assertWeak(ECDSA224P1.generate(), "secp224r1")
+
+    def test_strong(self):
+        for key in [fixture('rsa2048-pkcs8.pem'), fixture('p384-pkcs8.pem'),
+                    ECDSA256P1.generate(), ECDSABP256R1.generate(),
+                    Ed25519.generate(), X25519.generate()]:
+            check_strength(key)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,39 @@
+"""
+EC private keys stored as nothing but the private scalar, a big-endian
+integer the size of the curve, as some provisioning tools export them.
+Nothing in such a file says what it holds, so the format has to be
+given, as one of RAW_FORMATS.
+"""
+
+import collections
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.asymmetric import ec
+
+from .ecdsa import ECDSAUsageError
+from .ecparams import CURVES
+
+RAW_FORMATS = collections.OrderedDict([
+        ('raw-p256', ec.SECP256R1),
+        ('raw-p384', ec.SECP384R1),
+])
+
+def _order(curve):
+    for known, params in CURVES:
+        if known is curve:
+            return params[-1]
+
+def load(raw, fmt):
+    """The cryptography private key with the scalar in raw, on the curve
+    of the format.  The public point is computed from it."""
+    curve = RAW_FORMATS[fmt]
+    size = (curve.key_size + 7) // 8
+    if len(raw) != size:
+        raise ECDSAUsageError(
+                "A {} key is a {} byte scalar, but the file has {} "
+                "bytes".format(fmt, size, len(raw)))
+    scalar = int.from_bytes(raw, 'big')
+    if not 0 < scalar < _order(curve):
+        raise ECDSAUsageError(
+                "The scalar is out of range for a {} key".format(fmt))
+    return ec.derive_private_key(scalar, curve(), default_backend())
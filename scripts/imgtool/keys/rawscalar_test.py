@@ -0,0 +1,82 @@
+"""
+Tests for EC keys stored as a bare scalar
+"""
+
+import os
+import sys
+import unittest
+
+from cryptography.hazmat.primitives.asymmetric import ec
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import (load, load_bytes, ECDSA256P1, ECDSA384P1,
+                          ECDSAUsageError, RAW_FORMATS)
+from imgtool.keys.ecparams import CURVES
+
+TESTDATA = os.path.join(os.path.dirname(__file__), 'testdata')
+
+def multiply(curve, scalar):
+    """The public point of the scalar, by double and add in affine
+    coordinates, as a check on the crypto library."""
+    p, a, _, gx, gy, _ = dict(CURVES)[curve]
+    def add(P, Q):
+        if P is None:
+            return Q
+        if Q is None:
+            return P
+        if P[0] == Q[0] and (P[1] + Q[1]) % p == 0:
+            return None
+        if P == Q:
+            slope = (3 * P[0] * P[0] + a) * pow(2 * P[1], -1, p)
+        else:
+            slope = (Q[1] - P[1]) * pow(Q[0] - P[0], -1, p)
+        x = (slope * slope - P[0] - Q[0]) % p
+        return x, (slope * (P[0] - x) - P[1]) % p
+    result, addend = None, (gx, gy)
+    while scalar:
+        if scalar & 1:
+            result = add(result, addend)
+        addend = add(addend, addend)
+        scalar >>= 1
+    return result
+
+class RawScalar(unittest.TestCase):
+
+    def test_public_point(self):
+        for name, fmt, cls in [('p256-raw.bin', 'raw-p256', ECDSA256P1),
+                               ('p384-raw.bin', 'raw-p384', ECDSA384P1)]:
+            path = os.path.join(TESTDATA, name)
+            k = load(path, key_format=fmt)
+            self.assertIsInstance(k, cls)
+            with open(path, 'rb') as f:
+                scalar = int.from_bytes(f.read(), 'big')
+            nums = k._get_public().public_numbers()
+            self.assertEqual((nums.x, nums.y),
+                             multiply(RAW_FORMATS[fmt], scalar), name)
+
+    def test_same_as_sec1(self):
+        """The fixtures hold the scalars of the SEC1 fixtures."""
+        for raw, sec1, fmt in [('p256-raw.bin', 'p256-sec1.der', 'raw-p256'),
+                               ('p384-raw.bin', 'p384-sec1.der', 'raw-p384')]:
+            self.assertEqual(
+                    load(os.path.join(TESTDATA, raw),
+                         key_format=fmt).get_public_bytes(),
+                    load(os.path.join(TESTDATA, sec1)).get_public_bytes())
+
+    def test_out_of_range(self):
+        order = dict(CURVES)[ec.SECP256R1][-1]
+        for scalar in [0, order, order + 1, 2 ** 256 - 1]:
+            with self.assertRaises(ECDSAUsageError):
+                load_bytes(scalar.to_bytes(32, 'big'), key_format='raw-p256')
+        k = load_bytes((order - 1).to_bytes(32, 'big'), key_format='raw-p256')
+        self.assertIsInstance(k, ECDSA256P1)
+
+    def test_wrong_size(self):
+        for size in [0, 31, 33, 48]:
+            with self.assertRaises(ECDSAUsageError) as cm:
+                load_bytes(b'\x01' * size, key_format='raw-p256')
+            self.assertIn('32 byte scalar', str(cm.exception))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -2,18 +2,81 @@
 RSA Key management
 """
 
+import collections
+
+from cryptography.exceptions import InvalidSignature
 from cryptography.hazmat.backends import default_backend
 from cryptography.hazmat.primitives import serialization
 from cryptography.hazmat.primitives.asymmetric import rsa
 from cryptography.hazmat.primitives.asymmetric.padding import PSS, MGF1
+from cryptography.hazmat.primitives.asymmetric.utils import Prehashed
 from cryptography.hazmat.primitives.hashes import SHA256
 
-from .general import KeyClass
+from .general import KeyClass, KeyUsageError, export_private_key
+from .keyfile import write_public
+from . import jwk
+from . import seeded
+
+# The standard sizes of RSA keys.  Other sizes can be generated, but
+# must be explicitly asked for.
+RSA_KEY_SIZES = [2048, 3072, 4096]
+
+# Smaller keys are never generated.
+RSA_MIN_KEY_SIZE = 2048
+
+# Smallest public exponent accepted without an explicit override.
+RSA_MIN_EXPONENT = 65537
+
+# How getpub can encode the public key: the PKCS#1 RSAPublicKey, or
+# that wrapped in the X.509 SubjectPublicKeyInfo.
+RSA_ENCODINGS = collections.OrderedDict([
+        ('pkcs1', serialization.PublicFormat.PKCS1),
+        ('spki', serialization.PublicFormat.SubjectPublicKeyInfo),
+])
 
-class RSAUsageError(Exception):
+# The TLV holding the signature of each size of key the bootloader can
+# verify.
+RSA_SIG_TLVS = collections.OrderedDict([
+        (2048, "RSA2048"),
+        (3072, "RSA3072"),
+])
+
+class RSAUsageError(KeyUsageError):
     pass
 
-class RSA2048Public(KeyClass):
+def check_key_size(key_size, allow_nonstandard=False):
+    """Validate the size of a key to be generated."""
+    if key_size < RSA_MIN_KEY_SIZE:
+        raise RSAUsageError("RSA keys must be at least {} bits, not {}".format(
+            RSA_MIN_KEY_SIZE, key_size))
+    if key_size in RSA_KEY_SIZES:
+        return
+    if not allow_nonstandard:
+        raise RSAUsageError(
+                "RSA key size {} is not one of the standard sizes {}".format(
+                    key_size, ", ".join(str(k) for k in RSA_KEY_SIZES)))
+    if key_size % 8 != 0:
+        raise RSAUsageError("RSA key size {} is not a multiple of 8".format(
+            key_size))
+
+def check_exponent(exponent, allow_weak=False):
+    """Validate a public exponent requested for key generation.
+
+    Even exponents are never valid.  Exponents below 65537 are only
+    accepted when allow_weak is set."""
+    if exponent % 2 == 0:
+        raise RSAUsageError("RSA public exponent must be odd, not {}".format(exponent))
+    if exponent < RSA_MIN_EXPONENT and not allow_weak:
+        raise RSAUsageError(
+                "RSA public exponent {} is below {}, override required".format(
+                    exponent, RSA_MIN_EXPONENT))
+    # This is a limitation of the cryptography library.
+    if exponent not in (3, 65537):
+        raise RSAUsageError(
+                "RSA public exponent {} is not supported, use 65537 (or 3)".format(
+                    exponent))
+
+class RSAPublic(KeyClass):
     """The public key can only do a few operations"""
     def __init__(self, key):
         self.key = key
@@ -27,35 +90,71 @@ class RSA2048Public(KeyClass):
     def _get_public(self):
         return self.key
 
-    def get_public_bytes(self):
-        # The key embedded into MCUboot is in PKCS1 format.
+    def key_size(self):
+        return self.key.key_size
+
+    def get_public_bytes(self, encoding='pkcs1'):
+        """The public key as DER, in one of the RSA_ENCODINGS.  The key
+        embedded into MCUboot is in PKCS1 format, but an mbedTLS built
+        to parse it with mbedtls_pk_parse_public_key wants the
+        SubjectPublicKeyInfo around it."""
+        if encoding not in RSA_ENCODINGS:
+            raise RSAUsageError("Unknown RSA encoding: {}".format(encoding))
         return self._get_public().public_bytes(
                 encoding=serialization.Encoding.DER,
-                format=serialization.PublicFormat.PKCS1)
+                format=RSA_ENCODINGS[encoding])
 
-    def export_private(self, path, passwd=None):
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
         self._unsupported('export_private')
 
-    def export_public(self, path):
+    def _raw_public_bytes(self):
+        # The modulus, the size of the key, then a 4 byte exponent.
+        nums = self._get_public().public_numbers()
+        return (nums.n.to_bytes((self.key_size() + 7) // 8, 'big') +
+                nums.e.to_bytes(4, 'big'))
+
+    def export_public(self, path, overwrite=True):
         """Write the public key to the given file."""
-        pem = self._get_public().public_bytes(
-                encoding=serialization.Encoding.PEM,
-                format=serialization.PublicFormat.SubjectPublicKeyInfo)
-        with open(path, 'wb') as f:
-            f.write(pem)
+        write_public(path, self.public_pem(), overwrite=overwrite)
+
+    def _jwk_members(self):
+        nums = self._get_public().public_numbers()
+        return {'kty': 'RSA',
+                'n': jwk.b64url(jwk.uint_bytes(nums.n)),
+                'e': jwk.b64url(jwk.uint_bytes(nums.e))}
 
     def sig_type(self):
-        return "PKCS1_PSS_RSA2048_SHA256"
+        return "PKCS1_PSS_RSA{}_SHA256".format(self.key_size())
 
     def sig_tlv(self):
-        return "RSA2048"
+        if self.key_size() not in RSA_SIG_TLVS:
+            raise RSAUsageError(
+                    "Signing with RSA-{} keys is not supported, only {}".format(
+                        self.key_size(), " and ".join(
+                            "RSA-{}".format(k) for k in RSA_SIG_TLVS)))
+        return RSA_SIG_TLVS[self.key_size()]
 
     def sig_len(self):
-        return 256
-
-class RSA2048(RSA2048Public):
+        return self.key_size() // 8
+
+    def verify_digest(self, sig, digest, sha='256'):
+        """Whether sig is the RSA-PSS signature by this key of digest,
+        the SHA256 hash of the image, as the bootloader checks it."""
+        if sha != '256':
+            return False
+        try:
+            self._get_public().verify(
+                    sig, digest,
+                    padding=PSS(mgf=MGF1(SHA256()), salt_length=32),
+                    algorithm=Prehashed(SHA256()))
+        except InvalidSignature:
+            return False
+        return True
+
+class RSA(RSAPublic):
     """
-    Wrapper around an 2048-bit RSA key, with imgtool support.
+    Wrapper around an RSA key, with imgtool support.
     """
 
     def __init__(self, key):
@@ -63,33 +162,57 @@ class RSA2048(RSA2048Public):
         self.key = key
 
     @staticmethod
-    def generate():
+    def generate(key_size=2048, exponent=RSA_MIN_EXPONENT, allow_weak=False,
+                 seed=None, allow_nonstandard=False):
+        """Generate a new key.  If a seed is given, the key is derived
+        from it, which is only suitable for testing."""
+        check_key_size(key_size, allow_nonstandard=allow_nonstandard)
+        check_exponent(exponent, allow_weak=allow_weak)
+        if seed is not None:
+            return RSA(seeded.rsa_private_key(seed, key_size, exponent))
         pk = rsa.generate_private_key(
-                public_exponent=65537,
-                key_size=2048,
+                public_exponent=exponent,
+                key_size=key_size,
                 backend=default_backend())
-        return RSA2048(pk)
+        return RSA(pk)
 
     def _get_public(self):
         return self.key.public_key()
 
-    def export_private(self, path, passwd=None):
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
         """Write the private key to the given file, protecting it with the optional password."""
-        if passwd is None:
-            enc = serialization.NoEncryption()
-        else:
-            enc = serialization.BestAvailableEncryption(passwd)
-        pem = self.key.private_bytes(
-                encoding=serialization.Encoding.PEM,
-                format=serialization.PrivateFormat.PKCS8,
-                encryption_algorithm=enc)
-        with open(path, 'wb') as f:
-            f.write(pem)
-
-    def sign(self, payload):
-        # The verification code only allows the salt length to be the
-        # same as the hash length, 32.
+        export_private_key(self.key, path, passwd=passwd, format=format,
+                           overwrite=overwrite, encoding=encoding,
+                           metadata=metadata)
+
+    def sign(self, payload, sha='256', deterministic=False):
+        self._check_sign(sha, deterministic)
         return self.key.sign(
                 data=payload,
                 padding=PSS(mgf=MGF1(SHA256()), salt_length=32),
                 algorithm=SHA256())
+
+    def sign_digest(self, digest, sha='256', deterministic=False):
+        """The signature sign gives of an image whose SHA256 hash is
+        digest, for an image too big to hold."""
+        self._check_sign(sha, deterministic)
+        return self.key.sign(
+                data=digest,
+                padding=PSS(mgf=MGF1(SHA256()), salt_length=32),
+                algorithm=Prehashed(SHA256()))
+
+    def _check_sign(self, sha, deterministic):
+        # The verification code only allows the salt length to be the
+        # same as the hash length, 32, and the hash to be SHA256.
+        if sha != '256':
+            raise RSAUsageError("RSA keys only sign the SHA256 hash")
+        if deterministic:
+            raise RSAUsageError(
+                    "RSA-PSS signatures have a random 32 byte salt, which "
+                    "the bootloader requires and cryptography gives no way "
+                    "to fix, so RSA keys can't sign deterministically")
+
+# The original names, from when only 2048-bit keys were supported.
+RSA2048Public = RSAPublic
+RSA2048 = RSA
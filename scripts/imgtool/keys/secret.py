@@ -0,0 +1,74 @@
+"""
+Buffers holding secrets, such as passphrases and the contents of private
+key files, that are wiped once they have been used.
+
+Python makes no real guarantees here.  This only wipes the buffers we
+manage ourselves.  The immutable bytes objects made along the way,
+whether by the interpreter, by the crypto library while parsing, or
+where an API insists on bytes, can't be wiped.  The memory of freed
+objects isn't cleared either, and may have been swapped out.  The aim is
+to keep fewer copies around for less time, not to leave none.
+"""
+
+import os
+import sys
+
+class Secret(bytearray):
+    """A bytearray that can be wiped.  Being a bytearray, it can be
+    handed to anything taking bytes-like data without another copy."""
+
+    def zeroize(self):
+        """Overwrite the contents with zeros, in place."""
+        self[:] = bytes(len(self))
+
+    @property
+    def zeroized(self):
+        return not any(self)
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *args):
+        self.zeroize()
+
+    def __repr__(self):
+        # Never show the secret itself.
+        return "<Secret, {} bytes>".format(len(self))
+
+def read(path):
+    """Read the whole file into a Secret."""
+    with open(path, 'rb', buffering=0) as f:
+        return read_from(f)
+
+def read_from(f):
+    """Read an unbuffered binary file into a Secret, with readinto, so
+    there are no intermediate bytes copies.  Growing the buffer, for
+    files that are larger than they claim, can leave old copies in freed
+    memory."""
+    try:
+        size = os.fstat(f.fileno()).st_size
+    except (AttributeError, OSError, ValueError):
+        size = 0
+    # One more byte than expected, to see the end of the file.
+    buf = Secret(size + 1)
+    count = 0
+    while True:
+        if count == len(buf):
+            buf.extend(bytes(max(4096, len(buf))))
+        with memoryview(buf) as view, view[count:] as rest:
+            n = f.readinto(rest)
+        if not n:
+            break
+        count += n
+    del buf[count:]
+    return buf
+
+def read_stdin():
+    """Read all of stdin into a Secret, for a key piped in."""
+    try:
+        f = open(sys.stdin.fileno(), 'rb', buffering=0, closefd=False)
+    except (AttributeError, OSError, ValueError):
+        # Not a real file, as under test harnesses.
+        return read_from(sys.stdin.buffer)
+    with f:
+        return read_from(f)
@@ -0,0 +1,106 @@
+"""
+Tests for wiping secrets
+"""
+
+import io
+import os
+import sys
+import tempfile
+import unittest
+from unittest import mock
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool import image
+from imgtool.keys import (load, secret, Secret, AES, ECDSA256P1,
+                          ECDSABP256R1, Ed25519, RSA)
+
+class Secrets(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_zeroize(self):
+        s = Secret(b'hunter2')
+        view = memoryview(s)
+        s.zeroize()
+        self.assertTrue(s.zeroized)
+        self.assertEqual(len(s), 7)
+        # The memory was overwritten, not replaced.
+        self.assertEqual(bytes(view), bytes(7))
+
+    def test_context(self):
+        with Secret(b'hunter2') as s:
+            self.assertEqual(s, b'hunter2')
+        self.assertTrue(s.zeroized)
+
+    def test_repr(self):
+        self.assertNotIn('hunter2', repr(Secret(b'hunter2')))
+
+    def test_read(self):
+        for size in [0, 1, 100, 5000]:
+            name = self.tname('data')
+            data = os.urandom(size)
+            with open(name, 'wb') as f:
+                f.write(data)
+            s = secret.read(name)
+            self.assertIsInstance(s, Secret)
+            self.assertEqual(s, data)
+
+    def test_read_growing(self):
+        """Files larger than their size says still read fully."""
+        data = os.urandom(10000)
+        self.assertEqual(secret.read_from(io.BytesIO(data)), data)
+
+    def test_load_wipes_file(self):
+        """The contents of the key file, read by load, are wiped once
+        the key is loaded."""
+        name = self.tname('key.pem')
+        ECDSA256P1.generate().export_private(name)
+        wiped = []
+        real = Secret.zeroize
+        def zeroize(s):
+            real(s)
+            wiped.append(bytes(s))
+        with mock.patch.object(Secret, 'zeroize', autospec=True,
+                               side_effect=zeroize):
+            self.assertIsNotNone(load(name))
+        self.assertEqual(wiped, [bytes(os.path.getsize(name))])
+
+    def test_sign_all_types(self):
+        """Signing works with keys loaded with a Secret passphrase, and
+        the key is gone once zeroized."""
+        # P-384 keys have no signature TLV yet.
+        for gen in [RSA.generate, ECDSA256P1.generate,
+                    ECDSABP256R1.generate, Ed25519.generate]:
+            k = gen()
+            name = self.tname('key.pem')
+            k.export_private(name, passwd=Secret(b'secret'))
+            passwd = Secret(b'secret')
+            with passwd:
+                k2 = load(name, passwd)
+            self.assertTrue(passwd.zeroized)
+            self.assertEqual(k2.get_public_bytes(), k.get_public_bytes())
+
+            img = image.Image(header_size=32)
+            img.payload = bytes(32) + bytes(range(256))
+            img.sign(k2)
+            self.assertGreater(len(img.payload), 32 + 256)
+            k2.zeroize()
+            self.assertIsNone(k2.key)
+
+    def test_aes(self):
+        k = AES.generate(128)
+        raw = k.get_private_bytes()
+        k.zeroize()
+        self.assertTrue(raw.zeroized)
+        self.assertEqual(k.key_size(), 128)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,119 @@
+"""
+Deterministic key derivation from a seed.
+
+This is only intended for producing stable keys for test fixtures.  A
+key derived this way is only as secret as the seed, and the prime
+generation here hasn't had the scrutiny of a real crypto library.
+"""
+
+import hashlib
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.asymmetric import ec, rsa
+from cryptography.hazmat.primitives.hashes import SHA256
+from cryptography.hazmat.primitives.kdf.hkdf import HKDF
+
+# The order of the generator of each supported curve.
+CURVE_ORDERS = {
+    'secp224r1': 0xffffffffffffffffffffffffffff16a2e0b8f03e13dd29455c5c2a3d,
+    'secp256r1': 0xffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551,
+    'secp384r1': int('ffffffffffffffffffffffffffffffffffffffffffffffffc7634d81'
+                     'f4372ddf581a0db248b0a77aecec196accc52973', 16),
+    'secp521r1': int('01ff' + 'ffffffff' * 7 + 'fffffffa51868783bf2f966b7fcc0148'
+                     'f709a5d03bb5c9b8899c47aebb6fb71e91386409', 16),
+    'brainpoolP256r1': 0xa9fb57dba1eea9bc3e660a909d838d718c397aa3b561a6f7901e0e82974856a7,
+}
+
+class SeededStream(object):
+    """A stream of bytes determined by a seed and a label.  The label
+    keeps keys of different types derived from the same seed
+    unrelated."""
+
+    def __init__(self, seed, label):
+        self.key = HKDF(
+                algorithm=SHA256(),
+                length=32,
+                salt=b'imgtool insecure test key',
+                info=label.encode('utf-8'),
+                backend=default_backend()).derive(seed)
+        self.counter = 0
+
+    def read(self, size):
+        out = b''
+        while len(out) < size:
+            block = hashlib.sha256(self.key + self.counter.to_bytes(8, 'big'))
+            out += block.digest()
+            self.counter += 1
+        return out[:size]
+
+    def randint(self, bits):
+        """Return a number of at most the given number of bits."""
+        value = int.from_bytes(self.read((bits + 7) // 8), 'big')
+        return value >> (-bits % 8)
+
+def ec_private_key(seed, curve):
+    """Derive a private key on the given curve."""
+    order = CURVE_ORDERS[curve.name]
+    stream = SeededStream(seed, curve.name)
+    # The extra 64 bits make the bias of the reduction negligible.
+    value = stream.randint(order.bit_length() + 64) % (order - 1) + 1
+    return ec.derive_private_key(value, curve, default_backend())
+
+def raw_private_bytes(seed, label, size):
+    """Derive private key bytes, for keys that are just random bytes,
+    such as X25519."""
+    return SeededStream(seed, label).read(size)
+
+_SMALL_PRIMES = [p for p in range(3, 2000)
+                 if all(p % d for d in range(3, int(p ** 0.5) + 1, 2))]
+
+def _is_probable_prime(n, stream, rounds=40):
+    for p in _SMALL_PRIMES:
+        if n % p == 0:
+            return n == p
+    d = n - 1
+    s = 0
+    while d % 2 == 0:
+        d //= 2
+        s += 1
+    for _ in range(rounds):
+        a = stream.randint(n.bit_length()) % (n - 3) + 2
+        x = pow(a, d, n)
+        if x == 1 or x == n - 1:
+            continue
+        for _ in range(s - 1):
+            x = pow(x, 2, n)
+            if x == n - 1:
+                break
+        else:
+            return False
+    return True
+
+def _prime(stream, bits, exponent):
+    while True:
+        # Setting the top two bits makes the product of two such
+        # primes have exactly twice the bits.
+        candidate = stream.randint(bits) | (3 << (bits - 2)) | 1
+        if (candidate - 1) % exponent == 0:
+            continue
+        if _is_probable_prime(candidate, stream):
+            return candidate
+
+def rsa_private_key(seed, key_size, exponent):
+    """Derive an RSA private key of the given size."""
+    stream = SeededStream(seed, "rsa-{}".format(key_size))
+    while True:
+        p = _prime(stream, key_size // 2, exponent)
+        q = _prime(stream, key_size // 2, exponent)
+        if p != q:
+            break
+    if p < q:
+        p, q = q, p
+    d = pow(exponent, -1, (p - 1) * (q - 1))
+    numbers = rsa.RSAPrivateNumbers(
+            p=p, q=q, d=d,
+            dmp1=rsa.rsa_crt_dmp1(d, p),
+            dmq1=rsa.rsa_crt_dmq1(d, q),
+            iqmp=rsa.rsa_crt_iqmp(p, q),
+            public_numbers=rsa.RSAPublicNumbers(exponent, p * q))
+    return numbers.private_key(default_backend())
@@ -0,0 +1,87 @@
+"""
+Tests for keys derived from a seed
+"""
+
+import os
+import sys
+import tempfile
+import unittest
+
+from cryptography.hazmat.primitives.asymmetric import ec
+from cryptography.hazmat.primitives.asymmetric.padding import PSS, MGF1
+from cryptography.hazmat.primitives.hashes import SHA256
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '../..')))
+
+from imgtool.keys import RSA, ECDSA256P1, ECDSA384P1, ECDSA521P1, X25519
+
+SEED = b'This seed is only for testing'
+
+GENERATORS = [
+    ('rsa-2048', RSA.generate),
+    ('ecdsa-p256', ECDSA256P1.generate),
+    ('ecdsa-p384', ECDSA384P1.generate),
+    ('ecdsa-p521', ECDSA521P1.generate),
+    ('x25519', X25519.generate),
+]
+
+class SeededKeys(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def pem(self, gen, seed):
+        name = self.tname("key.pem")
+        gen(seed=seed).export_private(name)
+        with open(name, 'rb') as f:
+            return f.read()
+
+    def test_stable(self):
+        """The same seed gives byte for byte the same key file."""
+        seen = {}
+        for name, gen in GENERATORS:
+            first = self.pem(gen, SEED)
+            self.assertEqual(first, self.pem(gen, SEED), name)
+            self.assertNotEqual(first, self.pem(gen, SEED + b'!'), name)
+            seen[name] = first
+        self.assertEqual(len(set(seen.values())), len(GENERATORS))
+
+    def test_known_answer(self):
+        """Keys must stay the same between runs, and releases."""
+        k = ECDSA256P1.generate(seed=SEED)
+        self.assertEqual(k.key.private_numbers().private_value,
+                0x7ddfd8a5ba90557ed2196215cd0ed7b06231c2d8e78e03abe06a88fd57806500)
+
+    def test_unrelated(self):
+        """Keys of different types from one seed don't share material."""
+        p256 = ECDSA256P1.generate(seed=SEED).key.private_numbers().private_value
+        p384 = ECDSA384P1.generate(seed=SEED).key.private_numbers().private_value
+        self.assertNotEqual(p256, p384)
+        self.assertNotEqual(p256, p384 >> 128)
+        self.assertNotEqual(p256.to_bytes(32, 'big'),
+                X25519.generate(seed=SEED).key.private_bytes_raw())
+
+    def test_usable(self):
+        buf = b'This is the message'
+        k = RSA.generate(seed=SEED)
+        self.assertEqual(k.key_size(), 2048)
+        k.key.public_key().verify(
+                signature=k.sign(buf),
+                data=buf,
+                padding=PSS(mgf=MGF1(SHA256()), salt_length=32),
+                algorithm=SHA256())
+
+        k = ECDSA256P1.generate(seed=SEED)
+        k.key.public_key().verify(
+                signature=k.raw_sign(buf),
+                data=buf,
+                signature_algorithm=ec.ECDSA(SHA256()))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,106 @@
+"""
+The SSH wire format (RFC 4251), and SSH public key blobs, as used by
+ssh-agent and OpenSSH key files.
+"""
+
+import base64
+import hashlib
+import struct
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives.asymmetric import ec, ed25519
+
+from .general import KeyUsageError
+
+# The SSH names of the curves, with the curve and the hash the SSH
+# signatures over it use.
+SSH_CURVES = {
+        'nistp256': ec.SECP256R1,
+        'nistp384': ec.SECP384R1,
+}
+
+class SSHFormatError(KeyUsageError):
+    pass
+
+class Reader(object):
+    """Reads the fields of an SSH message."""
+
+    def __init__(self, data):
+        self.data = data
+        self.off = 0
+
+    def _take(self, n):
+        if self.off + n > len(self.data):
+            raise SSHFormatError("Truncated SSH data")
+        field = self.data[self.off:self.off + n]
+        self.off += n
+        return field
+
+    def byte(self):
+        return self._take(1)[0]
+
+    def uint32(self):
+        return struct.unpack('>I', self._take(4))[0]
+
+    def string(self):
+        return bytes(self._take(self.uint32()))
+
+    def text(self):
+        try:
+            return self.string().decode('utf-8')
+        except UnicodeDecodeError:
+            raise SSHFormatError("Invalid text in SSH data")
+
+    def mpint(self):
+        return int.from_bytes(self.string(), 'big', signed=True)
+
+    def rest(self):
+        return self._take(len(self.data) - self.off)
+
+    def done(self):
+        return self.off == len(self.data)
+
+def pack_uint32(n):
+    return struct.pack('>I', n)
+
+def pack_string(data):
+    if isinstance(data, str):
+        data = data.encode('utf-8')
+    return pack_uint32(len(data)) + data
+
+def pack_mpint(n):
+    if n == 0:
+        return pack_string(b'')
+    return pack_string(n.to_bytes(n.bit_length() // 8 + 1, 'big', signed=True))
+
+def public_key_from_blob(blob):
+    """The cryptography public key of an SSH public key blob.  Only the
+    types imgtool can sign with are supported."""
+    r = Reader(blob)
+    kind = r.text()
+    if kind.startswith('ecdsa-sha2-'):
+        name = r.text()
+        if name not in SSH_CURVES or kind != 'ecdsa-sha2-' + name:
+            raise SSHFormatError("Unsupported SSH ECDSA curve: {}".format(name))
+        try:
+            return ec.EllipticCurvePublicKey.from_encoded_point(
+                    SSH_CURVES[name](), r.string())
+        except ValueError as e:
+            raise SSHFormatError("Invalid SSH ECDSA key: {}".format(e))
+    if kind == 'ssh-ed25519':
+        raw = r.string()
+        if len(raw) != 32:
+            raise SSHFormatError("Invalid SSH Ed25519 key")
+        return ed25519.Ed25519PublicKey.from_public_bytes(raw)
+    raise SSHFormatError("SSH keys of type {} are not supported, only ECDSA "
+                         "and Ed25519".format(kind))
+
+def key_type(blob):
+    """The SSH type name of a public key blob, such as "ssh-ed25519"."""
+    return Reader(blob).text()
+
+def fingerprint(blob):
+    """The fingerprint OpenSSH shows for a key, "SHA256:" and the
+    unpadded base64 of the hash of the blob."""
+    digest = hashlib.sha256(blob).digest()
+    return 'SHA256:' + base64.b64encode(digest).decode('ascii').rstrip('=')
@@ -0,0 +1,99 @@
+"""
+X25519 key management
+"""
+
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import x25519
+
+from .general import KeyClass, KeyUsageError, export_private_key
+from .keyfile import write_public
+from . import jwk, seeded
+
+class X25519UsageError(KeyUsageError):
+    pass
+
+class X25519Public(KeyClass):
+    def __init__(self, key):
+        self.key = key
+
+    def shortname(self):
+        return "x25519"
+
+    def _unsupported(self, name):
+        raise X25519UsageError("Operation {} requires private key".format(name))
+
+    def _get_public(self):
+        return self.key
+
+    def get_public_bytes(self):
+        return self._get_public().public_bytes(
+                encoding=serialization.Encoding.DER,
+                format=serialization.PublicFormat.SubjectPublicKeyInfo)
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        self._unsupported('export_private')
+
+    def _raw_public_bytes(self):
+        return self._get_public().public_bytes(
+                encoding=serialization.Encoding.Raw,
+                format=serialization.PublicFormat.Raw)
+
+    def export_public(self, path, overwrite=True):
+        """Write the public key to the given file."""
+        write_public(path, self.public_pem(), overwrite=overwrite)
+
+    def _jwk_members(self):
+        # RFC 8037 puts X25519 keys under the "OKP" key type.
+        raw = self._get_public().public_bytes(
+                encoding=serialization.Encoding.Raw,
+                format=serialization.PublicFormat.Raw)
+        return {'kty': 'OKP', 'crv': 'X25519', 'x': jwk.b64url(raw)}
+
+    def sig_tlv(self):
+        # X25519 is a key agreement algorithm, used for image
+        # encryption, it can't produce signatures.
+        raise X25519UsageError("X25519 keys can't be used for signing")
+
+    def sign(self, payload, sha='256', deterministic=False):
+        self.sig_tlv()
+
+    def sign_digest(self, digest, sha='256', deterministic=False):
+        self.sig_tlv()
+
+class X25519(X25519Public):
+    """
+    Wrapper around an X25519 private key.
+    """
+
+    def __init__(self, key):
+        """key should be an instance of X25519PrivateKey"""
+        self.key = key
+
+    @staticmethod
+    def generate(seed=None):
+        """Generate a new key.  If a seed is given, the key is derived
+        from it, which is only suitable for testing."""
+        if seed is not None:
+            raw = seeded.raw_private_bytes(seed, "x25519", 32)
+            return X25519(x25519.X25519PrivateKey.from_private_bytes(raw))
+        pk = x25519.X25519PrivateKey.generate()
+        return X25519(pk)
+
+    def _get_public(self):
+        return self.key.public_key()
+
+    def export_private(self, path, passwd=None, format='pkcs8', overwrite=True,
+                       encoding='pem', metadata=None):
+        """Write the private key to the given file, protecting it with the optional password."""
+        if format != 'pkcs8':
+            raise X25519UsageError("X25519 keys can only be written as PKCS#8")
+        export_private_key(self.key, path, passwd=passwd, format=format,
+                           overwrite=overwrite, encoding=encoding,
+                           metadata=metadata)
+
+    def exchange(self, peer):
+        """Perform an ECDH exchange with the given peer public key,
+        returning the shared secret."""
+        return self.key.exchange(peer)
@@ -0,0 +1,120 @@
+"""
+Tests for keystores
+"""
+
+import datetime
+import os.path
+import sys
+import tempfile
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import keys
+from imgtool.keystore import Keystore, KeystoreError, is_keystore, split_key_ref
+
+# One key of every type that can go in a keystore.
+ALL_KEYS = [
+        ('rsa-2048', lambda: keys.RSA.generate()),
+        ('rsa-3072', lambda: keys.RSA.generate(key_size=3072)),
+        ('ecdsa-p224', lambda: keys.ECDSA224P1.generate()),
+        ('ecdsa-p256', lambda: keys.ECDSA256P1.generate()),
+        ('ecdsa-p384', lambda: keys.ECDSA384P1.generate()),
+        ('ecdsa-p521', lambda: keys.ECDSA521P1.generate()),
+        ('brainpool-p256r1', lambda: keys.ECDSABP256R1.generate()),
+        ('ed25519', lambda: keys.Ed25519.generate()),
+        ('x25519', lambda: keys.X25519.generate()),
+        ('aes-128', lambda: keys.AES.generate(128)),
+        ('aes-256', lambda: keys.AES.generate(256)),
+]
+
+class Keystores(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def test_all_types(self):
+        path = self.tname('store.json')
+        ks = Keystore.create(path, b'secret')
+        originals = {}
+        for kt, gen in ALL_KEYS:
+            originals[kt] = gen()
+            ks.add(kt, originals[kt])
+        ks.save()
+        self.assertTrue(is_keystore(path))
+
+        ks = Keystore.load(path, b'secret')
+        self.assertEqual(ks.names(), [kt for kt, _ in ALL_KEYS])
+        for kt, _ in ALL_KEYS:
+            self.assertEqual(ks.info(kt)[0], kt)
+            k = ks.get(kt)
+            self.assertEqual(type(k), type(originals[kt]))
+            self.assertEqual(keys.private_bytes(k),
+                             keys.private_bytes(originals[kt]))
+
+    def test_entry(self):
+        ks = Keystore.create(self.tname('store.json'), b'secret')
+        now = datetime.datetime(2019, 3, 1, 12, 0, 0,
+                                tzinfo=datetime.timezone.utc)
+        ks.add('prod-root', keys.ECDSA256P1.generate(), now=now)
+        self.assertEqual(ks.info('prod-root'),
+                         ('ecdsa-p256', '2019-03-01T12:00:00Z'))
+
+    def test_collision(self):
+        ks = Keystore.create(self.tname('store.json'), b'secret')
+        first = keys.ECDSA256P1.generate()
+        ks.add('root', first)
+        self.assertRaises(KeystoreError, ks.add, 'root',
+                          keys.ECDSA256P1.generate())
+        self.assertEqual(keys.private_bytes(ks.get('root')),
+                         keys.private_bytes(first))
+        self.assertRaises(KeystoreError, ks.add, 'a:b',
+                          keys.ECDSA256P1.generate())
+
+    def test_public(self):
+        ks = Keystore.create(self.tname('store.json'), b'secret')
+        pub = keys.ECDSA256P1Public(keys.ECDSA256P1.generate().key.public_key())
+        self.assertRaises(KeystoreError, ks.add, 'pub', pub)
+
+    def test_passphrase(self):
+        path = self.tname('store.json')
+        ks = Keystore.create(path, b'secret')
+        ks.add('root', keys.ECDSA256P1.generate())
+        ks.save()
+        self.assertRaises(KeystoreError, Keystore.load, path, b'wrong')
+        with open(path, 'rb') as f:
+            self.assertNotIn(b'PRIVATE KEY', f.read())
+
+    def test_remove(self):
+        path = self.tname('store.json')
+        ks = Keystore.create(path, b'secret')
+        ks.add('root', keys.ECDSA256P1.generate())
+        ks.add('dev', keys.ECDSA256P1.generate())
+        ks.remove('dev')
+        self.assertRaises(KeystoreError, ks.remove, 'dev')
+        ks.save()
+        self.assertEqual(Keystore.load(path, b'secret').names(), ['root'])
+        self.assertRaises(KeystoreError, ks.get, 'dev')
+
+    def test_split(self):
+        path = self.tname('store.json')
+        ks = Keystore.create(path, b'secret')
+        ks.save()
+        self.assertEqual(split_key_ref(path + ':root'), (path, 'root'))
+        self.assertEqual(split_key_ref(path), (None, path))
+
+        # A key file whose name has a colon isn't a keystore reference.
+        keyfile = self.tname('key:1.pem')
+        keys.ECDSA256P1.generate().export_private(keyfile)
+        self.assertEqual(split_key_ref(keyfile), (None, keyfile))
+        other = self.tname('missing') + ':root'
+        self.assertEqual(split_key_ref(other), (None, other))
+
+if __name__ == '__main__':
+    unittest.main()
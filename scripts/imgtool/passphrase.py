@@ -0,0 +1,122 @@
+# Copyright 2017 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+Sources of passphrases protecting private keys.
+"""
+
+import getpass
+import os
+import sys
+
+from .keys import secret
+from .keys.secret import Secret
+
+# The environment variable giving the passphrase of encrypted keys and
+# keystores, for scripts that can't use a file.
+ENV_VAR = 'IMGTOOL_KEY_PASSPHRASE'
+
+SOURCES_HINT = "use --passphrase-file or {}".format(ENV_VAR)
+
+class PassphraseError(Exception):
+    """Raised when a passphrase is needed but can't be obtained."""
+    pass
+
+def encode(passwd):
+    # Password must be bytes, always use UTF-8 for consistent
+    # encoding.  The str the passphrase was typed into can't be wiped,
+    # only this copy.
+    return Secret(passwd.encode('utf-8'))
+
+def read_file(path):
+    """Read a passphrase from the first line of the given file, as a
+    Secret, which the caller should zeroize once done with it."""
+    passwd = secret.read(path)
+    end = len(passwd)
+    for eol in b'\r\n':
+        pos = passwd.find(bytes([eol]))
+        if 0 <= pos < end:
+            end = pos
+    # Wipe the rest of the file before dropping it.
+    passwd[end:] = bytes(len(passwd) - end)
+    del passwd[end:]
+    if not passwd:
+        raise PassphraseError("Passphrase file {} is empty".format(path))
+    return passwd
+
+def prompt(confirm=False, stdin=None, hint=SOURCES_HINT):
+    """Prompt for a passphrase on the terminal.  With confirm set, the
+    passphrase is asked for twice, until both entries match.
+
+    Prompting is only done when stdin is a terminal, otherwise this
+    fails, rather than waiting for input that will never come."""
+    stdin = sys.stdin if stdin is None else stdin
+    if not stdin.isatty():
+        raise PassphraseError(
+                "A passphrase is required, but stdin is not a terminal, " +
+                hint)
+    while True:
+        passwd = getpass.getpass("Enter key passphrase: ")
+        if not confirm:
+            break
+        passwd2 = getpass.getpass("Reenter passphrase: ")
+        if passwd == passwd2:
+            break
+        print("Passwords do not match, try again", file=sys.stderr)
+    return encode(passwd)
+
+class Source(object):
+    """Where a passphrase comes from.  The file, if one is given, comes
+    first, then the IMGTOOL_KEY_PASSPHRASE environment variable, unless
+    use_env is False, and last, a prompt on the terminal.  Without
+    interactive, there is no prompt, and a passphrase that isn't found
+    elsewhere is an error.  option is the option giving the file, for
+    the error messages."""
+
+    def __init__(self, path=None, interactive=True, use_env=True,
+                 option='--passphrase-file', environ=None, stdin=None):
+        self.path = path
+        self.interactive = interactive
+        self.use_env = use_env
+        self.option = option
+        self.environ = os.environ if environ is None else environ
+        self.stdin = stdin
+
+    def _hint(self):
+        if self.use_env:
+            return "use {} or {}".format(self.option, ENV_VAR)
+        return "use {}".format(self.option)
+
+    def given(self):
+        """Returns True if the passphrase can be had without a prompt."""
+        return (self.path is not None or
+                (self.use_env and bool(self.environ.get(ENV_VAR))))
+
+    def get(self, confirm=False, prompt_ok=True):
+        """The passphrase, as a Secret, which the caller should zeroize
+        once done with it.  With prompt_ok False, as when stdin holds
+        something else, there is no prompt either."""
+        if self.path is not None:
+            return read_file(self.path)
+        if self.use_env:
+            value = self.environ.get(ENV_VAR)
+            if value:
+                return encode(value)
+        if not self.interactive:
+            raise PassphraseError(
+                    "A passphrase is required, and --non-interactive " +
+                    "is given, " + self._hint())
+        if not prompt_ok:
+            raise PassphraseError("A passphrase is required, " + self._hint())
+        return prompt(confirm, self.stdin, hint=self._hint())
@@ -0,0 +1,117 @@
+"""
+Tests for passphrase handling
+"""
+
+import io
+import os.path
+import sys
+import tempfile
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import keys
+from imgtool.keys import Secret
+from imgtool.passphrase import (ENV_VAR, PassphraseError, Source, prompt,
+                                read_file)
+
+class NotATerminal(io.StringIO):
+    def isatty(self):
+        return False
+
+class Passphrase(unittest.TestCase):
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
+
+    def write(self, base, content):
+        name = self.tname(base)
+        with open(name, 'wb') as f:
+            f.write(content)
+        return name
+
+    def test_read_file(self):
+        self.assertEqual(read_file(self.write("p1", b'secret\n')), b'secret')
+        self.assertEqual(read_file(self.write("p2", b'secret\r\n')), b'secret')
+        self.assertEqual(read_file(self.write("p3", b'secret')), b'secret')
+        # Only the first line is used.
+        self.assertEqual(read_file(self.write("p4", b'one\ntwo\n')), b'one')
+        self.assertRaises(PassphraseError, read_file, self.write("p5", b''))
+        self.assertRaises(PassphraseError, read_file, self.write("p6", b'\n'))
+
+    def test_secret(self):
+        passwd = read_file(self.write("p7", b'secret\nmore\n'))
+        self.assertIsInstance(passwd, Secret)
+        passwd.zeroize()
+        self.assertEqual(passwd, bytes(6))
+
+    def test_no_terminal(self):
+        self.assertRaises(PassphraseError, prompt, stdin=NotATerminal())
+
+    def test_source_order(self):
+        """The file comes first, then the environment, then the prompt."""
+        path = self.write("p8", b'from file\n')
+        env = {ENV_VAR: 'from env'}
+        self.assertEqual(Source(path, environ=env).get(), b'from file')
+        self.assertEqual(Source(environ=env).get(), b'from env')
+        # An empty variable is as good as none.
+        with self.assertRaises(PassphraseError) as cm:
+            Source(environ={ENV_VAR: ''}, stdin=NotATerminal()).get()
+        self.assertIn('not a terminal', str(cm.exception))
+        self.assertIn(ENV_VAR, str(cm.exception))
+
+    def test_source_given(self):
+        self.assertTrue(Source(self.write("p9", b'x\n'), environ={}).given())
+        self.assertTrue(Source(environ={ENV_VAR: 'x'}).given())
+        self.assertFalse(Source(environ={}).given())
+        self.assertFalse(Source(environ={ENV_VAR: 'x'}, use_env=False).given())
+
+    def test_source_no_env(self):
+        """Passphrases for new keys don't come from the environment."""
+        source = Source(environ={ENV_VAR: 'from env'}, use_env=False,
+                        option='--out-passphrase-file', stdin=NotATerminal())
+        with self.assertRaises(PassphraseError) as cm:
+            source.get(confirm=True)
+        self.assertIn('--out-passphrase-file', str(cm.exception))
+        self.assertNotIn(ENV_VAR, str(cm.exception))
+
+    def test_non_interactive(self):
+        class Terminal(io.StringIO):
+            def isatty(self):
+                return True
+        source = Source(interactive=False, environ={}, stdin=Terminal())
+        with self.assertRaises(PassphraseError) as cm:
+            source.get()
+        self.assertIn('--non-interactive', str(cm.exception))
+        self.assertEqual(Source(interactive=False,
+                                environ={ENV_VAR: 'x'}).get(), b'x')
+        with self.assertRaises(PassphraseError):
+            Source(environ={}, stdin=Terminal()).get(prompt_ok=False)
+
+    def test_all_key_types(self):
+        """Every key type can be protected, and read back, using a
+        passphrase file."""
+        passwd = read_file(self.write("passphrase", b'correct horse\n'))
+        for gen in [keys.RSA.generate, keys.ECDSA256P1.generate,
+                    keys.ECDSA384P1.generate, keys.ECDSA521P1.generate,
+                    keys.X25519.generate]:
+            k = gen()
+            name = self.tname("key.pem")
+            k.export_private(name, passwd)
+            with open(name, 'rb') as f:
+                self.assertIn(b'ENCRYPTED', f.read())
+
+            self.assertIsNone(keys.load(name))
+            self.assertIsNone(keys.load(name, b'wrong horse'))
+            k2 = keys.load(name, passwd)
+            self.assertIs(type(k2), type(k))
+            self.assertEqual(k2.get_public_bytes(), k.get_public_bytes())
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,111 @@
+# Copyright 2019 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+Motorola S-records, the text format of an image and its addresses that
+some production programmers take in place of Intel HEX.
+"""
+
+# The bytes of address each type of record has.
+ADDRESS_SIZES = {0: 2, 1: 2, 2: 3, 3: 4, 5: 2, 6: 3, 7: 4, 8: 3, 9: 2}
+
+# The data record for addresses of each size, S1, S2 or S3, each ended
+# by its termination record, S9, S8 or S7.
+DATA_RECORDS = {2: 1, 3: 2, 4: 3}
+TERMINATIONS = {1: 9, 2: 8, 3: 7}
+
+# The count byte covers the address, the data and the checksum.
+MAX_LENGTH = 0xff
+
+class SRecError(Exception):
+    pass
+
+def record(kind, addr, data=b''):
+    """One S-record, of this type, address and data, with its checksum,
+    the ones' complement of the low byte of the sum of the others."""
+    size = ADDRESS_SIZES[kind]
+    if size + len(data) + 1 > MAX_LENGTH:
+        raise SRecError("An S{} record holds at most {} bytes, not {}".format(
+                kind, MAX_LENGTH - size - 1, len(data)))
+    raw = bytes([size + len(data) + 1]) + addr.to_bytes(size, 'big') + data
+    return 'S{}{}{:02X}\n'.format(kind, raw.hex().upper(), ~sum(raw) & 0xff)
+
+def address_size(end):
+    """The bytes of address that the records of data ending at end need:
+    S1 records for the first 64 KiB, S2 for the first 16 MiB, and S3
+    for the rest."""
+    if end <= 1 << 16:
+        return 2
+    if end <= 1 << 24:
+        return 3
+    return 4
+
+def write(f, addr, data, header=None, length=16):
+    """Write data, starting at addr, to the text file f as S-records: an
+    S0 record of the bytes header, when given, the data records of
+    length bytes each, of the smallest address size the end of the data
+    fits, the S5 or S6 record of their count, and the termination
+    record."""
+    if addr < 0 or addr + len(data) > 1 << 32:
+        raise SRecError("0x{:x} bytes at 0x{:x} don't fit the 32 bit "
+                        "addresses of S-records".format(len(data), addr))
+    kind = DATA_RECORDS[address_size(addr + len(data))]
+    if header is not None:
+        f.write(record(0, 0, header))
+    count = 0
+    for off in range(0, len(data), length):
+        f.write(record(kind, addr + off, bytes(data[off:off + length])))
+        count += 1
+    f.write(record(5 if count < 1 << 16 else 6, count))
+    f.write(record(TERMINATIONS[kind], 0))
+
+def read(f):
+    """The (address, data) of each data record of the S-records in the
+    text file f, in the order they come, up to the termination record.
+    The length and checksum of each record are checked, and the count
+    of the data records, when an S5 or S6 record gives it."""
+    regions = []
+    count = None
+    for n, line in enumerate(f, 1):
+        line = line.strip()
+        if not line:
+            continue
+        if line[:1] not in ('S', 's') or line[1:2] not in '012356789' \
+                or len(line) < 4:
+            raise SRecError("line {}: not an S-record".format(n))
+        kind = int(line[1])
+        try:
+            raw = bytes.fromhex(line[2:])
+        except ValueError:
+            raise SRecError("line {}: not an S-record".format(n))
+        if raw[0] != len(raw) - 1 or len(raw) < ADDRESS_SIZES[kind] + 2:
+            raise SRecError("line {}: the record has {} bytes, not the {} "
+                            "its count gives".format(n, len(raw) - 1,
+                                                     raw[0]))
+        checksum = ~sum(raw[:-1]) & 0xff
+        if raw[-1] != checksum:
+            raise SRecError("line {}: the checksum is 0x{:02x}, not "
+                            "0x{:02x}".format(n, raw[-1], checksum))
+        size = ADDRESS_SIZES[kind]
+        addr = int.from_bytes(raw[1:1 + size], 'big')
+        if kind in DATA_RECORDS.values():
+            regions.append((addr, raw[1 + size:-1]))
+        elif kind in (5, 6):
+            count = addr
+        elif kind in TERMINATIONS.values():
+            break
+    if count is not None and count != len(regions):
+        raise SRecError("There are {} data records, not the {} the count "
+                        "record gives".format(len(regions), count))
+    return regions
@@ -0,0 +1,114 @@
+"""
+Tests for S-records
+"""
+
+import io
+import os.path
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import srec
+
+# The example of the S-record article of Wikipedia, an S0 header, three
+# S1 data records of a 70 byte program, its S5 count and the S9
+# termination record.
+EXAMPLE = '''S00F000068656C6C6F202020202000003C
+S11F00007C0802A6900100049421FFF07C6C1B787C8C23783C6000003863000026
+S11F001C4BFFFFE5398000007D83637880010014382100107C0803A64E800020E9
+S111003848656C6C6F20776F726C642E0A0042
+S5030003F9
+S9030000FC
+'''
+
+EXAMPLE_DATA = bytes.fromhex(
+        '7C0802A6900100049421FFF07C6C1B787C8C23783C60000038630000'
+        '4BFFFFE5398000007D83637880010014382100107C0803A64E800020'
+        '48656C6C6F20776F726C642E0A00')
+
+def write(addr, data, **kwargs):
+    f = io.StringIO()
+    srec.write(f, addr, data, **kwargs)
+    return f.getvalue()
+
+class Records(unittest.TestCase):
+
+    def test_example(self):
+        self.assertEqual(srec.read(io.StringIO(EXAMPLE)),
+                         [(0x00, EXAMPLE_DATA[:28]),
+                          (0x1c, EXAMPLE_DATA[28:56]),
+                          (0x38, EXAMPLE_DATA[56:])])
+        self.assertEqual(write(0, EXAMPLE_DATA, header=b'hello     \0\0',
+                               length=28),
+                         EXAMPLE)
+
+    def test_address_sizes(self):
+        """The data records are S1, S2 or S3, as the end of the data
+        needs, with the S9, S8 or S7 record that goes with them."""
+        for addr, want in [
+                (0xfff0, ['S113FFF0000102030405060708090A0B0C0D0E0F85',
+                          'S5030001FB', 'S9030000FC']),
+                (0xfff8, ['S21400FFF8000102030405060708090A0B0C0D0E0F7C',
+                          'S5030001FB', 'S804000000FB']),
+                (0xfffff0, ['S214FFFFF0000102030405060708090A0B0C0D0E0F85',
+                            'S5030001FB', 'S804000000FB']),
+                (0x08000000, ['S3150800000000'
+                              '0102030405060708090A0B0C0D0E0F6A',
+                              'S5030001FB', 'S70500000000FA'])]:
+            self.assertEqual(write(addr, bytes(range(16))).splitlines(),
+                             want, hex(addr))
+
+    def test_round_trip(self):
+        for addr in [0, 0x1234, 0xfffe, 0x10000, 0x08000000, 0xfffff000]:
+            for size in [1, 15, 16, 17, 255, 256, 4096]:
+                data = bytes(i * 7 & 0xff for i in range(size))
+                text = write(addr, data)
+                regions = srec.read(io.StringIO(text))
+                self.assertEqual(b''.join(d for a, d in regions), data)
+                self.assertEqual([a for a, d in regions],
+                                 list(range(addr, addr + size, 16)))
+                self.assertEqual(len(text.splitlines()),
+                                 (size + 15) // 16 + 2)
+
+    def test_header(self):
+        text = write(0x100, b'\x01', header=b'mcuboot')
+        self.assertEqual(text.splitlines()[0], 'S00A00006D6375626F6F74FC')
+        self.assertEqual(srec.read(io.StringIO(text)), [(0x100, b'\x01')])
+        with self.assertRaises(srec.SRecError):
+            write(0, b'', header=b'x' * 253)
+
+    def test_range(self):
+        write(0xfffffff0, bytes(16))
+        for addr, size in [(0xfffffff1, 16), (-1, 1)]:
+            with self.assertRaises(srec.SRecError):
+                write(addr, bytes(size))
+
+    def test_errors(self):
+        lines = EXAMPLE.splitlines()
+        for n, line, message in [
+                (2, lines[1][:-2] + '27', 'the checksum is 0x27, not 0x26'),
+                (2, lines[1][:10] + 'FF' + lines[1][12:],
+                 'the checksum is 0x26, not'),
+                (3, lines[2][:-4] + lines[2][-2:],
+                 'the record has 30 bytes, not the 31'),
+                (4, 'S4' + lines[3][2:], 'not an S-record'),
+                (4, ':' + lines[3][1:], 'not an S-record'),
+                (4, lines[3] + 'X', 'not an S-record'),
+                (5, 'S5030002FA', 'There are 3 data records, not the 2')]:
+            broken = lines[:n - 1] + [line] + lines[n:]
+            with self.assertRaises(srec.SRecError) as cm:
+                srec.read(io.StringIO('\n'.join(broken)))
+            self.assertIn(message, str(cm.exception))
+            if not message.startswith('There'):
+                self.assertIn('line {}:'.format(n), str(cm.exception))
+
+    def test_termination(self):
+        """Records after the termination record are left alone, and the
+        count is optional."""
+        lines = EXAMPLE.splitlines()
+        text = '\n'.join(lines[1:4] + lines[5:] + ['junk'])
+        self.assertEqual(len(srec.read(io.StringIO(text))), 3)
+
+if __name__ == '__main__':
+    unittest.main()
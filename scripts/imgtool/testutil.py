@@ -0,0 +1,25 @@
+"""
+Fixtures shared by the tests of imgtool and of its modules
+"""
+
+import os.path
+import tempfile
+import unittest
+
+# Key fixtures.  Git checks these out readable by everyone, so commands
+# that use the keys need --insecure-key-perms.
+TESTDATA = os.path.join(os.path.dirname(os.path.abspath(__file__)),
+                        'keys', 'testdata')
+
+class TempDirTest(unittest.TestCase):
+    """A test case that writes its files to a directory of its own,
+    removed once each test is done."""
+
+    def setUp(self):
+        self.test_dir = tempfile.TemporaryDirectory()
+
+    def tname(self, base):
+        return os.path.join(self.test_dir.name, base)
+
+    def tearDown(self):
+        self.test_dir.cleanup()
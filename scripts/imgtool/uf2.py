@@ -0,0 +1,86 @@
+# Copyright 2019 Linaro Limited
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""
+UF2, the format of the files that bootloaders presenting a USB mass
+storage device flash when they are copied to it.
+"""
+
+import struct
+
+MAGIC_START0 = 0x0A324655
+MAGIC_START1 = 0x9E5D5157
+MAGIC_END = 0x0AB16F30
+
+# The block is written whole, its data padded to 476 bytes, of which
+# the first 256 are used, as the bootloaders expect.
+BLOCK_SIZE = 512
+DATA_SIZE = 476
+PAYLOAD_SIZE = 256
+
+# The last field of the header is the family ID, rather than the size
+# of the file, with this flag set.
+FLAG_FAMILY_ID = 0x00002000
+
+HEADER_FORMAT = '<IIIIIIII'
+
+class UF2Error(Exception):
+    pass
+
+def blocks(addr, data, family_id=None, skip=None):
+    """The UF2 blocks of data, starting at addr, 256 bytes of it to each
+    block.  The blocks carry family_id, when it is given, and those of
+    nothing but the bytes from skip[0] to skip[1], offsets into data,
+    are left out, the others numbered without them."""
+    if addr < 0 or addr + len(data) > 1 << 32:
+        raise UF2Error("0x{:x} bytes at 0x{:x} don't fit the 32 bit "
+                       "addresses of UF2".format(len(data), addr))
+    offsets = [off for off in range(0, len(data), PAYLOAD_SIZE)
+               if skip is None or not (
+                   skip[0] <= off and
+                   min(off + PAYLOAD_SIZE, len(data)) <= skip[1])]
+    flags = 0 if family_id is None else FLAG_FAMILY_ID
+    for n, off in enumerate(offsets):
+        chunk = bytes(data[off:off + PAYLOAD_SIZE])
+        header = struct.pack(HEADER_FORMAT, MAGIC_START0, MAGIC_START1,
+                             flags, addr + off, len(chunk), n, len(offsets),
+                             family_id or 0)
+        yield (header + chunk.ljust(DATA_SIZE, b'\0') +
+               struct.pack('<I', MAGIC_END))
+
+def write(f, addr, data, family_id=None, skip=None):
+    """Write the UF2 blocks of data, as blocks() gives them, to the binary
+    file f."""
+    for block in blocks(addr, data, family_id, skip):
+        f.write(block)
+
+def read(data):
+    """The (address, data) of each block of data, a UF2 file, in the
+    order they come, checking the magic numbers and the size of each."""
+    if len(data) % BLOCK_SIZE:
+        raise UF2Error("0x{:x} bytes, not a whole number of {} byte "
+                       "blocks".format(len(data), BLOCK_SIZE))
+    regions = []
+    for off in range(0, len(data), BLOCK_SIZE):
+        block = data[off:off + BLOCK_SIZE]
+        fields = struct.unpack(HEADER_FORMAT, block[:32])
+        if fields[:2] != (MAGIC_START0, MAGIC_START1) or \
+                struct.unpack('<I', block[-4:])[0] != MAGIC_END:
+            raise UF2Error("block {} has bad magic".format(off // BLOCK_SIZE))
+        addr, size = fields[3:5]
+        if size > DATA_SIZE:
+            raise UF2Error("block {} holds {} bytes, more than {}".format(
+                    off // BLOCK_SIZE, size, DATA_SIZE))
+        regions.append((addr, bytes(block[32:32 + size])))
+    return regions
@@ -0,0 +1,103 @@
+"""
+Tests for UF2 output
+"""
+
+import io
+import os.path
+import struct
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool import uf2
+
+def parse(data):
+    """The header fields and data of each block of a UF2 file, checking
+    the magic numbers and the size of each."""
+    blocks = []
+    assert len(data) % 512 == 0
+    for off in range(0, len(data), 512):
+        block = data[off:off + 512]
+        fields = struct.unpack('<IIIIIIII', block[:32])
+        assert fields[:2] == (uf2.MAGIC_START0, uf2.MAGIC_START1)
+        assert struct.unpack('<I', block[508:]) == (uf2.MAGIC_END,)
+        flags, addr, size, n, count, family = fields[2:]
+        blocks.append((flags, addr, n, count, family,
+                       block[32:32 + size], block[32 + size:508]))
+    return blocks
+
+def write(*args, **kwargs):
+    f = io.BytesIO()
+    uf2.write(f, *args, **kwargs)
+    return f.getvalue()
+
+class Blocks(unittest.TestCase):
+
+    def test_blocks(self):
+        data = bytes(i & 0xff for i in range(600))
+        blocks = parse(write(0x10000, data))
+        self.assertEqual([b[:5] for b in blocks],
+                         [(0, 0x10000, 0, 3, 0),
+                          (0, 0x10100, 1, 3, 0),
+                          (0, 0x10200, 2, 3, 0)])
+        self.assertEqual(b''.join(b[5] for b in blocks), data)
+        self.assertEqual([len(b[5]) for b in blocks], [256, 256, 88])
+        # The rest of the data of each block is zeros.
+        for b in blocks:
+            self.assertEqual(b[6], bytes(476 - len(b[5])))
+
+    def test_family_id(self):
+        blocks = parse(write(0x2000, bytes(300), family_id=0xe48bff56))
+        self.assertEqual({(b[0], b[4]) for b in blocks},
+                         {(0x2000, 0xe48bff56)})
+
+    def test_golden(self):
+        """A block byte for byte, as uf2conv writes it."""
+        block = write(0x08000000, b'\x01\x02\x03\x04',
+                      family_id=0x57755a57)
+        self.assertEqual(block[:32], bytes.fromhex(
+                '5546320a' '57515d9e' '00200000' '00000008'
+                '04000000' '00000000' '01000000' '575a7557'))
+        self.assertEqual(block[32:36], b'\x01\x02\x03\x04')
+        self.assertEqual(block[36:508], bytes(472))
+        self.assertEqual(block[508:], bytes.fromhex('306fb10a'))
+
+    def test_skip(self):
+        """Blocks of nothing but the skipped range are left out, and the
+        rest numbered without them."""
+        data = bytes(range(256)) * 8
+        blocks = parse(write(0, data, skip=(0x100, 0x480)))
+        self.assertEqual([(b[1], b[2], b[3]) for b in blocks],
+                         [(0x000, 0, 5), (0x400, 1, 5), (0x500, 2, 5),
+                          (0x600, 3, 5), (0x700, 4, 5)])
+        # Starting part way into the first block, the range takes none.
+        self.assertEqual(len(parse(write(0, data, skip=(0x101, 0x800)))), 2)
+        # A short last block is skipped when the range covers it.
+        self.assertEqual(len(parse(write(0, data[:0x280],
+                                         skip=(0x100, 0x280)))), 1)
+
+    def test_read(self):
+        """The blocks read back as they were written, their padding and
+        the data of skipped blocks left out."""
+        data = bytes(range(256)) * 8
+        self.assertEqual(uf2.read(write(0x1000, data[:600])),
+                         [(0x1000, data[:256]), (0x1100, data[256:512]),
+                          (0x1200, data[512:600])])
+        self.assertEqual([addr for addr, _ in uf2.read(
+                              write(0, data, skip=(0x100, 0x480)))],
+                         [0x000, 0x400, 0x500, 0x600, 0x700])
+        block = write(0, bytes(16))
+        for bad in [block[:-1], b'\0' + block[1:], block[:-1] + b'\0',
+                    block[:16] + struct.pack('<I', 477) + block[20:]]:
+            with self.assertRaises(uf2.UF2Error):
+                uf2.read(bad)
+
+    def test_range(self):
+        write(0xffffff00, bytes(256))
+        for addr, size in [(0xffffff01, 256), (-1, 1)]:
+            with self.assertRaises(uf2.UF2Error):
+                write(addr, bytes(size))
+
+if __name__ == '__main__':
+    unittest.main()
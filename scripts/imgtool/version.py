@@ -26,7 +26,11 @@ SemiSemVersion = namedtuple('SemiSemVersion', ['major', 'minor', 'revision',
                                                'build'])
 
 version_re = re.compile(
-    r"""^([1-9]\d*|0)(\.([1-9]\d*|0)(\.([1-9]\d*|0)(\+([1-9]\d*|0))?)?)?$""")
+    r"""^([1-9]\d*|0)(\.([1-9]\d*|0)(\.([1-9]\d*|0)(\+([1-9]\d*|0))?)?)?\Z""")
+
+# The largest value of each part the image header has room for: 8 bits
+# for major and minor, 16 for the revision, and 32 for the build.
+VERSION_LIMITS = SemiSemVersion(0xff, 0xff, 0xffff, 0xffffffff)
 
 
 def decode_version(text):
@@ -39,6 +43,13 @@ def decode_version(text):
                 int(m.group(3)) if m.group(3) else 0,
                 int(m.group(5)) if m.group(5) else 0,
                 int(m.group(7)) if m.group(7) else 0)
+        for field, value, limit in zip(result._fields, result,
+                                       VERSION_LIMITS):
+            if value > limit:
+                raise ValueError(
+                        "Invalid version number, the {} part, {}, is more "
+                        "than the image header holds, {}".format(
+                            field, value, limit))
         return result
     else:
         msg = "Invalid version number, should be maj.min.rev+build with later "
@@ -46,6 +57,11 @@ def decode_version(text):
         raise ValueError(msg)
 
 
+def format_version(version):
+    """The SemiSemVersion as decode_version reads it, with every part."""
+    return "{}.{}.{}+{}".format(*version)
+
+
 if __name__ == '__main__':
     print(decode_version("1.2"))
     print(decode_version("1.0"))
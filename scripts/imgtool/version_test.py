@@ -0,0 +1,56 @@
+"""
+Tests for image version numbers
+"""
+
+import os.path
+import sys
+import unittest
+
+sys.path.insert(0, os.path.abspath(os.path.join(os.path.dirname(__file__), '..')))
+
+from imgtool.version import SemiSemVersion, decode_version, format_version
+
+class DecodeVersion(unittest.TestCase):
+
+    def test_valid(self):
+        for text, want in [
+                ('1', (1, 0, 0, 0)),
+                ('1.2', (1, 2, 0, 0)),
+                ('1.2.3', (1, 2, 3, 0)),
+                ('1.2.3+4', (1, 2, 3, 4)),
+                ('0.0.0+0', (0, 0, 0, 0)),
+                ('255.255.65535+4294967295',
+                 (255, 255, 65535, 4294967295))]:
+            self.assertEqual(decode_version(text), SemiSemVersion(*want))
+
+    def test_overflow(self):
+        """Each part is refused past what its field of the header holds,
+        naming the limit."""
+        for text, message in [
+                ('256.0.0', 'the major part, 256, is more than the image '
+                            'header holds, 255'),
+                ('0.256.0', 'the minor part, 256, is more than the image '
+                            'header holds, 255'),
+                ('0.0.65536', 'the revision part, 65536, is more than the '
+                              'image header holds, 65535'),
+                ('0.0.0+4294967296', 'the build part, 4294967296, is more '
+                                     'than the image header holds, '
+                                     '4294967295')]:
+            with self.assertRaises(ValueError) as cm:
+                decode_version(text)
+            self.assertIn(message, str(cm.exception))
+
+    def test_malformed(self):
+        for text in ['', 'v1.2.3', '1.2.3.4', '1.2+3', '1..2', '01.2.3',
+                     '1.2.3+', '1.2.3-rc1', '-1.0.0', ' 1.2.3', '1.2.3\n']:
+            with self.assertRaises(ValueError, msg=text) as cm:
+                decode_version(text)
+            self.assertIn('should be maj.min.rev+build', str(cm.exception))
+
+    def test_format(self):
+        for text in ['1.2.3+4', '0.0.0+0', '255.255.65535+4294967295']:
+            self.assertEqual(format_version(decode_version(text)), text)
+        self.assertEqual(format_version(decode_version('1.2')), '1.2.0+0')
+
+if __name__ == '__main__':
+    unittest.main()